@@ -20,7 +20,10 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
+	_ "time/tzdata"
 	_ "todo-app/docs"
+	"todo-app/internal/service"
 )
 
 var (
@@ -29,8 +32,36 @@ var (
 )
 
 type config struct {
-	port int
-	env  string
+	port  int
+	env   string
+	admin string
+	todo  struct {
+		maxDepth int
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	account struct {
+		deletionGrace time.Duration
+		purgeInterval time.Duration
+	}
+	login struct {
+		maxFailures      int
+		maxFailuresPerIP int
+		failureWindow    time.Duration
+		lockout          time.Duration
+		maxLockout       time.Duration
+	}
+	password struct {
+		minLength     int
+		blocklist     string
+		hash          string
+		bcryptCost    int
+		argon2Time    uint
+		argon2Memory  uint
+		argon2Threads uint
+	}
 }
 type application struct {
 	config   config
@@ -44,6 +75,24 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 8080, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.IntVar(&cfg.todo.maxDepth, "todo-max-depth", 3, "Maximum nesting depth of subtasks, including the top-level task")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted todos stay in the trash, 0 keeps them forever")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often the trash is purged")
+	flag.DurationVar(&cfg.account.deletionGrace, "account-deletion-grace", service.AccountDeletionGrace, "How long a deleted account can be restored by logging in before it is deleted for good")
+	flag.DurationVar(&cfg.account.purgeInterval, "account-purge-interval", time.Hour, "How often accounts past the deletion grace period are deleted")
+	flag.IntVar(&cfg.login.maxFailures, "login-max-failures", service.LoginLimits.MaxFailures, "Failed logins for a username before it is locked, 0 disables the limit")
+	flag.IntVar(&cfg.login.maxFailuresPerIP, "login-max-failures-ip", service.LoginLimits.MaxFailuresPerIP, "Failed logins from an IP address before it is locked, 0 disables the limit")
+	flag.DurationVar(&cfg.login.failureWindow, "login-failure-window", service.LoginLimits.Window, "Failed logins are forgotten after this long without new ones")
+	flag.DurationVar(&cfg.login.lockout, "login-lockout", service.LoginLimits.Lockout, "Length of the first lockout, every next lockout in a row is twice as long")
+	flag.DurationVar(&cfg.login.maxLockout, "login-max-lockout", service.LoginLimits.MaxLockout, "Longest lockout")
+	flag.IntVar(&cfg.password.minLength, "password-min-length", service.PasswordPolicy.MinLength, "Minimum length of new passwords")
+	flag.StringVar(&cfg.password.blocklist, "password-blocklist", "", "File with breached passwords, in plain text or as SHA-1 hashes, one per line")
+	flag.StringVar(&cfg.password.hash, "password-hash", service.PasswordHashing.Algorithm, "Password hash for new and rehashed passwords (bcrypt|argon2id)")
+	flag.IntVar(&cfg.password.bcryptCost, "bcrypt-cost", service.PasswordHashing.BcryptCost, "bcrypt cost")
+	flag.UintVar(&cfg.password.argon2Time, "argon2-time", uint(service.PasswordHashing.Argon2Time), "Argon2id iterations")
+	flag.UintVar(&cfg.password.argon2Memory, "argon2-memory", uint(service.PasswordHashing.Argon2Memory), "Argon2id memory in KiB")
+	flag.UintVar(&cfg.password.argon2Threads, "argon2-threads", uint(service.PasswordHashing.Argon2Threads), "Argon2id parallelism")
+	flag.StringVar(&cfg.admin, "admin", "", "Username that gets the admin role at startup")
 	displayVersion := flag.Bool("version", false, "Display version information and exit")
 
 	flag.Parse()
@@ -54,6 +103,54 @@ func main() {
 		os.Exit(0)
 	}
 
+	if cfg.todo.maxDepth < 1 {
+		fmt.Fprintln(os.Stderr, "todo-max-depth must be at least 1")
+		os.Exit(2)
+	}
+
+	if cfg.trash.purgeInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "trash-purge-interval must be positive")
+		os.Exit(2)
+	}
+
+	if cfg.account.deletionGrace < 0 || cfg.account.purgeInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "account-deletion-grace must not be negative and account-purge-interval must be positive")
+		os.Exit(2)
+	}
+
+	if cfg.login.failureWindow <= 0 || cfg.login.lockout <= 0 || cfg.login.maxLockout < cfg.login.lockout {
+		fmt.Fprintln(os.Stderr, "login-failure-window and login-lockout must be positive and login-max-lockout at least login-lockout")
+		os.Exit(2)
+	}
+
+	if cfg.password.argon2Threads > 255 || cfg.password.argon2Time > 1<<32-1 || cfg.password.argon2Memory > 1<<32-1 {
+		fmt.Fprintln(os.Stderr, "argon2-threads must be at most 255, argon2-time and argon2-memory must fit in 32 bits")
+		os.Exit(2)
+	}
+	hashing := service.PasswordHashConfig{
+		Algorithm:     cfg.password.hash,
+		BcryptCost:    cfg.password.bcryptCost,
+		Argon2Time:    uint32(cfg.password.argon2Time),
+		Argon2Memory:  uint32(cfg.password.argon2Memory),
+		Argon2Threads: uint8(cfg.password.argon2Threads),
+	}
+	if err := hashing.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid password hash settings:", err)
+		os.Exit(2)
+	}
+
+	service.MaxToDoDepth = cfg.todo.maxDepth
+	service.AccountDeletionGrace = cfg.account.deletionGrace
+	service.PasswordPolicy.MinLength = cfg.password.minLength
+	service.PasswordHashing = hashing
+	service.LoginLimits = service.LoginLimitConfig{
+		MaxFailures:      cfg.login.maxFailures,
+		MaxFailuresPerIP: cfg.login.maxFailuresPerIP,
+		Window:           cfg.login.failureWindow,
+		Lockout:          cfg.login.lockout,
+		MaxLockout:       cfg.login.maxLockout,
+	}
+
 	app := &application{
 		config:   cfg,
 		infoLog:  log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/service"
+)
+
+// startTrashPurge периодически удаляет навсегда задачи, пролежавшие в корзине дольше срока хранения.
+// Работает под app.wg, поэтому при остановке сервер дожидается завершения текущей очистки.
+func (app *application) startTrashPurge(ctx context.Context) {
+	if app.config.trash.retention <= 0 {
+		app.infoLog.Printf("Trash purge is disabled")
+		return
+	}
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.trash.purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := service.PurgeTrash(database.DB, time.Now().Add(-app.config.trash.retention))
+			if err != nil {
+				app.errorLog.Printf("Trash purge failed: %v", err)
+			} else if purged > 0 {
+				app.infoLog.Printf("Purged %d todos from the trash", purged)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// startAccountPurge периодически удаляет навсегда учётные записи, срок ожидания удаления которых истёк,
+// и устаревшие счётчики неудачных попыток входа
+func (app *application) startAccountPurge(ctx context.Context) {
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.account.purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := service.PurgeDeletedAccounts(database.DB, time.Now())
+			if err != nil {
+				app.errorLog.Printf("Account purge failed: %v", err)
+			} else if purged > 0 {
+				app.infoLog.Printf("Deleted %d accounts past the deletion grace period", purged)
+			}
+			if _, err := service.PurgeLoginCounters(database.DB, time.Now()); err != nil {
+				app.errorLog.Printf("Login counter purge failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -10,12 +10,33 @@ import (
 	"syscall"
 	"time"
 	"todo-app/internal/database"
+	"todo-app/internal/models"
 	"todo-app/internal/routes"
+	"todo-app/internal/service"
 )
 
 func (app *application) startServerWithGracefulShutdown() error {
 	r := gin.Default()
 	database.Connect()
+	if err := service.LoadSigningKeys(); err != nil {
+		return err
+	}
+	if err := service.LoadOIDC(); err != nil {
+		return err
+	}
+	if err := service.LoadMailer(app.config.env); err != nil {
+		return err
+	}
+	if app.config.password.blocklist != "" {
+		if err := service.LoadPasswordBlocklist(app.config.password.blocklist); err != nil {
+			return fmt.Errorf("load password blocklist: %w", err)
+		}
+	}
+	if app.config.admin != "" {
+		if err := service.GrantRole(app.config.admin, models.UserRoleAdmin); err != nil {
+			return fmt.Errorf("grant admin role to %q: %w", app.config.admin, err)
+		}
+	}
 	routes.SetupRoutes(r)
 
 	addr := fmt.Sprintf(":%d", app.config.port)
@@ -26,6 +47,12 @@ func (app *application) startServerWithGracefulShutdown() error {
 		Handler:  r,
 	}
 
+	// Фоновые задачи останавливаются вместе с сервером
+	ctx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	app.startTrashPurge(ctx)
+	app.startAccountPurge(ctx)
+
 	shutdownError := make(chan error)
 
 	//graceful shutdown
@@ -47,7 +74,9 @@ func (app *application) startServerWithGracefulShutdown() error {
 
 		app.infoLog.Printf("completing background tasks")
 
+		stopBackground()
 		app.wg.Wait()
+		service.FlushMail()
 		shutdownError <- nil
 	}()
 
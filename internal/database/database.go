@@ -9,6 +9,7 @@ import (
 	"log"
 	"os"
 	"todo-app/internal/models"
+	"todo-app/internal/rank"
 )
 
 var DB *gorm.DB
@@ -20,7 +21,9 @@ func Connect() {
 		if err != nil {
 			log.Fatal("Не удалось подключиться к in-memory базе данных: ", err)
 		}
-		db.AutoMigrate(&models.User{}, &models.ToDo{})
+		if err := Migrate(db); err != nil {
+			log.Fatal("Не удалось выполнить миграцию: ", err)
+		}
 		DB = db
 		return
 	}
@@ -43,6 +46,92 @@ func Connect() {
 		log.Fatal("Не удалось подключиться к базе данных: ", err)
 	}
 
-	db.AutoMigrate(&models.User{}, &models.ToDo{}) // Автоматическая миграция таблицы для модели ToDo
+	if err := Migrate(db); err != nil {
+		log.Fatal("Не удалось выполнить миграцию: ", err)
+	}
 	DB = db
 }
+
+// Migrate создаёт и обновляет таблицы для всех моделей и переносит старые данные.
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&models.User{}, &models.Project{}, &models.Tag{}, &models.ToDo{}, &models.Session{}, &models.RefreshToken{}, &models.Share{}, &models.Workspace{}, &models.WorkspaceMember{}, &models.APIKey{}, &models.Identity{}, &models.OIDCLogin{}, &models.TOTP{}, &models.RecoveryCode{}, &models.MFAChallenge{}, &models.LoginCounter{}, &models.AuditLog{}, &models.UsedToken{}); err != nil {
+		return err
+	}
+	// Индексы для сортировки по полям gorm.Model, которым нельзя задать теги
+	for _, column := range []string{"created_at", "updated_at"} {
+		stmt := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_to_dos_%[1]s ON to_dos (%[1]s)", column)
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	if err := assignOrphanToDos(db, os.Getenv("ORPHAN_TODOS_OWNER")); err != nil {
+		return err
+	}
+	if err := migrateSearch(db); err != nil {
+		return err
+	}
+	return backfillPositions(db)
+}
+
+// backfillPositions выдаёт ранги задачам, созданным до появления ручного порядка.
+// Такие задачи встают в конец списка пользователя в порядке создания.
+func backfillPositions(db *gorm.DB) error {
+	var userIDs []uint
+	if err := db.Model(&models.ToDo{}).Where("position = ''").Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+		return err
+	}
+
+	for _, userID := range userIDs {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var last string
+			if err := tx.Model(&models.ToDo{}).Unscoped().Where("user_id = ?", userID).Select("COALESCE(MAX(position), '')").Scan(&last).Error; err != nil {
+				return err
+			}
+			var ids []uint
+			if err := tx.Model(&models.ToDo{}).Unscoped().Where("user_id = ? AND position = ''", userID).Order("id").Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				last = rank.After(last)
+				if err := tx.Model(&models.ToDo{}).Unscoped().Where("id = ?", id).UpdateColumn("position", last).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignOrphanToDos передаёт задачи, созданные до появления владельцев, пользователю owner.
+// Если owner не задан, такие задачи остаются недоступными, и мы только пишем предупреждение.
+func assignOrphanToDos(db *gorm.DB, owner string) error {
+	orphans := db.Model(&models.ToDo{}).Where("user_id IS NULL OR user_id = 0")
+
+	var count int64
+	if err := orphans.Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	if owner == "" {
+		log.Printf("Found %d todos without owner, set ORPHAN_TODOS_OWNER to assign them", count)
+		return nil
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", owner).First(&user).Error; err != nil {
+		return fmt.Errorf("orphan todos owner %q: %w", owner, err)
+	}
+
+	if err := db.Model(&models.ToDo{}).Where("user_id IS NULL OR user_id = 0").Update("user_id", user.ID).Error; err != nil {
+		return err
+	}
+	log.Printf("Assigned %d orphan todos to %s", count, owner)
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"todo-app/internal/models"
 
 	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestConnectToSQLite(t *testing.T) {
@@ -22,3 +24,51 @@ func TestConnectToSQLite(t *testing.T) {
 	err := DB.AutoMigrate(&models.User{}, &models.ToDo{})
 	assert.NoError(t, err)
 }
+
+func TestAssignOrphanToDos(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, Migrate(db))
+
+	owner := models.User{Username: "owner", Password: "hash"}
+	db.Create(&owner)
+	db.Create(&models.ToDo{Title: "Old task"})
+
+	// Без указанного владельца задачи остаются как есть
+	assert.NoError(t, assignOrphanToDos(db, ""))
+	var todo models.ToDo
+	db.First(&todo)
+	assert.Zero(t, todo.UserID)
+
+	assert.NoError(t, assignOrphanToDos(db, "owner"))
+	db.First(&todo)
+	assert.Equal(t, owner.ID, todo.UserID)
+
+	// Несуществующий владелец — ошибка, а не тихий пропуск
+	db.Create(&models.ToDo{Title: "Another old task"})
+	assert.Error(t, assignOrphanToDos(db, "ghost"))
+}
+
+func TestBackfillPositions(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, Migrate(db))
+
+	db.Create(&models.ToDo{UserID: 1, Title: "Ranked", Position: "m"})
+	db.Create(&models.ToDo{UserID: 1, Title: "First"})
+	db.Create(&models.ToDo{UserID: 1, Title: "Second"})
+	db.Create(&models.ToDo{UserID: 2, Title: "Other"})
+
+	assert.NoError(t, backfillPositions(db))
+
+	var todos []models.ToDo
+	db.Where("user_id = ?", 1).Order("position").Find(&todos)
+	var titles []string
+	for _, todo := range todos {
+		titles = append(titles, todo.Title)
+	}
+	// Задачи без ранга встают после уже упорядоченных в порядке создания
+	assert.Equal(t, []string{"Ranked", "First", "Second"}, titles)
+
+	var count int64
+	db.Model(&models.ToDo{}).Where("position = ''").Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SearchTable — таблица FTS5 с полнотекстовым индексом задач в SQLite
+const SearchTable = "to_dos_fts"
+
+// migrateSearch создаёт полнотекстовый индекс по названиям и описаниям задач.
+// В Postgres это вычисляемая колонка tsvector с индексом GIN, в SQLite — таблица FTS5,
+// которую синхронизируют триггеры. Если SQLite собран без FTS5, поиск работает через LIKE.
+func migrateSearch(db *gorm.DB) error {
+	if db.Dialector.Name() == "postgres" {
+		// Конфигурация russian разбирает кириллицу русским стеммером, а латиницу — английским
+		stmts := []string{
+			`ALTER TABLE to_dos ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('russian', coalesce(description, '')), 'B')
+			) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_to_dos_search ON to_dos USING GIN (search_vector)`,
+		}
+		for _, stmt := range stmts {
+			if err := db.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if db.Migrator().HasTable(SearchTable) {
+		return nil
+	}
+	stmts := []string{
+		`CREATE VIRTUAL TABLE ` + SearchTable + ` USING fts5(
+			title, description,
+			content='to_dos', content_rowid='id',
+			tokenize='porter unicode61 remove_diacritics 2'
+		)`,
+		`CREATE TRIGGER to_dos_fts_insert AFTER INSERT ON to_dos BEGIN
+			INSERT INTO to_dos_fts (rowid, title, description) VALUES (new.id, new.title, new.description);
+		END`,
+		`CREATE TRIGGER to_dos_fts_delete AFTER DELETE ON to_dos BEGIN
+			INSERT INTO to_dos_fts (to_dos_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+		END`,
+		`CREATE TRIGGER to_dos_fts_update AFTER UPDATE OF title, description ON to_dos BEGIN
+			INSERT INTO to_dos_fts (to_dos_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+			INSERT INTO to_dos_fts (rowid, title, description) VALUES (new.id, new.title, new.description);
+		END`,
+		// Индексируем задачи, созданные до появления поиска
+		`INSERT INTO to_dos_fts (to_dos_fts) VALUES ('rebuild')`,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		log.Println("SQLite is built without FTS5, search falls back to LIKE. Build with -tags sqlite_fts5 to enable it")
+		return nil
+	}
+	return err
+}
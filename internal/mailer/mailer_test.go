@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	var out bytes.Buffer
+	m := NewLog(&out, "todo@example.com")
+
+	err := m.Send(Message{To: "alice@example.com", Subject: "Подтвердите адрес", Body: "Ссылка:\nhttp://localhost/verify"})
+	assert.NoError(t, err)
+	text := out.String()
+	assert.Contains(t, text, "From: todo@example.com\r\n")
+	assert.Contains(t, text, "To: alice@example.com\r\n")
+	assert.Contains(t, text, "Subject: =?utf-8?q?")
+	assert.Contains(t, text, "\r\n\r\nСсылка:\r\nhttp://localhost/verify\r\n")
+}
+
+func TestHeaderInjection(t *testing.T) {
+	var out bytes.Buffer
+	m := NewLog(&out, "todo@example.com")
+
+	err := m.Send(Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi"})
+	assert.ErrorIs(t, err, errHeaderInjection)
+	assert.False(t, strings.Contains(out.String(), "Bcc"))
+}
+
+func TestSMTPTimeout(t *testing.T) {
+	// Сервер принимает соединение, но не отвечает
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	m := SMTP{Addr: ln.Addr().String(), From: "ToDo App <todo@example.com>", Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	err = m.Send(Message{To: "alice@example.com", Subject: "Hi"})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
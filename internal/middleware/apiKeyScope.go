@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScopeFunc возвращает scope, который нужен API ключу для маршрута. Если маршрут недоступен
+// по API ключу, ok равно false.
+type ScopeFunc func(method, path string) (scope models.APIScope, ok bool)
+
+// APIKeyScope проверяет, что у API ключа запроса есть scope маршрута. Запросы с JWT пропускает.
+// Работает после AuthMiddleware.
+func APIKeyScope(scopeOf ScopeFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get("apiKey")
+		if !ok {
+			c.Next()
+			return
+		}
+		apiKey := value.(models.APIKey)
+
+		scope, ok := scopeOf(c.Request.Method, c.FullPath())
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Route is not available with an API key"})
+			c.Abort()
+			return
+		}
+		if !apiKey.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key has no scope " + string(scope)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strings"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
 	"todo-app/internal/service"
 )
 
@@ -17,20 +19,60 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := strings.Split(authHeader, "Bearer ")[1]
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+		// API ключи работают без сессии, их права ограничивает scope ключа
+		if strings.HasPrefix(tokenString, service.APIKeyPrefix) {
+			user, apiKey, err := service.AuthenticateAPIKey(tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				c.Abort()
+				return
+			}
+			c.Set("username", user.Username)
+			c.Set("userID", user.ID)
+			c.Set("role", user.Role)
+			c.Set("apiKey", apiKey)
+			c.Next()
+			return
+		}
 
 		claims := &service.Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return service.JwtSecret, nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, claims, service.Keys.Keyfunc)
+
+		// Токены из писем подписаны теми же ключами, но у них есть aud, и для входа они не годятся
+		if err != nil || !token.Valid || claims.Audience != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Imvalid token"})
+			c.Abort()
+			return
+		}
 
-		if err != nil || !token.Valid {
+		// Находим владельца токена, чтобы обработчики работали только с его данными
+		var user models.User
+		if err := database.DB.Where("username = ?", claims.Username).First(&user).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Imvalid token"})
 			c.Abort()
 			return
 		}
+		if user.DisabledAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account disabled"})
+			c.Abort()
+			return
+		}
+
+		// Токены отозванных сессий больше не принимаются
+		var session models.Session
+		if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", claims.SessionID, user.ID).First(&session).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			c.Abort()
+			return
+		}
 
-		c.Set("username", claims.Username)
+		c.Set("username", user.Username)
+		c.Set("userID", user.ID)
+		// Роль берётся из базы, а не из токена, чтобы её изменение действовало сразу
+		c.Set("role", user.Role)
+		c.Set("sessionID", session.ID)
 		c.Next()
 	}
 }
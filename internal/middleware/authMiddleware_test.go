@@ -3,26 +3,47 @@ package middleware
 import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
 	"todo-app/internal/service"
 )
 
-// Генерация валидного JWT токена для тестов
-func generateValidJWT() string {
+// Создаём in-memory базу данных с тестовым пользователем
+func setupMiddlewareTestDB() models.User {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	database.Migrate(db)
+	database.DB = db
+
+	user := models.User{Username: "testuser", Password: "hash"}
+	database.DB.Create(&user)
+	return user
+}
+
+// Генерация валидного JWT токена с новой сессией для тестов
+func generateValidJWT(user models.User) (string, models.Session) {
+	session := models.Session{UserID: user.ID}
+	database.DB.Create(&session)
+	return signJWT(user.Username, session.ID), session
+}
+
+func signJWT(username string, sessionID uint) string {
 	expirationTime := time.Now().Add(5 * time.Minute)
 	claims := &service.Claims{
-		Username: "testuser",
+		Username:  username,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, _ := token.SignedString(service.JwtSecret)
+	tokenString, _ := service.Keys.Sign(claims)
 	return tokenString
 }
 
@@ -77,15 +98,19 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 
 // Тестирование middleware с валидным токеном
 func TestAuthMiddleware_ValidToken(t *testing.T) {
+	user := setupMiddlewareTestDB()
 	gin.SetMode(gin.TestMode)
 
 	router := gin.Default()
 	router.Use(AuthMiddleware())
 	router.GET("/protected", func(c *gin.Context) {
+		if c.GetUint("userID") != user.ID {
+			t.Errorf("Expected userID %d in context, got %d", user.ID, c.GetUint("userID"))
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "Success"})
 	})
 
-	token := generateValidJWT()
+	token, _ := generateValidJWT(user)
 	req, _ := http.NewRequest("GET", "/protected", nil)
 	req.Header.Set("Authorization", "Bearer "+token)
 	w := httptest.NewRecorder()
@@ -100,3 +125,53 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 		t.Errorf("Expected response %s, recieved %s", expectedBody, w.Body.String())
 	}
 }
+
+// Тестирование middleware с токеном несуществующего пользователя
+func TestAuthMiddleware_UnknownUser(t *testing.T) {
+	setupMiddlewareTestDB()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.Default()
+	router.Use(AuthMiddleware())
+	router.GET("/protected", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Success"})
+	})
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+signJWT("ghost", 1))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+// Тестирование middleware с токеном отозванной сессии
+func TestAuthMiddleware_RevokedSession(t *testing.T) {
+	user := setupMiddlewareTestDB()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.Default()
+	router.Use(AuthMiddleware())
+	router.GET("/protected", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Success"})
+	})
+
+	token, session := generateValidJWT(user)
+	database.DB.Model(&session).Update("revoked_at", time.Now())
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected code %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	expectedBody := `{"error":"Session revoked"}`
+	if strings.TrimSpace(w.Body.String()) != expectedBody {
+		t.Errorf("Expected response %s, got %s", expectedBody, w.Body.String())
+	}
+}
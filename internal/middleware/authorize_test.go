@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	owner := setupMiddlewareTestDB()
+	stranger := models.User{Username: "stranger", Password: "hash"}
+	database.DB.Create(&stranger)
+	todo := models.ToDo{UserID: owner.ID, Title: "Task"}
+	database.DB.Create(&todo)
+
+	rules := AccessRules{
+		"GET /todos/:id":    {Resource: ToDoResource, Permission: models.PermissionViewer},
+		"DELETE /todos/:id": {Resource: ToDoResource, Permission: models.PermissionEditor},
+	}
+	request := func(user models.User, method, url string) int {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set("userID", user.ID) }, Authorize(rules))
+		handler := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"owner": c.GetUint("ownerID")}) }
+		router.GET("/todos/:id", handler)
+		router.DELETE("/todos/:id", handler)
+		router.PUT("/todos/:id", handler)
+
+		req, _ := http.NewRequest(method, url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(owner, "GET", "/todos/1"))
+	assert.Equal(t, http.StatusNotFound, request(stranger, "GET", "/todos/1"))
+	assert.Equal(t, http.StatusNotFound, request(owner, "GET", "/todos/99"))
+	// Маршрут без правила закрыт даже для владельца
+	assert.Equal(t, http.StatusForbidden, request(owner, "PUT", "/todos/1"))
+
+	share := models.Share{OwnerID: owner.ID, UserID: stranger.ID, ToDoID: &todo.ID, Permission: models.PermissionViewer}
+	database.DB.Create(&share)
+	assert.Equal(t, http.StatusNotFound, request(stranger, "GET", "/todos/1"))
+	database.DB.Model(&share).Update("accepted_at", todo.CreatedAt)
+	assert.Equal(t, http.StatusOK, request(stranger, "GET", "/todos/1"))
+	assert.Equal(t, http.StatusForbidden, request(stranger, "DELETE", "/todos/1"))
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole пропускает только пользователей с одной из ролей roles. Работает после AuthMiddleware.
+func RequireRole(roles ...models.UserRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		for _, r := range roles {
+			if role == r {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
+		c.Abort()
+	}
+}
+
+// RequirePermission пропускает только пользователей, чья роль разрешает действие permission.
+// Работает после AuthMiddleware.
+func RequirePermission(permission models.UserPermission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get("role")
+		role, _ := value.(models.UserRole)
+		if !role.Can(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRoleAndPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	request := func(role models.UserRole, handler gin.HandlerFunc) int {
+		router := gin.New()
+		router.Use(func(c *gin.Context) { c.Set("role", role) })
+		router.GET("/", handler, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	adminOnly := RequireRole(models.UserRoleAdmin)
+	assert.Equal(t, http.StatusOK, request(models.UserRoleAdmin, adminOnly))
+	assert.Equal(t, http.StatusForbidden, request(models.UserRoleSupport, adminOnly))
+	assert.Equal(t, http.StatusForbidden, request(models.UserRoleRegular, adminOnly))
+
+	listUsers := RequirePermission(models.PermissionListUsers)
+	disableUsers := RequirePermission(models.PermissionDisableUsers)
+	assert.Equal(t, http.StatusOK, request(models.UserRoleSupport, listUsers))
+	assert.Equal(t, http.StatusForbidden, request(models.UserRoleSupport, disableUsers))
+	assert.Equal(t, http.StatusOK, request(models.UserRoleAdmin, disableUsers))
+	assert.Equal(t, http.StatusForbidden, request(models.UserRoleRegular, listUsers))
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkspaceHeader — заголовок с ID рабочего пространства для маршрутов без /workspaces/:wid
+const WorkspaceHeader = "X-Workspace-ID"
+
+// WorkspaceContext определяет рабочее пространство запроса по параметру :wid маршрута
+// или заголовку X-Workspace-ID и кладёт в контекст его ID и роль пользователя в нём.
+// Без них запрос работает с личными задачами. Тем, кто не состоит в пространстве, ответ 404.
+func WorkspaceContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.Param("wid")
+		if value == "" {
+			value = c.GetHeader(WorkspaceHeader)
+		}
+		if value == "" {
+			c.Next()
+			return
+		}
+
+		workspaceID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || workspaceID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid workspace id"})
+			c.Abort()
+			return
+		}
+		role, err := service.WorkspaceRoleOf(c.GetUint("userID"), uint(workspaceID))
+		if err != nil {
+			log.Println("Error while checking workspace membership:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Can not check access"})
+			c.Abort()
+			return
+		}
+		if role == models.RoleNone {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пространство не найдено"})
+			c.Abort()
+			return
+		}
+
+		c.Set("workspaceID", uint(workspaceID))
+		c.Set("workspaceRole", role)
+		c.Next()
+	}
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIScope — что разрешено делать с API ключом
+type APIScope string
+
+const (
+	ScopeToDosRead  APIScope = "todos:read"
+	ScopeToDosWrite APIScope = "todos:write"
+)
+
+// APIScopes — все известные scope ключей
+var APIScopes = []APIScope{ScopeToDosRead, ScopeToDosWrite}
+
+// APIKey — личный ключ для скриптов и CI. Хранится только хеш ключа,
+// сам ключ показывается один раз при создании.
+type APIKey struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // начало ключа, чтобы его можно было узнать в списке
+	KeyHash    string     `json:"-" gorm:"uniqueIndex"`
+	Scopes     []APIScope `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time `json:"expires_at"` // пусто у бессрочных ключей
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// HasScope сообщает, разрешает ли ключ действие scope
+func (k APIKey) HasScope(scope APIScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
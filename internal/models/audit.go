@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// AuditAction — тип события в журнале аудита
+type AuditAction string
+
+const (
+	// AuditLoginLockout — вход временно заблокирован после неудачных попыток
+	AuditLoginLockout AuditAction = "login.lockout"
+	// AuditAccountDeleted — учётная запись удалена навсегда после срока ожидания
+	AuditAccountDeleted AuditAction = "account.deleted"
+)
+
+// AuditLog — событие безопасности. Записи только добавляются.
+type AuditLog struct {
+	ID        uint        `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time   `json:"created_at" gorm:"index"`
+	Action    AuditAction `json:"action" gorm:"index"`
+	UserID    *uint       `json:"user_id"`
+	Username  string      `json:"username"`
+	IP        string      `json:"ip"`
+	Details   string      `json:"details"`
+}
+
+// LoginCounter — неудачные попытки входа для одного ключа: имени пользователя или IP адреса.
+// Счётчики хранятся в базе, чтобы их видели все экземпляры приложения.
+type LoginCounter struct {
+	ID            uint   `gorm:"primarykey"`
+	Key           string `gorm:"uniqueIndex"`
+	Failures      int    // неудачные попытки с последней блокировки
+	LastFailureAt time.Time
+	Lockouts      int // блокировки подряд, каждая следующая вдвое длиннее
+	LockedUntil   *time.Time
+}
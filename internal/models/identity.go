@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Identity связывает пользователя с учётной записью у внешнего OIDC провайдера.
+// Учётная запись определяется парой issuer и subject из ID токена.
+type Identity struct {
+	gorm.Model
+	UserID  uint   `json:"user_id" gorm:"index"`
+	Issuer  string `json:"issuer" gorm:"uniqueIndex:idx_identities_subject"`
+	Subject string `json:"subject" gorm:"uniqueIndex:idx_identities_subject"`
+	Email   string `json:"email"`
+}
+
+// OIDCLogin — начатый вход через OIDC провайдера, ждущий возврата пользователя.
+// Хранит state, nonce и code verifier PKCE. Если UserID задан, найденная учётная запись
+// привязывается к этому пользователю, а не используется для входа.
+type OIDCLogin struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	State        string `gorm:"uniqueIndex"`
+	Nonce        string
+	CodeVerifier string
+	UserID       *uint
+	ExpiresAt    time.Time `gorm:"index"`
+}
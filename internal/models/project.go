@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+type Project struct {
+	gorm.Model
+	UserID      uint   `json:"user_id" gorm:"index"`
+	WorkspaceID *uint  `json:"workspace_id" gorm:"index"` // пусто у личных проектов
+	Name        string `json:"name" binding:"required"`
+	Color       string `json:"color"`
+	Archived    bool   `json:"archived"`
+	Position    int    `json:"position"`
+}
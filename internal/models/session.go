@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session объединяет цепочку refresh токенов одного входа пользователя.
+// Отзыв сессии делает недействительными и её access токены.
+type Session struct {
+	gorm.Model
+	UserID    uint       `json:"user_id" gorm:"index"`
+	UserAgent string     `json:"user_agent"`
+	IP        string     `json:"ip"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// RefreshToken хранит только хеш токена. UsedAt заполняется при ротации,
+// повторное предъявление использованного токена означает его кражу.
+type RefreshToken struct {
+	gorm.Model
+	SessionID uint       `json:"session_id" gorm:"index"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// UsedToken — уже использованный одноразовый токен из письма. Хранится до истечения срока токена.
+type UsedToken struct {
+	ID        uint      `gorm:"primarykey"`
+	JTI       string    `gorm:"uniqueIndex"`
+	ExpiresAt time.Time `gorm:"index"`
+}
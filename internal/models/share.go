@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Permission — права на задачу или проект. Хранятся числом, чтобы их можно было сравнивать,
+// а в JSON передаются строкой.
+type Permission int
+
+const (
+	PermissionNone Permission = iota
+	PermissionViewer
+	PermissionEditor
+	PermissionOwner
+)
+
+var permissionNames = []string{"none", "viewer", "editor", "owner"}
+
+func (p Permission) String() string {
+	if p < 0 || int(p) >= len(permissionNames) {
+		return fmt.Sprintf("Permission(%d)", int(p))
+	}
+	return permissionNames[p]
+}
+
+// ParsePermission возвращает права по имени: viewer, editor или owner
+func ParsePermission(name string) (Permission, error) {
+	for i, n := range permissionNames {
+		if n == name && Permission(i) != PermissionNone {
+			return Permission(i), nil
+		}
+	}
+	return PermissionNone, errors.New("permission must be one of viewer, editor, owner")
+}
+
+func (p Permission) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+func (p *Permission) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	parsed, err := ParsePermission(name)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// Share открывает пользователю UserID задачу или проект владельца OwnerID.
+// Пока приглашение не принято, AcceptedAt пуст и доступа нет.
+type Share struct {
+	gorm.Model
+	OwnerID    uint       `json:"owner_id" gorm:"index"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	ToDoID     *uint      `json:"todo_id" gorm:"index"`
+	ProjectID  *uint      `json:"project_id" gorm:"index"`
+	Permission Permission `json:"permission" gorm:"not null"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+
+	// Заполняются только в ответах API
+	Username string   `json:"username,omitempty" gorm:"-"`
+	Owner    string   `json:"owner,omitempty" gorm:"-"`
+	ToDo     *ToDo    `json:"todo,omitempty" gorm:"-"`
+	Project  *Project `json:"project,omitempty" gorm:"-"`
+}
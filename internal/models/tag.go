@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Tag не удаляется мягко: после слияния имя должно освобождаться для новых меток
+type Tag struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    uint      `json:"-" gorm:"uniqueIndex:idx_tags_user_name"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_tags_user_name"`
+}
+
+// UnmarshalJSON позволяет передавать метки задачи просто именами: "tags": ["work", "home"]
+func (t *Tag) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = Tag{Name: name}
+		return nil
+	}
+
+	type plain Tag
+	var tag plain
+	if err := json.Unmarshal(data, &tag); err != nil {
+		return err
+	}
+	*t = Tag(tag)
+	return nil
+}
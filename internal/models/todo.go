@@ -1,10 +1,52 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type ToDo struct {
 	gorm.Model
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Completed   bool   `json:"completed"`
+	UserID      uint       `json:"user_id" gorm:"index;index:idx_to_dos_user_position,priority:1"`
+	WorkspaceID *uint      `json:"workspace_id" gorm:"index:idx_to_dos_workspace_position,priority:1"` // пусто у личных задач
+	ProjectID   *uint      `json:"project_id" gorm:"index"`
+	ParentID    *uint      `json:"parent_id" gorm:"index"`
+	Title       string     `json:"title" gorm:"index"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at"`
+	Priority    Priority   `json:"priority" gorm:"not null;default:0;index"`
+	Version     uint       `json:"version" gorm:"not null;default:1"` // растёт при каждом изменении, из неё строится ETag
+
+	// Position — ранг задачи в ручном порядке пользователя или рабочего пространства, меняется только через /todos/:id/move
+	Position string `json:"position" gorm:"not null;default:'';index:idx_to_dos_user_position,priority:2;index:idx_to_dos_workspace_position,priority:2"`
+
+	// Срок задаётся датой и необязательным временем в часовом поясе Timezone,
+	// DueAt и RemindAt вычисляются из них и хранятся в UTC для запросов
+	DueDate        *string    `json:"due_date"`
+	DueTime        *string    `json:"due_time"`
+	Timezone       string     `json:"timezone"`
+	DueAt          *time.Time `json:"due_at" gorm:"index"`
+	ReminderOffset *int       `json:"reminder_offset"` // за сколько минут до срока напомнить
+	RemindAt       *time.Time `json:"remind_at" gorm:"index"`
+
+	// Повторение задаётся правилом RRULE. RecurrenceStart — дата первого повторения серии,
+	// от неё правило отсчитывает INTERVAL и COUNT
+	Recurrence      *string `json:"recurrence"`
+	RecurrenceStart *string `json:"recurrence_start"`
+
+	Tags []Tag `json:"tags" gorm:"many2many:todo_tags;"`
+
+	// Заполняются только в ответах: прогресс по подзадачам и дерево подзадач
+	Progress *Progress `json:"progress,omitempty" gorm:"-"`
+	Children []ToDo    `json:"children,omitempty" gorm:"-"`
+
+	// Следующее повторение, созданное при выполнении задачи
+	NextOccurrence *ToDo `json:"next_occurrence,omitempty" gorm:"-"`
+}
+
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
 }
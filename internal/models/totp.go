@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// TOTP — второй фактор входа пользователя по RFC 6238. Пока ConfirmedAt пуст, подключение
+// не завершено и при входе код не спрашивается. LastStep — последний принятый шаг времени,
+// чтобы один код нельзя было использовать дважды.
+type TOTP struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UserID      uint   `gorm:"uniqueIndex"`
+	Secret      string // base32, как в provisioning URI
+	ConfirmedAt *time.Time
+	LastStep    int64
+}
+
+// RecoveryCode — одноразовый код восстановления на случай потери устройства. Хранится только хеш кода.
+type RecoveryCode struct {
+	ID       uint `gorm:"primarykey"`
+	UserID   uint `gorm:"index"`
+	CodeHash string
+	UsedAt   *time.Time
+}
+
+// MFAChallenge — вход, ожидающий кода второго фактора. Токен выдаётся вместо JWT
+// после проверки пароля, хранится только его хеш.
+type MFAChallenge struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint
+	TokenHash string    `gorm:"uniqueIndex"`
+	Attempts  int       // неудачные попытки ввести код
+	ExpiresAt time.Time `gorm:"index"`
+}
@@ -1,9 +1,103 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
-	Username string `json:"username" gorm:"unique"`
-	Password string `json:"password"`
+	Username        string     `json:"username" gorm:"unique"`
+	Password        string     `json:"-"` // хеш пароля никогда не попадает в ответы
+	Email           *string    `json:"email" gorm:"uniqueIndex"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"` // адрес подтверждён переходом по ссылке из письма
+	Role            UserRole   `json:"role" gorm:"not null;default:0"`
+	DisabledAt      *time.Time `json:"disabled_at"` // отключённый пользователь не может войти, его сессии отозваны
+
+	// Профиль
+	DisplayName string `json:"display_name"`
+	Timezone    string `json:"timezone"` // имя из базы IANA, например Europe/Moscow
+	Locale      string `json:"locale"`   // тег BCP 47, например ru-RU
+	AvatarURL   string `json:"avatar_url"`
+
+	// Учётная запись удаляется навсегда в это время, если пользователь до него не войдёт снова
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+// UserRole — роль пользователя в системе. Хранится числом, в JSON передаётся строкой.
+type UserRole int
+
+const (
+	UserRoleRegular UserRole = iota
+	UserRoleSupport
+	UserRoleAdmin
+)
+
+var userRoleNames = []string{"user", "support", "admin"}
+
+func (r UserRole) String() string {
+	if r < 0 || int(r) >= len(userRoleNames) {
+		return fmt.Sprintf("UserRole(%d)", int(r))
+	}
+	return userRoleNames[r]
+}
+
+// ParseUserRole возвращает роль по имени: user, support или admin
+func ParseUserRole(name string) (UserRole, error) {
+	for i, n := range userRoleNames {
+		if n == name {
+			return UserRole(i), nil
+		}
+	}
+	return UserRoleRegular, errors.New("role must be one of user, support, admin")
+}
+
+func (r UserRole) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *UserRole) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	parsed, err := ParseUserRole(name)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// UserPermission — действие, которое роль разрешает в администрировании системы
+type UserPermission string
+
+const (
+	PermissionListUsers    UserPermission = "users:list"
+	PermissionDisableUsers UserPermission = "users:disable"
+	PermissionManageRoles  UserPermission = "users:roles"
+	PermissionViewStats    UserPermission = "stats:view"
+	PermissionResetMFA     UserPermission = "users:mfa"
+	PermissionViewAudit    UserPermission = "audit:view"
+)
+
+// rolePermissions — что разрешает каждая роль. Обычному пользователю администрирование недоступно,
+// поддержка видит пользователей и статистику, администратор может всё.
+var rolePermissions = map[UserRole][]UserPermission{
+	UserRoleSupport: {PermissionListUsers, PermissionViewStats, PermissionViewAudit},
+	UserRoleAdmin:   {PermissionListUsers, PermissionDisableUsers, PermissionManageRoles, PermissionViewStats, PermissionResetMFA, PermissionViewAudit},
+}
+
+// Can сообщает, разрешает ли роль действие
+func (r UserRole) Can(permission UserPermission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Workspace — рабочее пространство команды со своими задачами и проектами
+type Workspace struct {
+	gorm.Model
+	Name string `json:"name" binding:"required"`
+
+	// Роль текущего пользователя, заполняется только в ответах
+	Role WorkspaceRole `json:"role,omitempty" gorm:"-"`
+}
+
+// WorkspaceRole — роль участника рабочего пространства. Хранится числом, чтобы роли можно было сравнивать,
+// а в JSON передаётся строкой.
+type WorkspaceRole int
+
+const (
+	RoleNone WorkspaceRole = iota
+	RoleGuest
+	RoleMember
+	RoleAdmin
+)
+
+var roleNames = []string{"none", "guest", "member", "admin"}
+
+func (r WorkspaceRole) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("WorkspaceRole(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// Permission возвращает права роли на задачи и проекты пространства:
+// гость их только читает, участник меняет, администратор распоряжается пространством
+func (r WorkspaceRole) Permission() Permission {
+	switch r {
+	case RoleGuest:
+		return PermissionViewer
+	case RoleMember:
+		return PermissionEditor
+	case RoleAdmin:
+		return PermissionOwner
+	}
+	return PermissionNone
+}
+
+// ParseWorkspaceRole возвращает роль по имени: guest, member или admin
+func ParseWorkspaceRole(name string) (WorkspaceRole, error) {
+	for i, n := range roleNames {
+		if n == name && WorkspaceRole(i) != RoleNone {
+			return WorkspaceRole(i), nil
+		}
+	}
+	return RoleNone, errors.New("role must be one of guest, member, admin")
+}
+
+func (r WorkspaceRole) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *WorkspaceRole) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	parsed, err := ParseWorkspaceRole(name)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// WorkspaceMember — участник рабочего пространства. Приглашённый становится участником,
+// когда принимает приглашение и заполняется JoinedAt.
+type WorkspaceMember struct {
+	ID          uint          `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time     `json:"created_at"`
+	WorkspaceID uint          `json:"workspace_id" gorm:"uniqueIndex:idx_workspace_members"`
+	UserID      uint          `json:"user_id" gorm:"uniqueIndex:idx_workspace_members;index"`
+	Role        WorkspaceRole `json:"role" gorm:"not null"`
+	JoinedAt    *time.Time    `json:"joined_at"`
+
+	// Заполняются только в ответах
+	Username  string     `json:"username,omitempty" gorm:"-"`
+	Workspace *Workspace `json:"workspace,omitempty" gorm:"-"`
+}
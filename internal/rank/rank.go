@@ -0,0 +1,78 @@
+// Package rank строит строковые ранги для ручного порядка задач.
+// Ранги сравниваются как строки, и между любыми двумя всегда найдётся третий,
+// поэтому перенос задачи меняет только её собственный ранг.
+package rank
+
+import (
+	"errors"
+	"strings"
+)
+
+// digits упорядочены одинаково при побайтовом сравнении и в обычных collation Postgres
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+var ErrOrder = errors.New("rank: lower bound must be less than upper bound")
+
+// Between возвращает ранг строго между prev и next. Пустой prev означает начало списка,
+// пустой next — конец. Ранги никогда не заканчиваются на "0", иначе перед ними не нашлось бы места.
+func Between(prev, next string) (string, error) {
+	if next != "" && prev >= next {
+		return "", ErrOrder
+	}
+	return midpoint(prev, next), nil
+}
+
+// After возвращает ранг после prev. В отличие от Between(prev, ""), ранг растёт
+// на один символ только раз в 35 вызовов, поэтому добавление в конец списка не удлиняет ранги быстро.
+func After(prev string) string {
+	for i := 0; i < len(prev); i++ {
+		if d := strings.IndexByte(digits, prev[i]); d < len(digits)-1 {
+			return prev[:i] + digits[d+1:d+2]
+		}
+	}
+	return prev + "1"
+}
+
+func midpoint(a, b string) string {
+	if b != "" {
+		// Общий префикс переносится как есть, середина ищется в оставшейся части
+		n := 0
+		for n < len(b) && digitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			return b[:n] + midpoint(tail(a, n), b[n:])
+		}
+	}
+
+	lo := 0
+	if a != "" {
+		lo = strings.IndexByte(digits, a[0])
+	}
+	hi := len(digits)
+	if b != "" {
+		hi = strings.IndexByte(digits, b[0])
+	}
+	if hi-lo > 1 {
+		return digits[(lo+hi+1)/2 : (lo+hi+1)/2+1]
+	}
+	// Соседние цифры: берём первую цифру b, если она короче b, иначе уходим на разряд глубже
+	if len(b) > 1 {
+		return b[:1]
+	}
+	return digits[lo:lo+1] + midpoint(tail(a, 1), "")
+}
+
+func digitAt(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return digits[0]
+}
+
+func tail(s string, n int) string {
+	if n >= len(s) {
+		return ""
+	}
+	return s[n:]
+}
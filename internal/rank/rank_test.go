@@ -0,0 +1,74 @@
+package rank
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBetween(t *testing.T) {
+	cases := []struct{ prev, next, want string }{
+		{"", "", "i"},
+		{"a", "c", "b"},
+		{"a", "b", "ai"},
+		{"", "1", "0i"},
+		{"az", "b", "azi"},
+		{"a1", "a2", "a1i"},
+		{"a", "a01", "a00i"},
+	}
+	for _, c := range cases {
+		got, err := Between(c.prev, c.next)
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, got, "%q..%q", c.prev, c.next)
+		assert.Less(t, c.prev, got)
+		if c.next != "" {
+			assert.Less(t, got, c.next)
+		}
+	}
+
+	_, err := Between("b", "a")
+	assert.ErrorIs(t, err, ErrOrder)
+	_, err = Between("b", "b")
+	assert.ErrorIs(t, err, ErrOrder)
+}
+
+func TestAfter(t *testing.T) {
+	assert.Equal(t, "1", After(""))
+	assert.Equal(t, "j", After("i"))
+	assert.Equal(t, "j", After("i5x"))
+	assert.Equal(t, "z1", After("z"))
+	assert.Equal(t, "z2", After("z1"))
+
+	// Тысяча задач в конце списка укладываются в короткие ранги
+	r := ""
+	for i := 0; i < 1000; i++ {
+		next := After(r)
+		assert.Less(t, r, next)
+		r = next
+	}
+	assert.LessOrEqual(t, len(r), 30)
+}
+
+func TestRandomInsertionsKeepOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ranks := []string{}
+	for i := 0; i < 2000; i++ {
+		pos := rng.Intn(len(ranks) + 1)
+		prev, next := "", ""
+		if pos > 0 {
+			prev = ranks[pos-1]
+		}
+		if pos < len(ranks) {
+			next = ranks[pos]
+		}
+		r, err := Between(prev, next)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEqual(t, byte('0'), r[len(r)-1])
+		ranks = append(ranks[:pos], append([]string{r}, ranks[pos:]...)...)
+	}
+	assert.True(t, sort.StringsAreSorted(ranks))
+}
@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/mailer"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var mailToken = regexp.MustCompile(`token=(\S+)`)
+
+// testMailbox собирает письма. Письма уходят в фоне, поэтому перед чтением ждём очередь.
+type testMailbox struct{ bytes.Buffer }
+
+func (m *testMailbox) String() string {
+	service.FlushMail()
+	return m.Buffer.String()
+}
+
+func (m *testMailbox) Reset() {
+	service.FlushMail()
+	m.Buffer.Reset()
+}
+
+// lastMailToken возвращает токен из последнего письма и очищает почтовый ящик
+func lastMailToken(t *testing.T, mailbox *testMailbox) string {
+	matches := mailToken.FindAllStringSubmatch(mailbox.String(), -1)
+	mailbox.Reset()
+	if !assert.NotEmpty(t, matches, "no mail with a token") {
+		return ""
+	}
+	token, _ := url.QueryUnescape(matches[len(matches)-1][1])
+	return token
+}
+
+func TestPasswordResetAndEmailVerification(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	var mailbox testMailbox
+	defer func(m mailer.Mailer) { service.Mailer = m }(service.Mailer)
+	service.Mailer = mailer.NewLog(&mailbox, "todo@example.com")
+
+	// При регистрации с адресом приходит ссылка для его подтверждения
+	assert.Equal(t, http.StatusOK, postJSON(router, "/register", `{"username":"alice","password":"old-secret-1","email":"Alice@Example.com"}`).Code)
+	assert.Contains(t, mailbox.String(), "To: alice@example.com")
+	verify := lastMailToken(t, &mailbox)
+	assert.Equal(t, http.StatusConflict, postJSON(router, "/register", `{"username":"eve","password":"eve-secret-4","email":"alice@example.com"}`).Code)
+
+	// Токен из письма не работает как access токен
+	assert.Equal(t, http.StatusUnauthorized, apiClient{t: t, router: router, token: verify}.do("GET", "/todos/", "").Code)
+
+	w := apiClient{t: t, router: router}.do("GET", "/verify-email?token="+url.QueryEscape(verify), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var user models.User
+	database.DB.Where("username = ?", "alice").First(&user)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.Equal(t, http.StatusBadRequest, apiClient{t: t, router: router}.do("GET", "/verify-email?token="+url.QueryEscape(verify), "").Code)
+
+	// Ответ на неизвестный адрес такой же, но письмо не отправляется
+	assert.Equal(t, http.StatusOK, postJSON(router, "/password/forgot", `{"email":"nobody@example.com"}`).Code)
+	assert.Empty(t, mailbox.String())
+
+	var tokens struct{ Token string }
+	json.Unmarshal(postJSON(router, "/login", `{"username":"alice","password":"old-secret-1"}`).Body.Bytes(), &tokens)
+	alice := apiClient{t: t, router: router, token: tokens.Token}
+
+	assert.Equal(t, http.StatusOK, postJSON(router, "/password/forgot", `{"email":"alice@example.com"}`).Code)
+	reset := lastMailToken(t, &mailbox)
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/password/reset", `{"token":"`+verify+`","password":"new-secret-2"}`).Code)
+	assert.Equal(t, http.StatusOK, postJSON(router, "/password/reset", `{"token":"`+reset+`","password":"new-secret-2"}`).Code)
+
+	// Сброс пароля завершает сессии, а ссылка работает один раз
+	assert.Equal(t, http.StatusUnauthorized, alice.do("GET", "/todos/", "").Code)
+	assert.Equal(t, http.StatusBadRequest, postJSON(router, "/password/reset", `{"token":"`+reset+`","password":"again-secret-3"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/login", `{"username":"alice","password":"old-secret-1"}`).Code)
+	json.Unmarshal(postJSON(router, "/login", `{"username":"alice","password":"new-secret-2"}`).Body.Bytes(), &tokens)
+	alice.token = tokens.Token
+
+	// Новый адрес нужно подтвердить заново, старые ссылки для него не подходят
+	newAPIClient(t, router, "bob").do("PUT", "/email", `{"email":"bob@example.com"}`)
+	mailbox.Reset()
+	assert.Equal(t, http.StatusConflict, alice.do("PUT", "/email", `{"email":"BOB@example.com"}`).Code)
+	assert.Equal(t, http.StatusConflict, alice.do("POST", "/verify-email/resend", "").Code)
+	assert.Equal(t, http.StatusOK, alice.do("PUT", "/email", `{"email":"alice@work.example.com"}`).Code)
+	previous := lastMailToken(t, &mailbox)
+	assert.Equal(t, http.StatusOK, alice.do("PUT", "/email", `{"email":"alice@home.example.com"}`).Code)
+	mailbox.Reset()
+	assert.Equal(t, http.StatusOK, alice.do("POST", "/verify-email/resend", "").Code)
+	assert.Contains(t, mailbox.String(), "To: alice@home.example.com")
+	current := lastMailToken(t, &mailbox)
+	assert.Equal(t, http.StatusBadRequest, apiClient{t: t, router: router}.do("GET", "/verify-email?token="+url.QueryEscape(previous), "").Code)
+	assert.Equal(t, http.StatusOK, apiClient{t: t, router: router}.do("GET", "/verify-email?token="+url.QueryEscape(current), "").Code)
+}
+
+var mailLink = regexp.MustCompile(`https?://\S+`)
+
+func TestPasswordResetLink(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	var mailbox testMailbox
+	defer func(m mailer.Mailer) { service.Mailer = m }(service.Mailer)
+	service.Mailer = mailer.NewLog(&mailbox, "todo@example.com")
+
+	assert.Equal(t, http.StatusOK, postJSON(router, "/register", `{"username":"alice","password":"old-secret-1","email":"alice@example.com"}`).Code)
+	mailbox.Reset()
+	assert.Equal(t, http.StatusOK, postJSON(router, "/password/forgot", `{"email":"alice@example.com"}`).Code)
+
+	// Ссылка из письма открывает форму на самом приложении
+	link, err := url.Parse(mailLink.FindString(mailbox.String()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, service.AppURL, link.Scheme+"://"+link.Host)
+	open := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", link.RequestURI(), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	w := open()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+	assert.Contains(t, w.Body.String(), `name="password"`)
+
+	submit := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {link.Query().Get("token")}, "password": {password}}
+		req, _ := http.NewRequest("POST", "/password/reset", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Слабый пароль не тратит ссылку, форма показывается снова
+	w = submit("short")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `name="password"`)
+
+	w = submit("new-secret-2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Пароль изменён")
+	loginAs(t, router, "alice", "new-secret-2")
+
+	// Использованная ссылка больше не открывает форму
+	w = open()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotContains(t, w.Body.String(), `name="password"`)
+}
@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmin(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	root := newAPIClient(t, router, "root")
+	support := newAPIClient(t, router, "support")
+	bob := newAPIClient(t, router, "bob")
+	assert.NoError(t, service.GrantRole("root", models.UserRoleAdmin))
+	assert.NoError(t, service.GrantRole("support", models.UserRoleSupport))
+	bob.create("/todos/", `{"title":"Task"}`)
+
+	// Обычному пользователю администрирование недоступно
+	assert.Equal(t, http.StatusForbidden, bob.do("GET", "/admin/users", "").Code)
+	assert.Equal(t, http.StatusForbidden, bob.do("GET", "/admin/stats", "").Code)
+
+	w := support.do("GET", "/admin/users?role=user", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+	assert.NotContains(t, w.Body.String(), "password")
+	var users []service.UserInfo
+	json.Unmarshal(w.Body.Bytes(), &users)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "bob", users[0].Username)
+	}
+
+	var stats service.Stats
+	json.Unmarshal(support.do("GET", "/admin/stats", "").Body.Bytes(), &stats)
+	assert.Equal(t, int64(3), stats.Users)
+	assert.Equal(t, int64(1), stats.ToDos)
+
+	// Поддержка не может отключать пользователей и менять роли
+	disable := fmt.Sprintf("/admin/users/%d/disable", users[0].ID)
+	assert.Equal(t, http.StatusForbidden, support.do("POST", disable, "").Code)
+	assert.Equal(t, http.StatusForbidden, support.do("PUT", fmt.Sprintf("/admin/users/%d/role", users[0].ID), `{"role":"admin"}`).Code)
+
+	// Отключённый пользователь теряет сессии и не может войти
+	assert.Equal(t, http.StatusOK, root.do("POST", disable, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, bob.do("GET", "/todos/", "").Code)
+	assert.Equal(t, http.StatusBadRequest, root.do("POST", "/admin/users/1/disable", "").Code)
+
+	hash, _ := hashPassword("secret")
+	database.DB.Model(&models.User{}).Where("username = ?", "bob").Update("password", hash)
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBufferString(`{"username":"bob","password":"secret"}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Equal(t, http.StatusOK, root.do("POST", fmt.Sprintf("/admin/users/%d/enable", users[0].ID), "").Code)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/login", bytes.NewBufferString(`{"username":"bob","password":"secret"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = root.do("PUT", fmt.Sprintf("/admin/users/%d/role", users[0].ID), `{"role":"support"}`)
+	assert.Contains(t, w.Body.String(), `"role":"support"`)
+	assert.Equal(t, http.StatusBadRequest, root.do("PUT", "/admin/users/1/role", `{"role":"user"}`).Code)
+}
+
+func TestRegisterIgnoresRole(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBufferString(`{"username":"mallory","password":"s3cret-passphrase","role":"admin"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var user models.User
+	database.DB.Where("username = ?", "mallory").First(&user)
+	assert.Equal(t, models.UserRoleRegular, user.Role)
+}
+
+func TestAuditLog(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	support := newAPIClient(t, router, "support")
+	bob := newAPIClient(t, router, "bob")
+	assert.NoError(t, service.GrantRole("support", models.UserRoleSupport))
+
+	// Перебор пароля блокирует вход и попадает в журнал
+	for i := 0; i < service.LoginLimits.MaxFailures; i++ {
+		postJSON(router, "/login", `{"username":"bob","password":"wrong"}`)
+	}
+	w := postJSON(router, "/login", `{"username":"bob","password":"wrong"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusForbidden, bob.do("GET", "/admin/audit", "").Code)
+	w = support.do("GET", "/admin/audit?action=login.lockout", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+	var events []models.AuditLog
+	json.Unmarshal(w.Body.Bytes(), &events)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "bob", events[0].Username)
+	}
+}
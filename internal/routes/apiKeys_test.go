@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeys(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	alice := newAPIClient(t, router, "alice")
+	alice.create("/todos/", `{"title":"Task"}`)
+
+	createKey := func(body string) service.CreatedAPIKey {
+		w := alice.do("POST", "/api-keys", body)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var created service.CreatedAPIKey
+		json.Unmarshal(w.Body.Bytes(), &created)
+		return created
+	}
+	read := createKey(`{"name":"CI","scopes":["todos:read"]}`)
+	write := createKey(`{"name":"Script","scopes":["todos:read","todos:write"]}`)
+	assert.Equal(t, read.Key[:12], read.Prefix)
+	assert.Equal(t, http.StatusBadRequest, alice.do("POST", "/api-keys", `{"name":"Bad","scopes":["admin"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, alice.do("POST", "/api-keys", `{"name":"Old","scopes":["todos:read"],"expires_at":"2020-01-01T00:00:00Z"}`).Code)
+
+	// Ключ принимается вместо JWT в пределах своих scope
+	reader := apiClient{t: t, router: router, token: read.Key}
+	writer := apiClient{t: t, router: router, token: write.Key}
+	assert.Equal(t, http.StatusOK, reader.do("GET", "/todos/", "").Code)
+	assert.Equal(t, http.StatusForbidden, reader.do("POST", "/todos/", `{"title":"New"}`).Code)
+	assert.Equal(t, http.StatusOK, writer.do("POST", "/todos/", `{"title":"New"}`).Code)
+	// Ключом нельзя управлять ключами и сессиями
+	assert.Equal(t, http.StatusForbidden, writer.do("GET", "/api-keys", "").Code)
+	assert.Equal(t, http.StatusForbidden, writer.do("POST", "/logout-all", "").Code)
+
+	w := alice.do("GET", "/api-keys", "")
+	assert.NotContains(t, w.Body.String(), read.Key)
+	var keys []models.APIKey
+	json.Unmarshal(w.Body.Bytes(), &keys)
+	if assert.Len(t, keys, 2) {
+		assert.NotNil(t, keys[0].LastUsedAt)
+	}
+
+	assert.Equal(t, http.StatusOK, alice.do("DELETE", fmt.Sprintf("/api-keys/%d", read.ID), "").Code)
+	assert.Equal(t, http.StatusNotFound, alice.do("DELETE", fmt.Sprintf("/api-keys/%d", read.ID), "").Code)
+	assert.Equal(t, http.StatusUnauthorized, reader.do("GET", "/todos/", "").Code)
+
+	database.DB.Model(&models.APIKey{}).Where("id = ?", write.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	assert.Equal(t, http.StatusUnauthorized, writer.do("GET", "/todos/", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, apiClient{t: t, router: router, token: "tdk_unknown"}.do("GET", "/todos/", "").Code)
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func postJSON(router *gin.Engine, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", url, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// mfaLogin входит с паролем и возвращает токен второго шага
+func mfaLogin(t *testing.T, router *gin.Engine) string {
+	w := postJSON(router, "/login", `{"username":"alice","password":"secret"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		Token       string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &challenge)
+	assert.True(t, challenge.MFARequired)
+	assert.Empty(t, challenge.Token)
+	return challenge.MFAToken
+}
+
+func mfaBody(token, code string) string {
+	return fmt.Sprintf(`{"mfa_token":%q,"code":%q}`, token, code)
+}
+
+func TestTOTPLogin(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	alice := newAPIClient(t, router, "alice")
+	root := newAPIClient(t, router, "root")
+	assert.NoError(t, service.GrantRole("root", models.UserRoleAdmin))
+	hash, _ := hashPassword("secret")
+	database.DB.Model(&models.User{}).Where("username = ?", "alice").Update("password", hash)
+	// Неверные коды блокируют и вход по паролю, это проверяет TestLoginLockout
+	defer func(limits service.LoginLimitConfig) { service.LoginLimits = limits }(service.LoginLimits)
+	service.LoginLimits.MaxFailures = 0
+
+	// Пока подключение не подтверждено, вход работает как раньше
+	var enrollment service.TOTPEnrollment
+	json.Unmarshal(alice.do("POST", "/auth/totp/enroll", "").Body.Bytes(), &enrollment)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/")
+	assert.Contains(t, postJSON(router, "/login", `{"username":"alice","password":"secret"}`).Body.String(), `"token"`)
+
+	assert.Equal(t, http.StatusBadRequest, alice.do("POST", "/auth/totp/verify", `{"code":"000000"}`).Code)
+	code, _ := service.TOTPCode(enrollment.Secret, time.Now())
+	w := alice.do("POST", "/auth/totp/verify", fmt.Sprintf(`{"code":%q}`, code))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var recovery struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &recovery)
+	assert.Len(t, recovery.RecoveryCodes, 10)
+	assert.Equal(t, http.StatusConflict, alice.do("POST", "/auth/totp/enroll", "").Code)
+
+	// С включённой 2FA пароль даёт только токен второго шага, и он не работает как JWT
+	token := mfaLogin(t, router)
+	assert.Equal(t, http.StatusUnauthorized, apiClient{t: t, router: router, token: token}.do("GET", "/todos/", "").Code)
+
+	// Код, уже принятый при подтверждении, повторно не принимается
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/login/mfa", mfaBody(token, code)).Code)
+	w = postJSON(router, "/login/mfa", mfaBody(token, recovery.RecoveryCodes[0]))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens struct{ Token string }
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	assert.Equal(t, http.StatusOK, apiClient{t: t, router: router, token: tokens.Token}.do("GET", "/todos/", "").Code)
+
+	// Токен второго шага и код восстановления одноразовые
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/login/mfa", mfaBody(token, recovery.RecoveryCodes[1])).Code)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/login/mfa", mfaBody(mfaLogin(t, router), recovery.RecoveryCodes[0])).Code)
+
+	// После нескольких неверных кодов нужно снова ввести пароль
+	token = mfaLogin(t, router)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/login/mfa", mfaBody(token, "000000")).Code)
+	}
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/login/mfa", mfaBody(token, recovery.RecoveryCodes[1])).Code)
+
+	// Отключить 2FA можно только с действующим кодом
+	assert.Equal(t, http.StatusBadRequest, alice.do("POST", "/auth/totp/disable", `{"code":"000000"}`).Code)
+
+	// Администратор сбрасывает 2FA потерявшему устройство пользователю
+	var users []service.UserInfo
+	json.Unmarshal(root.do("GET", "/admin/users?q=alice", "").Body.Bytes(), &users)
+	reset := fmt.Sprintf("/admin/users/%d/totp", users[0].ID)
+	assert.Equal(t, http.StatusForbidden, alice.do("DELETE", reset, "").Code)
+	assert.Equal(t, http.StatusOK, root.do("DELETE", reset, "").Code)
+	assert.Contains(t, postJSON(router, "/login", `{"username":"alice","password":"secret"}`).Body.String(), `"token"`)
+	assert.Equal(t, http.StatusNotFound, alice.do("POST", "/auth/totp/disable", `{"code":"000000"}`).Code)
+}
@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/oidctest"
+	"todo-app/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// oidcAuthURL возвращает адрес входа у провайдера из ответа /auth/oidc/login или /auth/oidc/link
+func oidcAuthURL(start *httptest.ResponseRecorder) string {
+	if location := start.Header().Get("Location"); location != "" {
+		return location
+	}
+	var link struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	json.Unmarshal(start.Body.Bytes(), &link)
+	return link.AuthorizationURL
+}
+
+// loginWithOIDC проходит вход у провайдера, начатый ответом start, и возвращает ответ обратного вызова
+// приложения. Cookie из start передаются в обратный вызов, как это сделал бы браузер.
+func loginWithOIDC(t *testing.T, router *gin.Engine, mock *oidctest.Server, start *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	client := mock.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(oidcAuthURL(start))
+	if !assert.NoError(t, err) {
+		return httptest.NewRecorder()
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, _ := url.Parse(resp.Header.Get("Location"))
+	req, _ := http.NewRequest("GET", callback.RequestURI(), nil)
+	for _, cookie := range start.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func startOIDCLogin(router *gin.Engine) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/auth/oidc/login", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCLogin(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	mock := oidctest.NewServer("todo-app")
+	defer mock.Close()
+
+	// Без настройки вход через OIDC выключен
+	service.OIDC = nil
+	assert.Equal(t, http.StatusNotFound, startOIDCLogin(router).Code)
+
+	provider, err := service.NewOIDCProvider(service.OIDCConfig{
+		Issuer:      mock.Issuer(),
+		ClientID:    "todo-app",
+		RedirectURL: "http://localhost:8080/auth/oidc/callback",
+	}, mock.Client())
+	if !assert.NoError(t, err) {
+		return
+	}
+	service.OIDC = provider
+	defer func() { service.OIDC = nil }()
+
+	start := startOIDCLogin(router)
+	assert.Contains(t, oidcAuthURL(start), "code_challenge_method=S256")
+	cookie := start.Header().Get("Set-Cookie")
+	assert.Contains(t, cookie, "HttpOnly")
+	assert.Contains(t, cookie, "SameSite=Lax")
+
+	// При первом входе создаётся пользователь, и приложение выдаёт свои обычные токены
+	w := loginWithOIDC(t, router, mock, start)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tokens struct{ Token string }
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	user := apiClient{t: t, router: router, token: tokens.Token}
+	user.create("/todos/", `{"title":"From SSO"}`)
+
+	// Повторный вход попадает в того же пользователя, а state используется один раз
+	assert.Equal(t, http.StatusOK, loginWithOIDC(t, router, mock, startOIDCLogin(router)).Code)
+	assert.Equal(t, http.StatusBadRequest, loginWithOIDC(t, router, mock, start).Code)
+	var count int64
+	database.DB.Model(&models.User{}).Where("username = ?", "oidc-user").Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// Учётную запись провайдера можно привязать к существующему пользователю
+	bob := newAPIClient(t, router, "bob")
+	bob.create("/todos/", `{"title":"Bob's"}`)
+	mock.Claims = map[string]interface{}{"sub": "bob-at-sso", "preferred_username": "robert"}
+
+	// Ссылку на привязку, открытую в чужом браузере, нельзя завершить: так чужую учётную запись
+	// провайдера можно было бы привязать к своему пользователю
+	link := bob.do("POST", "/auth/oidc/link", "")
+	stolen := httptest.NewRecorder()
+	stolen.Body.Write(link.Body.Bytes())
+	assert.Equal(t, http.StatusBadRequest, loginWithOIDC(t, router, mock, stolen).Code)
+
+	assert.Equal(t, http.StatusOK, loginWithOIDC(t, router, mock, bob.do("POST", "/auth/oidc/link", "")).Code)
+
+	w = loginWithOIDC(t, router, mock, startOIDCLogin(router))
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	todos := apiClient{t: t, router: router, token: tokens.Token}.do("GET", "/todos/", "")
+	assert.Contains(t, todos.Body.String(), "Bob's")
+
+	// Ту же учётную запись нельзя привязать к другому пользователю
+	assert.Equal(t, http.StatusConflict, loginWithOIDC(t, router, mock, user.do("POST", "/auth/oidc/link", "")).Code)
+
+	// Вход через провайдера не обходит включённую 2FA
+	var enrollment service.TOTPEnrollment
+	robert := apiClient{t: t, router: router, token: tokens.Token}
+	json.Unmarshal(robert.do("POST", "/auth/totp/enroll", "").Body.Bytes(), &enrollment)
+	code, _ := service.TOTPCode(enrollment.Secret, time.Now())
+	assert.Equal(t, http.StatusOK, robert.do("POST", "/auth/totp/verify", fmt.Sprintf(`{"code":%q}`, code)).Code)
+
+	w = loginWithOIDC(t, router, mock, startOIDCLogin(router))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		Token       string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &challenge)
+	assert.True(t, challenge.MFARequired)
+	assert.Empty(t, challenge.Token)
+	code, _ = service.TOTPCode(enrollment.Secret, time.Now().Add(30*time.Second))
+	assert.Equal(t, http.StatusOK, postJSON(router, "/login/mfa", mfaBody(challenge.MFAToken, code)).Code)
+}
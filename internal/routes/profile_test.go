@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// loginAs входит с паролем и возвращает клиента с полученным access токеном
+func loginAs(t *testing.T, router *gin.Engine, username, password string) apiClient {
+	w := postJSON(router, "/login", `{"username":"`+username+`","password":"`+password+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var tokens struct{ Token string }
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	return apiClient{t: t, router: router, token: tokens.Token}
+}
+
+func TestProfile(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	assert.Equal(t, http.StatusOK, postJSON(router, "/register", `{"username":"alice","password":"old-secret-1","email":"alice@example.com"}`).Code)
+	alice := loginAs(t, router, "alice", "old-secret-1")
+
+	// Хеш пароля не попадает в ответы
+	w := alice.do("GET", "/me", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "password")
+	assert.Contains(t, w.Body.String(), `"email":"alice@example.com"`)
+
+	w = alice.do("PATCH", "/me", `{"display_name":" Alice ","timezone":"Europe/Moscow","locale":"ru-ru","avatar_url":"https://example.com/a.png"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "password")
+	var user models.User
+	json.Unmarshal(alice.do("GET", "/me", "").Body.Bytes(), &user)
+	assert.Equal(t, "Alice", user.DisplayName)
+	assert.Equal(t, "Europe/Moscow", user.Timezone)
+	assert.Equal(t, "ru-RU", user.Locale)
+	assert.Equal(t, "https://example.com/a.png", user.AvatarURL)
+
+	for _, body := range []string{
+		`{"timezone":"Mars/Olympus"}`,
+		`{"timezone":"Local"}`,
+		`{"locale":"not a locale"}`,
+		`{"avatar_url":"javascript:alert(1)"}`,
+		`{"avatar_url":"/relative.png"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, alice.do("PATCH", "/me", body).Code, body)
+	}
+
+	// Непереданные поля не меняются, пустая строка очищает поле
+	assert.Equal(t, http.StatusOK, alice.do("PATCH", "/me", `{"avatar_url":""}`).Code)
+	json.Unmarshal(alice.do("GET", "/me", "").Body.Bytes(), &user)
+	assert.Empty(t, user.AvatarURL)
+	assert.Equal(t, "Alice", user.DisplayName)
+
+	// Роль через профиль не меняется
+	alice.do("PATCH", "/me", `{"role":"admin"}`)
+	database.DB.First(&user, user.ID)
+	assert.Equal(t, models.UserRoleRegular, user.Role)
+}
+
+func TestChangePassword(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	assert.Equal(t, http.StatusOK, postJSON(router, "/register", `{"username":"alice","password":"old-secret-1"}`).Code)
+	alice := loginAs(t, router, "alice", "old-secret-1")
+	other := loginAs(t, router, "alice", "old-secret-1")
+
+	assert.Equal(t, http.StatusForbidden, alice.do("POST", "/me/password", `{"current_password":"wrong","new_password":"new-secret-2"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, alice.do("POST", "/me/password", `{"current_password":"old-secret-1","new_password":"short"}`).Code)
+
+	w := alice.do("POST", "/me/password", `{"current_password":"old-secret-1","new_password":"new-secret-2"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Текущая сессия продолжает работать, остальные завершены
+	assert.Equal(t, http.StatusOK, alice.do("GET", "/me", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, other.do("GET", "/me", "").Code)
+
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/login", `{"username":"alice","password":"old-secret-1"}`).Code)
+	loginAs(t, router, "alice", "new-secret-2")
+}
+
+func TestDeleteAccount(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	assert.Equal(t, http.StatusOK, postJSON(router, "/register", `{"username":"alice","password":"old-secret-1"}`).Code)
+	alice := loginAs(t, router, "alice", "old-secret-1")
+	alice.create("/todos/", `{"title":"Task"}`)
+
+	assert.Equal(t, http.StatusForbidden, alice.do("DELETE", "/me", `{"password":"wrong"}`).Code)
+	assert.Equal(t, http.StatusForbidden, alice.do("DELETE", "/me", "").Code)
+
+	w := alice.do("DELETE", "/me", `{"password":"old-secret-1"}`)
+	assert.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "deletion_scheduled_at")
+	assert.Equal(t, http.StatusUnauthorized, alice.do("GET", "/me", "").Code)
+
+	// Вход в течение срока ожидания отменяет удаление
+	alice = loginAs(t, router, "alice", "old-secret-1")
+	var user models.User
+	json.Unmarshal(alice.do("GET", "/me", "").Body.Bytes(), &user)
+	assert.Nil(t, user.DeletionScheduledAt)
+
+	// После срока учётная запись и её задачи удаляются навсегда
+	assert.Equal(t, http.StatusAccepted, alice.do("DELETE", "/me", `{"password":"old-secret-1"}`).Code)
+	purged, err := service.PurgeDeletedAccounts(database.DB, user.CreatedAt.Add(service.AccountDeletionGrace*2))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	var users, todos int64
+	database.DB.Unscoped().Model(&models.User{}).Where("username = ?", "alice").Count(&users)
+	database.DB.Unscoped().Model(&models.ToDo{}).Where("user_id = ?", user.ID).Count(&todos)
+	assert.Zero(t, users)
+	assert.Zero(t, todos)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(router, "/login", `{"username":"alice","password":"old-secret-1"}`).Code)
+}
@@ -1,13 +1,135 @@
 package routes
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/swaggo/files"
 	"github.com/swaggo/gin-swagger"
 	"todo-app/internal/middleware"
+	"todo-app/internal/models"
 	"todo-app/internal/service"
 )
 
+var (
+	// Свои данные: в рабочем пространстве чтение доступно гостю, изменение — участнику,
+	// управление пространством — администратору
+	own      = middleware.Rule{Resource: middleware.OwnData}
+	ownRead  = middleware.Rule{Resource: middleware.OwnData, Permission: models.PermissionViewer}
+	ownWrite = middleware.Rule{Resource: middleware.OwnData, Permission: models.PermissionEditor}
+	ownAdmin = middleware.Rule{Resource: middleware.OwnData, Permission: models.PermissionOwner}
+
+	viewer = models.PermissionViewer
+	editor = models.PermissionEditor
+	owner  = models.PermissionOwner
+)
+
+// accessRules — права для каждого маршрута защищённой группы. Маршрут без правила закрыт.
+var accessRules = withWorkspaceRoutes(middleware.AccessRules{
+	"POST /logout":     own,
+	"POST /logout-all": own,
+
+	"POST /auth/oidc/link": own,
+
+	"PUT /email":                own,
+	"POST /verify-email/resend": own,
+
+	"GET /me":           own,
+	"PATCH /me":         own,
+	"DELETE /me":        own,
+	"POST /me/password": own,
+
+	"POST /auth/totp/enroll":         own,
+	"POST /auth/totp/verify":         own,
+	"POST /auth/totp/recovery-codes": own,
+	"POST /auth/totp/disable":        own,
+
+	"GET /todos/":                       ownRead,
+	"POST /todos/":                      ownWrite,
+	"POST /todos/batch":                 ownWrite,
+	"GET /todos/search":                 ownRead,
+	"GET /todos/trash":                  ownRead,
+	"GET /todos/:id":                    {Resource: middleware.ToDoResource, Permission: viewer},
+	"PUT /todos/:id":                    {Resource: middleware.ToDoResource, Permission: editor},
+	"PATCH /todos/:id":                  {Resource: middleware.ToDoResource, Permission: editor},
+	"DELETE /todos/:id":                 {Resource: middleware.ToDoResource, Permission: editor},
+	"GET /todos/:id/occurrences":        {Resource: middleware.ToDoResource, Permission: viewer},
+	"POST /todos/:id/move":              {Resource: middleware.ToDoResource, Permission: editor},
+	"POST /todos/:id/restore":           {Resource: middleware.ToDoResource, Permission: owner},
+	"GET /todos/:id/shares":             {Resource: middleware.ToDoResource, Permission: owner},
+	"POST /todos/:id/shares":            {Resource: middleware.ToDoResource, Permission: owner},
+	"DELETE /todos/:id/shares/:shareId": {Resource: middleware.ToDoResource, Permission: owner},
+
+	"GET /projects/":                       ownRead,
+	"POST /projects/":                      ownWrite,
+	"GET /projects/:id":                    {Resource: middleware.ProjectResource, Permission: viewer},
+	"PUT /projects/:id":                    {Resource: middleware.ProjectResource, Permission: editor},
+	"DELETE /projects/:id":                 {Resource: middleware.ProjectResource, Permission: owner},
+	"GET /projects/:id/todos":              {Resource: middleware.ProjectResource, Permission: viewer},
+	"GET /projects/:id/shares":             {Resource: middleware.ProjectResource, Permission: owner},
+	"POST /projects/:id/shares":            {Resource: middleware.ProjectResource, Permission: owner},
+	"DELETE /projects/:id/shares/:shareId": {Resource: middleware.ProjectResource, Permission: owner},
+
+	"GET /tags/":       own,
+	"PUT /tags/:id":    own,
+	"POST /tags/merge": own,
+
+	"GET /shared":                   own,
+	"GET /invitations":              own,
+	"POST /invitations/:id/accept":  {Resource: middleware.InvitationResource, Permission: owner},
+	"POST /invitations/:id/decline": {Resource: middleware.InvitationResource, Permission: owner},
+
+	"GET /workspaces/":                          own,
+	"POST /workspaces/":                         own,
+	"GET /workspaces/invitations":               own,
+	"POST /workspaces/invitations/:id/accept":   {Resource: middleware.WorkspaceInvitationResource, Permission: owner},
+	"POST /workspaces/invitations/:id/decline":  {Resource: middleware.WorkspaceInvitationResource, Permission: owner},
+	"GET /workspaces/:wid":                      ownRead,
+	"PUT /workspaces/:wid":                      ownAdmin,
+	"POST /workspaces/:wid/leave":               ownRead,
+	"GET /workspaces/:wid/members":              ownRead,
+	"POST /workspaces/:wid/members":             ownAdmin,
+	"PUT /workspaces/:wid/members/:memberId":    ownAdmin,
+	"DELETE /workspaces/:wid/members/:memberId": ownAdmin,
+
+	"GET /api-keys":        own,
+	"POST /api-keys":       own,
+	"DELETE /api-keys/:id": own,
+
+	// Администрирование проверяет права роли пользователя в RequirePermission
+	"GET /admin/users":              own,
+	"POST /admin/users/:id/disable": own,
+	"POST /admin/users/:id/enable":  own,
+	"PUT /admin/users/:id/role":     own,
+	"DELETE /admin/users/:id/totp":  own,
+	"GET /admin/stats":              own,
+	"GET /admin/audit":              own,
+})
+
+// apiKeyScope — какой scope нужен API ключу для маршрута. По ключу доступны только задачи,
+// проекты и метки: чтение со scope todos:read, изменение со scope todos:write.
+func apiKeyScope(method, path string) (models.APIScope, bool) {
+	path = strings.TrimPrefix(path, "/workspaces/:wid")
+	if !strings.HasPrefix(path, "/todos/") && !strings.HasPrefix(path, "/projects/") && !strings.HasPrefix(path, "/tags/") {
+		return "", false
+	}
+	if method == "GET" {
+		return models.ScopeToDosRead, true
+	}
+	return models.ScopeToDosWrite, true
+}
+
+// withWorkspaceRoutes добавляет к rules те же правила для маршрутов задач и проектов внутри рабочего пространства
+func withWorkspaceRoutes(rules middleware.AccessRules) middleware.AccessRules {
+	for key, rule := range rules {
+		method, path, _ := strings.Cut(key, " ")
+		if strings.HasPrefix(path, "/todos/") || strings.HasPrefix(path, "/projects/") {
+			rules[method+" /workspaces/:wid"+path] = rule
+		}
+	}
+	return rules
+}
+
 func SetupRoutes(r *gin.Engine) {
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -18,17 +140,121 @@ func SetupRoutes(r *gin.Engine) {
 	// Маршруты для аутентификации
 	r.POST("/register", service.Register)
 	r.POST("/login", service.Login)
+	r.POST("/login/mfa", service.LoginMFA)
+	r.POST("/token/refresh", service.RefreshToken)
+	r.GET("/.well-known/jwks.json", service.JWKS)
+	r.GET("/auth/oidc/login", service.OIDCLogin)
+	r.GET("/auth/oidc/callback", service.OIDCCallback)
+	r.POST("/password/forgot", service.ForgotPassword)
+	r.GET("/password/reset", service.ResetPasswordForm)
+	r.POST("/password/reset", service.ResetPassword)
+	r.GET("/verify-email", service.VerifyEmail)
+
+	// Защищенные маршруты
+	protected := r.Group("/")
+	protected.Use(middleware.AuthMiddleware(), middleware.APIKeyScope(apiKeyScope), middleware.WorkspaceContext(), middleware.Authorize(accessRules))
+
+	// Завершение сессий
+	protected.POST("/logout", service.Logout)
+	protected.POST("/logout-all", service.LogoutAll)
+	protected.POST("/auth/oidc/link", service.LinkOIDC)
+
+	// Адрес почты
+	protected.PUT("/email", service.ChangeEmail)
+	protected.POST("/verify-email/resend", service.ResendVerificationEmail)
+
+	// Профиль и учётная запись
+	protected.GET("/me", service.GetProfile)
+	protected.PATCH("/me", service.UpdateProfile)
+	protected.DELETE("/me", service.DeleteAccount)
+	protected.POST("/me/password", service.ChangePassword)
+
+	// Двухфакторная аутентификация
+	protected.POST("/auth/totp/enroll", service.EnrollTOTP)
+	protected.POST("/auth/totp/verify", service.ConfirmTOTP)
+	protected.POST("/auth/totp/recovery-codes", service.RegenerateRecoveryCodes)
+	protected.POST("/auth/totp/disable", service.DisableTOTP)
 
-	// Защищенные маршруты для задач
-	protected := r.Group("/todos")
-	protected.Use(middleware.AuthMiddleware())
+	// Задачи и проекты: личные и в рабочем пространстве
+	todoRoutes(protected.Group("/todos"))
+	projectRoutes(protected.Group("/projects"))
+	todoRoutes(protected.Group("/workspaces/:wid/todos"))
+	projectRoutes(protected.Group("/workspaces/:wid/projects"))
 
-	// CRUD операции для задач
-	protected.GET("/", service.GetAllToDos)
-	protected.POST("/", service.CreateToDo)
-	protected.PUT("/:id", service.UpdateToDo)
-	protected.DELETE("/:id", service.DeleteToDo)
+	// Метки задач
+	tags := protected.Group("/tags")
+	tags.GET("/", service.GetTags)
+	tags.PUT("/:id", service.RenameTag)
+	tags.POST("/merge", service.MergeTags)
+
+	// Совместный доступ
+	protected.GET("/shared", service.GetShared)
+	protected.GET("/invitations", service.GetInvitations)
+	protected.POST("/invitations/:id/accept", service.AcceptInvitation)
+	protected.POST("/invitations/:id/decline", service.DeclineInvitation)
+
+	// Рабочие пространства
+	workspaces := protected.Group("/workspaces")
+	workspaces.GET("/", service.GetWorkspaces)
+	workspaces.POST("/", service.CreateWorkspace)
+	workspaces.GET("/invitations", service.GetWorkspaceInvitations)
+	workspaces.POST("/invitations/:id/accept", service.AcceptWorkspaceInvitation)
+	workspaces.POST("/invitations/:id/decline", service.DeclineWorkspaceInvitation)
+	workspaces.GET("/:wid", service.GetWorkspace)
+	workspaces.PUT("/:wid", service.UpdateWorkspace)
+	workspaces.POST("/:wid/leave", service.LeaveWorkspace)
+	workspaces.GET("/:wid/members", service.GetWorkspaceMembers)
+	workspaces.POST("/:wid/members", service.InviteWorkspaceMember)
+	workspaces.PUT("/:wid/members/:memberId", service.UpdateWorkspaceMember)
+	workspaces.DELETE("/:wid/members/:memberId", service.RemoveWorkspaceMember)
+
+	// API ключи
+	protected.GET("/api-keys", service.GetAPIKeys)
+	protected.POST("/api-keys", service.CreateAPIKey)
+	protected.DELETE("/api-keys/:id", service.RevokeAPIKey)
+
+	// Администрирование
+	admin := protected.Group("/admin")
+	admin.GET("/users", middleware.RequirePermission(models.PermissionListUsers), service.GetUsers)
+	admin.POST("/users/:id/disable", middleware.RequirePermission(models.PermissionDisableUsers), service.DisableUser)
+	admin.POST("/users/:id/enable", middleware.RequirePermission(models.PermissionDisableUsers), service.EnableUser)
+	admin.PUT("/users/:id/role", middleware.RequirePermission(models.PermissionManageRoles), service.SetUserRole)
+	admin.DELETE("/users/:id/totp", middleware.RequirePermission(models.PermissionResetMFA), service.ResetUserTOTP)
+	admin.GET("/stats", middleware.RequirePermission(models.PermissionViewStats), service.GetStats)
+	admin.GET("/audit", middleware.RequirePermission(models.PermissionViewAudit), service.GetAuditLog)
 
 	// Swagger
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 }
+
+// todoRoutes — CRUD операции для задач
+func todoRoutes(todos *gin.RouterGroup) {
+	todos.GET("/", service.GetAllToDos)
+	todos.POST("/", service.CreateToDo)
+	todos.POST("/batch", service.BatchToDos)
+	todos.GET("/search", service.SearchToDos)
+	todos.GET("/trash", service.GetTrash)
+	todos.GET("/:id", service.GetToDo)
+	todos.PUT("/:id", service.UpdateToDo)
+	todos.PATCH("/:id", service.PatchToDo)
+	todos.DELETE("/:id", service.DeleteToDo)
+	todos.GET("/:id/occurrences", service.GetToDoOccurrences)
+	todos.POST("/:id/move", service.MoveToDo)
+	todos.POST("/:id/restore", service.RestoreToDo)
+	todos.GET("/:id/shares", service.GetToDoShares)
+	todos.POST("/:id/shares", service.ShareToDo)
+	todos.DELETE("/:id/shares/:shareId", service.RevokeToDoShare)
+}
+
+// projectRoutes — CRUD операции для проектов
+func projectRoutes(projects *gin.RouterGroup) {
+	projects.GET("/", service.GetProjects)
+	projects.POST("/", service.CreateProject)
+	projects.GET("/:id", service.GetProject)
+	projects.PUT("/:id", service.UpdateProject)
+	projects.DELETE("/:id", service.DeleteProject)
+	projects.GET("/:id/todos", service.GetProjectToDos)
+	projects.GET("/:id/shares", service.GetProjectShares)
+	projects.POST("/:id/shares", service.ShareProject)
+	projects.DELETE("/:id/shares/:shareId", service.RevokeProjectShare)
+}
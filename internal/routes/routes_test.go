@@ -22,7 +22,7 @@ import (
 func setupRoutesTestDB() {
 	// Создаём in-memory базу данных для тестов
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&models.User{}, &models.ToDo{})
+	database.Migrate(db)
 	database.DB = db
 }
 
@@ -40,17 +40,20 @@ func hashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
-// Вспомогательная функция для генерации JWT токена
-func generateJWT(username string) (string, error) {
+// Вспомогательная функция для генерации JWT токена в новой сессии
+func generateJWT(user models.User) (string, error) {
+	session := models.Session{UserID: user.ID}
+	database.DB.Create(&session)
+
 	expirationTime := time.Now().Add(24 * time.Hour)
 	claims := &service.Claims{
-		Username: username,
+		Username:  user.Username,
+		SessionID: session.ID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(service.JwtSecret)
+	tokenString, err := service.Keys.Sign(claims)
 	return tokenString, err
 }
 
@@ -71,9 +74,9 @@ func TestRegisterRoute(t *testing.T) {
 	router := setupRouter()
 
 	// Создадим запрос на регистрацию
-	user := models.User{
+	user := service.RegisterInput{
 		Username: "testuser",
-		Password: "password123",
+		Password: "correct horse battery",
 	}
 	jsonValue, _ := json.Marshal(user)
 
@@ -101,7 +104,7 @@ func TestLoginRoute(t *testing.T) {
 	database.DB.Create(&user)
 
 	// Создадим запрос на логин
-	loginData := models.User{
+	loginData := service.LoginInput{
 		Username: "testuser",
 		Password: "password123",
 	}
@@ -148,7 +151,7 @@ func TestProtectedRouteWithToken(t *testing.T) {
 	database.DB.Create(&user)
 
 	// Генерируем JWT токен для пользователя
-	tokenString, _ := generateJWT(user.Username)
+	tokenString, _ := generateJWT(user)
 
 	// Создадим запрос для получения задач с токеном
 	req, _ := http.NewRequest("GET", "/todos/", nil)
@@ -159,3 +162,59 @@ func TestProtectedRouteWithToken(t *testing.T) {
 	// Ожидаем 200 статус
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestRefreshAndLogoutRoutes(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+
+	hashedPassword, _ := hashPassword("password123")
+	database.DB.Create(&models.User{Username: "testuser", Password: hashedPassword})
+
+	// Логинимся и получаем пару токенов
+	jsonValue, _ := json.Marshal(service.LoginInput{Username: "testuser", Password: "password123"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var login map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &login)
+	assert.NotEmpty(t, login["refresh_token"])
+
+	// Обмениваем refresh токен на новую пару
+	jsonValue, _ = json.Marshal(gin.H{"refresh_token": login["refresh_token"]})
+	req, _ = http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var refreshed map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	accessToken := refreshed["token"].(string)
+
+	// Выходим и проверяем, что токен сессии больше не принимается
+	req, _ = http.NewRequest("POST", "/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/todos/", nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestJWKSRoute(t *testing.T) {
+	router := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"keys"`)
+}
@@ -0,0 +1,198 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// publicRoutes — маршруты вне защищённой группы
+var publicRoutes = map[string]bool{
+	"GET /":                      true,
+	"POST /register":             true,
+	"POST /login":                true,
+	"POST /login/mfa":            true,
+	"POST /token/refresh":        true,
+	"GET /.well-known/jwks.json": true,
+	"GET /auth/oidc/login":       true,
+	"GET /auth/oidc/callback":    true,
+	"POST /password/forgot":      true,
+	"GET /password/reset":        true,
+	"POST /password/reset":       true,
+	"GET /verify-email":          true,
+	"GET /swagger/*any":          true,
+}
+
+func TestEveryProtectedRouteHasAccessRule(t *testing.T) {
+	router := setupRouter()
+
+	registered := map[string]bool{}
+	for _, route := range router.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		if !publicRoutes[key] {
+			_, ok := accessRules[key]
+			assert.True(t, ok, "no access rule for %s", key)
+		}
+	}
+	for key := range accessRules {
+		assert.True(t, registered[key], "access rule for unknown route %s", key)
+	}
+}
+
+// apiClient отправляет запросы от имени одного пользователя
+type apiClient struct {
+	t      *testing.T
+	router *gin.Engine
+	token  string
+}
+
+func newAPIClient(t *testing.T, router *gin.Engine, username string) apiClient {
+	user := models.User{Username: username, Password: "hash"}
+	database.DB.Create(&user)
+	token, _ := generateJWT(user)
+	return apiClient{t: t, router: router, token: token}
+}
+
+func (a apiClient) do(method, url, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return w
+}
+
+func (a apiClient) create(url, body string) uint {
+	w := a.do("POST", url, body)
+	assert.Equal(a.t, http.StatusOK, w.Code, w.Body.String())
+	var created struct{ ID uint }
+	json.Unmarshal(w.Body.Bytes(), &created)
+	return created.ID
+}
+
+func TestSharingProject(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	alice := newAPIClient(t, router, "alice")
+	bob := newAPIClient(t, router, "bob")
+	carol := newAPIClient(t, router, "carol")
+
+	projectID := alice.create("/projects/", `{"name":"Home"}`)
+	todo := fmt.Sprintf("/todos/%d", alice.create("/todos/", fmt.Sprintf(`{"title":"Paint","project_id":%d}`, projectID)))
+	private := fmt.Sprintf("/todos/%d", alice.create("/todos/", `{"title":"Private"}`))
+	project := fmt.Sprintf("/projects/%d", projectID)
+
+	shareID := alice.create(project+"/shares", `{"username":"bob","permission":"viewer"}`)
+	assert.Equal(t, http.StatusNotFound, alice.do("POST", project+"/shares", `{"username":"nobody","permission":"viewer"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, alice.do("POST", project+"/shares", `{"username":"bob","permission":"none"}`).Code)
+
+	// До принятия приглашения доступа нет
+	assert.Equal(t, http.StatusNotFound, bob.do("GET", todo, "").Code)
+	w := bob.do("GET", "/invitations", "")
+	assert.Contains(t, w.Body.String(), `"owner":"alice"`)
+	assert.Equal(t, http.StatusNotFound, carol.do("POST", fmt.Sprintf("/invitations/%d/accept", shareID), "").Code)
+	assert.Equal(t, http.StatusOK, bob.do("POST", fmt.Sprintf("/invitations/%d/accept", shareID), "").Code)
+
+	// Наблюдатель видит проект и его задачи, но не может их менять
+	assert.Equal(t, http.StatusOK, bob.do("GET", todo, "").Code)
+	assert.Equal(t, http.StatusOK, bob.do("GET", project+"/todos", "").Code)
+	assert.Equal(t, http.StatusForbidden, bob.do("PATCH", todo, `{"title":"Mine"}`).Code)
+	assert.Equal(t, http.StatusNotFound, bob.do("GET", private, "").Code)
+	assert.Equal(t, http.StatusNotFound, carol.do("GET", todo, "").Code)
+
+	w = bob.do("GET", "/shared", "")
+	var shared []models.Share
+	json.Unmarshal(w.Body.Bytes(), &shared)
+	if assert.Len(t, shared, 1) {
+		assert.Equal(t, "Home", shared[0].Project.Name)
+		assert.Equal(t, models.PermissionViewer, shared[0].Permission)
+	}
+
+	// Повторное приглашение меняет права, и редактор может менять задачи, но не проект целиком
+	alice.create(project+"/shares", `{"username":"bob","permission":"editor"}`)
+	w = bob.do("PATCH", todo, `{"title":"Paint the fence"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"user_id":1`)
+	assert.Equal(t, http.StatusForbidden, bob.do("DELETE", project, "").Code)
+	assert.Equal(t, http.StatusForbidden, bob.do("GET", project+"/shares", "").Code)
+
+	w = alice.do("GET", project+"/shares", "")
+	assert.True(t, strings.Contains(w.Body.String(), `"username":"bob"`), w.Body.String())
+
+	assert.Equal(t, http.StatusOK, alice.do("DELETE", fmt.Sprintf("%s/shares/%d", project, shareID), "").Code)
+	assert.Equal(t, http.StatusNotFound, bob.do("GET", todo, "").Code)
+}
+
+func TestSharingToDo(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	alice := newAPIClient(t, router, "alice")
+	bob := newAPIClient(t, router, "bob")
+
+	parentID := alice.create("/todos/", `{"title":"Move"}`)
+	child := fmt.Sprintf("/todos/%d", alice.create("/todos/", fmt.Sprintf(`{"title":"Pack","parent_id":%d}`, parentID)))
+	parent := fmt.Sprintf("/todos/%d", parentID)
+
+	shareID := alice.create(parent+"/shares", `{"username":"bob","permission":"owner"}`)
+	bob.do("POST", fmt.Sprintf("/invitations/%d/accept", shareID), "")
+
+	// Приглашение к задаче открывает и её подзадачи
+	assert.Equal(t, http.StatusOK, bob.do("GET", child, "").Code)
+	assert.Equal(t, http.StatusOK, bob.do("GET", parent+"/shares", "").Code)
+	assert.Equal(t, http.StatusBadRequest, bob.do("POST", parent+"/shares", `{"username":"alice","permission":"viewer"}`).Code)
+
+	// Получатель может отказаться от доступа
+	assert.Equal(t, http.StatusOK, bob.do("POST", fmt.Sprintf("/invitations/%d/decline", shareID), "").Code)
+	assert.Equal(t, http.StatusNotFound, bob.do("GET", child, "").Code)
+	assert.Equal(t, "[]", bob.do("GET", "/shared", "").Body.String())
+}
+
+func TestSharedEditorLimits(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	alice := newAPIClient(t, router, "alice")
+	bob := newAPIClient(t, router, "bob")
+
+	sharedProject := alice.create("/projects/", `{"name":"Home"}`)
+	otherProject := alice.create("/projects/", `{"name":"Work"}`)
+	todo := fmt.Sprintf("/todos/%d", alice.create("/todos/", fmt.Sprintf(`{"title":"Paint","project_id":%d}`, sharedProject)))
+	sibling := alice.create("/todos/", fmt.Sprintf(`{"title":"Fence","project_id":%d}`, sharedProject))
+	private := alice.create("/todos/", `{"title":"Private"}`)
+	shareID := alice.create(fmt.Sprintf("/projects/%d/shares", sharedProject), `{"username":"bob","permission":"editor"}`)
+	bob.do("POST", fmt.Sprintf("/invitations/%d/accept", shareID), "")
+
+	// Редактор не переносит задачу в чужие ему проекты и задачи владельца
+	w := bob.do("PATCH", todo, fmt.Sprintf(`{"project_id":%d}`, otherProject))
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "project not found")
+	w = bob.do("PATCH", todo, fmt.Sprintf(`{"parent_id":%d}`, private))
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "parent task not found")
+	w = bob.do("PATCH", todo, fmt.Sprintf(`{"parent_id":%d}`, sibling))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Редактор переименовывает проект, но не удаляет его системными полями в теле запроса
+	project := fmt.Sprintf("/projects/%d", sharedProject)
+	w = bob.do("PUT", project, `{"name":"House","DeletedAt":"2020-01-01T00:00:00Z","CreatedAt":"2020-01-01T00:00:00Z","user_id":2}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = alice.do("GET", project, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"name":"House"`)
+	assert.Contains(t, w.Body.String(), `"user_id":1`)
+	assert.NotContains(t, w.Body.String(), "2020-01-01")
+
+	// Удалить навсегда может только владелец, в корзину — и редактор
+	assert.Equal(t, http.StatusForbidden, bob.do("DELETE", todo+"?permanent=true", "").Code)
+	assert.Equal(t, http.StatusOK, bob.do("DELETE", todo, "").Code)
+	assert.Equal(t, http.StatusOK, alice.do("DELETE", todo+"?permanent=true", "").Code)
+}
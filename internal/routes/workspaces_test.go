@@ -0,0 +1,104 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/middleware"
+	"todo-app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// titles возвращает названия задач из ответа со списком
+func titles(w *httptest.ResponseRecorder) []string {
+	var todos []models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todos)
+	result := []string{}
+	for _, todo := range todos {
+		result = append(result, todo.Title)
+	}
+	return result
+}
+
+func TestWorkspaces(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	alice := newAPIClient(t, router, "alice")
+	bob := newAPIClient(t, router, "bob")
+	carol := newAPIClient(t, router, "carol")
+	dave := newAPIClient(t, router, "dave")
+
+	workspaceID := alice.create("/workspaces/", `{"name":"Team"}`)
+	workspace := fmt.Sprintf("/workspaces/%d", workspaceID)
+	assert.Contains(t, alice.do("GET", "/workspaces/", "").Body.String(), `"role":"admin"`)
+
+	bobID := alice.create(workspace+"/members", `{"username":"bob","role":"member"}`)
+	carolID := alice.create(workspace+"/members", `{"username":"carol","role":"guest"}`)
+	assert.Equal(t, http.StatusBadRequest, alice.do("POST", workspace+"/members", `{"username":"dave","role":"owner"}`).Code)
+
+	// Пока приглашение не принято, пространство недоступно
+	assert.Equal(t, http.StatusNotFound, bob.do("GET", workspace+"/todos/", "").Code)
+	assert.Contains(t, bob.do("GET", "/workspaces/invitations", "").Body.String(), `"name":"Team"`)
+	assert.Equal(t, http.StatusNotFound, carol.do("POST", fmt.Sprintf("/workspaces/invitations/%d/accept", bobID), "").Code)
+	assert.Equal(t, http.StatusOK, bob.do("POST", fmt.Sprintf("/workspaces/invitations/%d/accept", bobID), "").Code)
+	assert.Equal(t, http.StatusConflict, bob.do("POST", fmt.Sprintf("/workspaces/invitations/%d/accept", bobID), "").Code)
+	carol.do("POST", fmt.Sprintf("/workspaces/invitations/%d/accept", carolID), "")
+
+	// Задачи пространства отделены от личных; пространство можно указать в URL или заголовке
+	shared := fmt.Sprintf("%s/todos/%d", workspace, alice.create(workspace+"/todos/", `{"title":"Plan"}`))
+	private := fmt.Sprintf("/todos/%d", alice.create("/todos/", `{"title":"Diary"}`))
+	req, _ := http.NewRequest("POST", "/todos/", bytes.NewBufferString(`{"title":"Review"}`))
+	req.Header.Set("Authorization", "Bearer "+bob.token)
+	req.Header.Set(middleware.WorkspaceHeader, fmt.Sprint(workspaceID))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, []string{"Plan", "Review"}, titles(carol.do("GET", workspace+"/todos/", "")))
+	assert.Equal(t, []string{"Diary"}, titles(alice.do("GET", "/todos/", "")))
+	assert.Equal(t, []string{}, titles(bob.do("GET", "/todos/", "")))
+	assert.Equal(t, http.StatusNotFound, bob.do("GET", workspace+private, "").Code)
+	assert.Equal(t, http.StatusNotFound, dave.do("GET", workspace+"/todos/", "").Code)
+
+	// Участник меняет задачи, гость только читает
+	assert.Equal(t, http.StatusOK, bob.do("PATCH", shared, `{"title":"Plan the sprint"}`).Code)
+	assert.Equal(t, http.StatusOK, carol.do("GET", shared, "").Code)
+	assert.Equal(t, http.StatusForbidden, carol.do("PATCH", shared, `{"title":"Mine"}`).Code)
+	assert.Equal(t, http.StatusForbidden, carol.do("POST", workspace+"/todos/", `{"title":"Guest"}`).Code)
+	assert.Equal(t, http.StatusForbidden, bob.do("POST", workspace+"/members", `{"username":"dave","role":"guest"}`).Code)
+
+	// Последний администратор не может уйти или сложить с себя роль
+	var members []models.WorkspaceMember
+	json.Unmarshal(alice.do("GET", workspace+"/members", "").Body.Bytes(), &members)
+	if assert.Len(t, members, 3) {
+		assert.Equal(t, "alice", members[0].Username)
+	}
+	aliceMember := fmt.Sprintf("%s/members/%d", workspace, members[0].ID)
+	assert.Equal(t, http.StatusConflict, alice.do("POST", workspace+"/leave", "").Code)
+	assert.Equal(t, http.StatusConflict, alice.do("PUT", aliceMember, `{"role":"member"}`).Code)
+
+	assert.Equal(t, http.StatusOK, alice.do("PUT", fmt.Sprintf("%s/members/%d", workspace, bobID), `{"role":"admin"}`).Code)
+	assert.Equal(t, http.StatusOK, alice.do("POST", workspace+"/leave", "").Code)
+	assert.Equal(t, http.StatusNotFound, alice.do("GET", shared, "").Code)
+
+	assert.Equal(t, http.StatusOK, bob.do("DELETE", fmt.Sprintf("%s/members/%d", workspace, carolID), "").Code)
+	assert.Equal(t, http.StatusNotFound, carol.do("GET", workspace, "").Code)
+	assert.Contains(t, bob.do("GET", workspace, "").Body.String(), `"role":"admin"`)
+}
+
+func TestWorkspaceHeaderIsValidated(t *testing.T) {
+	setupRoutesTestDB()
+	router := setupRouter()
+	alice := newAPIClient(t, router, "alice")
+
+	req, _ := http.NewRequest("GET", "/todos/", nil)
+	req.Header.Set("Authorization", "Bearer "+alice.token)
+	req.Header.Set(middleware.WorkspaceHeader, "team")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
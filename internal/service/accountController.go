@@ -0,0 +1,323 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/mailer"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+	"gorm.io/gorm"
+)
+
+// EmailInput — адрес почты
+type EmailInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordInput — токен из письма и новый пароль. Принимается в JSON и из формы на странице сброса.
+type ResetPasswordInput struct {
+	Token    string `json:"token" form:"token" binding:"required"`
+	Password string `json:"password" form:"password" binding:"required"`
+}
+
+// resetPage — страница сброса пароля, на которую по умолчанию ведёт ссылка из письма
+var resetPage = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Сброс пароля</title></head>
+<body>
+<h1>Сброс пароля</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Token}}<form method="post" action="reset">
+<input type="hidden" name="token" value="{{.Token}}">
+<label>Новый пароль <input type="password" name="password" autocomplete="new-password" required autofocus></label>
+<button type="submit">Сохранить</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+type resetPageData struct {
+	Token   string
+	Message string
+	Error   string
+}
+
+// renderResetPage отдаёт страницу сброса пароля. Токен в адресе не должен уходить дальше в Referer и кеши.
+func renderResetPage(c *gin.Context, status int, data resetPageData) {
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Cache-Control", "no-store")
+	c.Render(status, render.HTML{Template: resetPage, Data: data})
+}
+
+// respondReset отвечает на сброс пароля: клиентам API — JSON, форме со страницы сброса — страницей
+func respondReset(c *gin.Context, status int, data resetPageData) {
+	if c.ContentType() == binding.MIMEPOSTForm {
+		renderResetPage(c, status, data)
+		return
+	}
+	if data.Error != "" {
+		c.JSON(status, gin.H{"error": data.Error})
+		return
+	}
+	c.JSON(status, gin.H{"message": data.Message})
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailTaken сообщает, занят ли адрес другим пользователем
+func emailTaken(email string, userID uint) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.User{}).Where("email = ? AND id <> ?", email, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// sendVerificationEmail отправляет пользователю ссылку для подтверждения адреса
+func sendVerificationEmail(user models.User) {
+	token, err := newEmailToken(purposeVerifyEmail, user, EmailVerificationTTL)
+	if err != nil {
+		log.Println("Error while creating email verification token:", err)
+		return
+	}
+	sendMail(*user.Email, "Подтвердите адрес почты", fmt.Sprintf(
+		"Здравствуйте, %s!\n\nЧтобы подтвердить адрес почты, перейдите по ссылке:\n%s/verify-email?token=%s\n\nСсылка действует до %s.",
+		user.Username, AppURL, url.QueryEscape(token), time.Now().Add(EmailVerificationTTL).Format("02.01.2006 15:04 MST"),
+	))
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Send a link for setting a new password to the address, if a user has it. The response is the same whether the address is registered or not.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body     EmailInput  true  "Email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Router /password/forgot [post]
+func ForgotPassword(c *gin.Context) {
+	var input EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Пользователь ищется уже в очереди писем: ответ не зависит от того, есть ли такой адрес,
+	// ни содержанием, ни временем, чтобы по нему нельзя было узнать пользователей
+	email, m := normalizeEmail(input.Email), Mailer
+	enqueueMail(func() { sendPasswordReset(m, email) })
+	c.JSON(http.StatusOK, gin.H{"message": "Если адрес зарегистрирован, на него отправлена ссылка для сброса пароля"})
+}
+
+// sendPasswordReset отправляет ссылку для сброса пароля пользователю с адресом email, если он есть
+func sendPasswordReset(m mailer.Mailer, email string) {
+	var user models.User
+	err := database.DB.Where("email = ? AND disabled_at IS NULL", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+	if err != nil {
+		log.Println("Error while looking up user by email:", err)
+		return
+	}
+	token, err := newEmailToken(purposeResetPassword, user, PasswordResetTTL)
+	if err != nil {
+		log.Println("Error while creating password reset token:", err)
+		return
+	}
+	deliverMail(m, *user.Email, "Сброс пароля", fmt.Sprintf(
+		"Здравствуйте, %s!\n\nЧтобы задать новый пароль, перейдите по ссылке:\n%s\n\nСсылка действует до %s. Если вы не просили сбросить пароль, просто не обращайте внимания на это письмо.",
+		user.Username, passwordResetLink(token), time.Now().Add(PasswordResetTTL).Format("02.01.2006 15:04 MST"),
+	))
+}
+
+// ResetPasswordForm godoc
+// @Summary Show the password reset form
+// @Description The link in the password reset email points here, unless RESET_URL sends it to a frontend. Shows a form for a new password if the token is still valid. The form posts to POST /password/reset.
+// @Tags auth
+// @Produce  html
+// @Param   token  query    string  true  "Token from the email"
+// @Success 200 {string} string
+// @Failure 400 {string} string
+// @Router /password/reset [get]
+func ResetPasswordForm(c *gin.Context) {
+	token := c.Query("token")
+	if _, err := checkEmailToken(database.DB, token, purposeResetPassword); err != nil {
+		if !errors.Is(err, errInvalidEmailToken) {
+			log.Println("Error while checking password reset token:", err)
+			renderResetPage(c, http.StatusInternalServerError, resetPageData{Error: "Не удалось проверить ссылку"})
+			return
+		}
+		renderResetPage(c, http.StatusBadRequest, resetPageData{Error: "Ссылка недействительна или устарела"})
+		return
+	}
+	renderResetPage(c, http.StatusOK, resetPageData{Token: token})
+}
+
+// ResetPassword godoc
+// @Summary Reset the password
+// @Description Set a new password with the token from the password reset email. Accepts JSON, or the form from GET /password/reset and then answers with a page. The token works once and for an hour. The password must follow the same policy as in /register. All sessions of the user are revoked.
+// @Tags auth
+// @Accept  json
+// @Accept  x-www-form-urlencoded
+// @Produce  json
+// @Param   body  body     ResetPasswordInput  true  "Token and new password"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /password/reset [post]
+func ResetPassword(c *gin.Context) {
+	var input ResetPasswordInput
+	if err := c.ShouldBind(&input); err != nil {
+		respondReset(c, http.StatusBadRequest, resetPageData{Token: input.Token, Error: err.Error()})
+		return
+	}
+	var policyErr error
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := useEmailToken(tx, input.Token, purposeResetPassword)
+		if err != nil {
+			return err
+		}
+		// Неподходящий пароль откатывает транзакцию, и ссылкой можно воспользоваться ещё раз
+		if policyErr = validatePassword(user.Username, input.Password); policyErr != nil {
+			return policyErr
+		}
+		hash, err := hashPassword(input.Password)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("password", hash).Error; err != nil {
+			return err
+		}
+		// Тот, кто знал старый пароль, теряет доступ
+		return revokeSessions(tx, "user_id = ?", user.ID)
+	})
+	if errors.Is(err, errInvalidEmailToken) {
+		respondReset(c, http.StatusBadRequest, resetPageData{Error: "Ссылка недействительна или устарела"})
+		return
+	}
+	if policyErr != nil {
+		respondReset(c, http.StatusBadRequest, resetPageData{Token: input.Token, Error: policyErr.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("Error while resetting password:", err)
+		respondReset(c, http.StatusInternalServerError, resetPageData{Error: "Не удалось сменить пароль"})
+		return
+	}
+	respondReset(c, http.StatusOK, resetPageData{Message: "Пароль изменён"})
+}
+
+// VerifyEmail godoc
+// @Summary Verify the email address
+// @Description Confirm the address with the token from the verification email. The link in the email points here.
+// @Tags auth
+// @Produce  json
+// @Param   token  query    string  true  "Token from the email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /verify-email [get]
+func VerifyEmail(c *gin.Context) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := useEmailToken(tx, c.Query("token"), purposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("email_verified_at", time.Now()).Error
+	})
+	if errors.Is(err, errInvalidEmailToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка недействительна или устарела"})
+		return
+	}
+	if err != nil {
+		log.Println("Error while verifying email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось подтвердить адрес"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Адрес подтверждён"})
+}
+
+// ChangeEmail godoc
+// @Summary Change the email address
+// @Description Set the email address of the current user and send a verification link to it. Until it is verified, the address is marked as unverified.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body     EmailInput  true  "Email"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /email [put]
+func ChangeEmail(c *gin.Context) {
+	var input EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	email := normalizeEmail(input.Email)
+	userID := currentUserID(c)
+	if taken, err := emailTaken(email, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить адрес"})
+		return
+	} else if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Адрес уже используется"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить адрес"})
+		return
+	}
+	if user.Email != nil && *user.Email == email && user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Адрес уже подтверждён"})
+		return
+	}
+	user.Email, user.EmailVerifiedAt = &email, nil
+	if err := database.DB.Model(&user).Select("email", "email_verified_at").Updates(&user).Error; err != nil {
+		log.Println("Error while changing email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить адрес"})
+		return
+	}
+	sendVerificationEmail(user)
+	c.JSON(http.StatusOK, gin.H{"message": "На адрес отправлена ссылка для подтверждения"})
+}
+
+// ResendVerificationEmail godoc
+// @Summary Resend the verification email
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /verify-email/resend [post]
+func ResendVerificationEmail(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отправить письмо"})
+		return
+	}
+	if user.Email == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Адрес почты не указан"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Адрес уже подтверждён"})
+		return
+	}
+	sendVerificationEmail(user)
+	c.JSON(http.StatusOK, gin.H{"message": "На адрес отправлена ссылка для подтверждения"})
+}
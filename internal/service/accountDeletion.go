@@ -0,0 +1,168 @@
+package service
+
+import (
+	"time"
+	"todo-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PurgeDeletedAccounts навсегда удаляет учётные записи, срок удаления которых наступил к now,
+// вместе с личными задачами, проектами, метками и доступами. Возвращает число удалённых учётных записей.
+func PurgeDeletedAccounts(db *gorm.DB, now time.Time) (int64, error) {
+	var ids []uint
+	if err := db.Model(&models.User{}).Where("deletion_scheduled_at <= ?", now).Order("id").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, id := range ids {
+		purged, err := purgeAccount(db, id, now)
+		if err != nil {
+			return total, err
+		}
+		if purged {
+			total++
+		}
+	}
+	return total, nil
+}
+
+// purgeAccount удаляет учётную запись, если её удаление всё ещё назначено на now или раньше:
+// пользователь мог войти и отменить удаление, уже попав в список на удаление
+func purgeAccount(db *gorm.DB, id uint, now time.Time) (bool, error) {
+	purged := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		result := tx.Scopes(forUpdate).Where("id = ? AND deletion_scheduled_at <= ?", id, now).Limit(1).Find(&user)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := deleteAccount(tx, user); err != nil {
+			return err
+		}
+		purged = true
+		return nil
+	})
+	return purged && err == nil, err
+}
+
+// deleteAccount удаляет пользователя и всё, что принадлежит только ему.
+// Задачи и проекты рабочих пространств остаются команде, журнал аудита не трогается.
+func deleteAccount(tx *gorm.DB, user models.User) error {
+	if err := leaveWorkspaces(tx, user.ID); err != nil {
+		return err
+	}
+
+	var todoIDs []uint
+	if err := tx.Model(&models.ToDo{}).Unscoped().Where("user_id = ? AND workspace_id IS NULL", user.ID).Pluck("id", &todoIDs).Error; err != nil {
+		return err
+	}
+	if err := purgeToDos(tx, todoIDs); err != nil {
+		return err
+	}
+	if err := purgeProjects(tx, "user_id = ? AND workspace_id IS NULL", user.ID); err != nil {
+		return err
+	}
+
+	var tagIDs []uint
+	if err := tx.Model(&models.Tag{}).Where("user_id = ?", user.ID).Pluck("id", &tagIDs).Error; err != nil {
+		return err
+	}
+	if len(tagIDs) > 0 {
+		if err := tx.Exec("DELETE FROM todo_tags WHERE tag_id IN ?", tagIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Tag{}, tagIDs).Error; err != nil {
+			return err
+		}
+	}
+
+	// Доступы, выданные пользователем и выданные ему
+	if err := tx.Unscoped().Where("owner_id = ? OR user_id = ?", user.ID, user.ID).Delete(&models.Share{}).Error; err != nil {
+		return err
+	}
+
+	if err := removeTOTP(tx, user.ID); err != nil {
+		return err
+	}
+	for _, model := range []interface{}{&models.Session{}, &models.RefreshToken{}, &models.APIKey{}, &models.Identity{}, &models.OIDCLogin{}} {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("key = ?", "user:"+user.Username).Delete(&models.LoginCounter{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Unscoped().Delete(&user).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.AuditLog{Action: models.AuditAccountDeleted, UserID: &user.ID, Username: user.Username}).Error
+}
+
+// leaveWorkspaces убирает пользователя из рабочих пространств и отклоняет его приглашения.
+// Если он был последним администратором, администратором становится участник, вступивший раньше других.
+// Пространство, в котором больше никого нет, удаляется вместе с задачами и проектами.
+func leaveWorkspaces(tx *gorm.DB, userID uint) error {
+	var memberships []models.WorkspaceMember
+	if err := tx.Scopes(joinedMembers).Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+		return err
+	}
+	for _, member := range memberships {
+		var others []models.WorkspaceMember
+		err := tx.Scopes(joinedMembers).Where("workspace_id = ? AND user_id <> ?", member.WorkspaceID, userID).
+			Order("joined_at, id").Find(&others).Error
+		if err != nil {
+			return err
+		}
+		if len(others) == 0 {
+			if err := purgeWorkspace(tx, member.WorkspaceID); err != nil {
+				return err
+			}
+			continue
+		}
+		hasAdmin := member.Role != models.RoleAdmin
+		for _, other := range others {
+			hasAdmin = hasAdmin || other.Role == models.RoleAdmin
+		}
+		if !hasAdmin {
+			if err := tx.Model(&others[0]).Update("role", models.RoleAdmin).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.WorkspaceMember{}).Error
+}
+
+// purgeWorkspace навсегда удаляет рабочее пространство, его задачи, проекты и приглашения
+func purgeWorkspace(tx *gorm.DB, workspaceID uint) error {
+	var todoIDs []uint
+	if err := tx.Model(&models.ToDo{}).Unscoped().Where("workspace_id = ?", workspaceID).Pluck("id", &todoIDs).Error; err != nil {
+		return err
+	}
+	if err := purgeToDos(tx, todoIDs); err != nil {
+		return err
+	}
+	if err := purgeProjects(tx, "workspace_id = ?", workspaceID); err != nil {
+		return err
+	}
+	if err := tx.Where("workspace_id = ?", workspaceID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&models.Workspace{}, workspaceID).Error
+}
+
+// purgeProjects навсегда удаляет проекты, подходящие под условие, вместе с приглашениями в них
+func purgeProjects(tx *gorm.DB, query interface{}, args ...interface{}) error {
+	var ids []uint
+	if err := tx.Model(&models.Project{}).Unscoped().Where(query, args...).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Where("project_id IN ?", ids).Delete(&models.Share{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&models.Project{}, ids).Error
+}
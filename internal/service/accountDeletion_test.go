@@ -0,0 +1,92 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	alice := setupTestDB()
+	bob := createTestUser("bob")
+	now := time.Now()
+	database.DB.Model(&alice).Update("deletion_scheduled_at", now.Add(-time.Minute))
+	database.DB.Model(&bob).Update("deletion_scheduled_at", now.Add(time.Hour))
+
+	// Личные данные
+	project := models.Project{UserID: alice.ID, Name: "Home"}
+	database.DB.Create(&project)
+	todo := models.ToDo{UserID: alice.ID, Title: "Paint", ProjectID: &project.ID, Tags: []models.Tag{{UserID: alice.ID, Name: "home"}}}
+	database.DB.Create(&todo)
+	database.DB.Create(&models.Share{OwnerID: alice.ID, UserID: bob.ID, ProjectID: &project.ID, Permission: models.PermissionViewer})
+
+	// В общем пространстве администратором становится bob, пространство только alice удаляется
+	shared, solo := models.Workspace{Name: "Team"}, models.Workspace{Name: "Solo"}
+	database.DB.Create(&shared)
+	database.DB.Create(&solo)
+	database.DB.Create(&[]models.WorkspaceMember{
+		{WorkspaceID: shared.ID, UserID: alice.ID, Role: models.RoleAdmin, JoinedAt: &now},
+		{WorkspaceID: shared.ID, UserID: bob.ID, Role: models.RoleMember, JoinedAt: &now},
+		{WorkspaceID: solo.ID, UserID: alice.ID, Role: models.RoleAdmin, JoinedAt: &now},
+		{WorkspaceID: solo.ID, UserID: bob.ID, Role: models.RoleMember},
+	})
+	teamToDo := models.ToDo{UserID: alice.ID, WorkspaceID: &shared.ID, Title: "Team task"}
+	soloToDo := models.ToDo{UserID: alice.ID, WorkspaceID: &solo.ID, Title: "Solo task"}
+	database.DB.Create(&teamToDo)
+	database.DB.Create(&soloToDo)
+
+	purged, err := PurgeDeletedAccounts(database.DB, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	count := func(model interface{}, query string, args ...interface{}) int64 {
+		var n int64
+		database.DB.Unscoped().Model(model).Where(query, args...).Count(&n)
+		return n
+	}
+	assert.Zero(t, count(&models.User{}, "id = ?", alice.ID))
+	assert.Equal(t, int64(1), count(&models.User{}, "id = ?", bob.ID))
+	assert.Zero(t, count(&models.ToDo{}, "id IN ?", []uint{todo.ID, soloToDo.ID}))
+	assert.Equal(t, int64(1), count(&models.ToDo{}, "id = ?", teamToDo.ID))
+	assert.Zero(t, count(&models.Project{}, "id = ?", project.ID))
+	assert.Zero(t, count(&models.Tag{}, "user_id = ?", alice.ID))
+	assert.Zero(t, count(&models.Share{}, "owner_id = ?", alice.ID))
+	assert.Zero(t, count(&models.Workspace{}, "id = ?", solo.ID))
+	assert.Zero(t, count(&models.WorkspaceMember{}, "workspace_id = ? OR user_id = ?", solo.ID, alice.ID))
+	assert.Equal(t, int64(1), count(&models.AuditLog{}, "action = ? AND user_id = ?", models.AuditAccountDeleted, alice.ID))
+
+	role, err := WorkspaceRoleOf(bob.ID, shared.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, role)
+}
+
+func TestPurgeSkipsCancelledDeletion(t *testing.T) {
+	setupTestDB()
+	router := setupLoginRouter()
+	hash, _ := hashPassword("s3cret-passphrase")
+	past := time.Now().Add(-time.Minute)
+	alice := models.User{Username: "alice", Password: hash, DeletionScheduledAt: &past}
+	database.DB.Create(&alice)
+
+	// Очистка уже выбрала alice, но пользователь успел войти и отменить удаление
+	var ids []uint
+	database.DB.Model(&models.User{}).Where("deletion_scheduled_at <= ?", time.Now()).Pluck("id", &ids)
+	assert.Equal(t, []uint{alice.ID}, ids)
+	code, _ := login(router, "alice", "s3cret-passphrase")
+	assert.Equal(t, http.StatusOK, code)
+
+	purged, err := purgeAccount(database.DB, alice.ID, time.Now())
+	assert.NoError(t, err)
+	assert.False(t, purged)
+	total, err := PurgeDeletedAccounts(database.DB, time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, total)
+
+	var user models.User
+	assert.NoError(t, database.DB.First(&user, alice.ID).Error)
+	assert.Nil(t, user.DeletionScheduledAt)
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUsersLimit = 50
+	maxUsersLimit     = 200
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// UserInfo — пользователь в ответах администрирования, без хеша пароля
+type UserInfo struct {
+	ID         uint            `json:"id"`
+	Username   string          `json:"username"`
+	Email      *string         `json:"email"`
+	Role       models.UserRole `json:"role"`
+	CreatedAt  time.Time       `json:"created_at"`
+	DisabledAt *time.Time      `json:"disabled_at"`
+}
+
+func userInfo(user models.User) UserInfo {
+	return UserInfo{
+		ID:         user.ID,
+		Username:   user.Username,
+		Email:      user.Email,
+		Role:       user.Role,
+		CreatedAt:  user.CreatedAt,
+		DisabledAt: user.DisabledAt,
+	}
+}
+
+// RoleInput — новая роль пользователя
+type RoleInput struct {
+	Role *models.UserRole `json:"role" binding:"required"`
+}
+
+// Stats — сводка по системе для администратора
+type Stats struct {
+	Users          int64 `json:"users"`
+	DisabledUsers  int64 `json:"disabled_users"`
+	ActiveSessions int64 `json:"active_sessions"`
+	ToDos          int64 `json:"todos"`
+	CompletedToDos int64 `json:"completed_todos"`
+	DeletedToDos   int64 `json:"deleted_todos"`
+	Projects       int64 `json:"projects"`
+	Workspaces     int64 `json:"workspaces"`
+}
+
+// GrantRole назначает роль пользователю username. Так при запуске появляется первый администратор.
+func GrantRole(username string, role models.UserRole) error {
+	result := database.DB.Model(&models.User{}).Where("username = ?", username).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// findUser загружает пользователя из параметра :id и отвечает клиенту, если его нет
+func findUser(c *gin.Context, user *models.User) bool {
+	if err := database.DB.First(user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return false
+	}
+	return true
+}
+
+// GetUsers godoc
+// @Summary List users
+// @Description List users for administration. Needs the users:list permission.
+// @Tags admin
+// @Produce  json
+// @Param   q         query    string  false  "Substring of the username"
+// @Param   role      query    string  false  "Role: user, support or admin"
+// @Param   disabled  query    bool    false  "Only disabled or only enabled users"
+// @Param   limit     query    int     false  "Page size, 50 by default, at most 200"
+// @Param   offset    query    int     false  "Number of users to skip"
+// @Success 200 {array} UserInfo
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Router /admin/users [get]
+func GetUsers(c *gin.Context) {
+	limit, offset, err := limitOffset(c, defaultUsersLimit, maxUsersLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Model(&models.User{})
+	if q := c.Query("q"); q != "" {
+		query = query.Where(`LOWER(username) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(q))+"%")
+	}
+	if s := c.Query("role"); s != "" {
+		role, err := models.ParseUserRole(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("role = ?", role)
+	}
+	if s := c.Query("disabled"); s != "" {
+		disabled, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "disabled must be true or false"})
+			return
+		}
+		if disabled {
+			query = query.Where("disabled_at IS NOT NULL")
+		} else {
+			query = query.Where("disabled_at IS NULL")
+		}
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить пользователей"})
+		return
+	}
+	var users []models.User
+	if err := query.Order("id").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить пользователей"})
+		return
+	}
+
+	result := make([]UserInfo, len(users))
+	for i, user := range users {
+		result[i] = userInfo(user)
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, result)
+}
+
+// DisableUser godoc
+// @Summary Disable a user
+// @Description Disable an account and revoke all its sessions. Needs the users:disable permission.
+// @Tags admin
+// @Produce  json
+// @Param   id  path     int  true  "User ID"
+// @Success 200 {object} UserInfo
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /admin/users/{id}/disable [post]
+func DisableUser(c *gin.Context) {
+	var user models.User
+	if !findUser(c, &user) {
+		return
+	}
+	if user.ID == currentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot disable yourself"})
+		return
+	}
+	if user.DisabledAt == nil {
+		now := time.Now()
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Update("disabled_at", &now).Error; err != nil {
+				return err
+			}
+			return revokeSessions(tx, "user_id = ?", user.ID)
+		})
+		if err != nil {
+			log.Println("Error while disabling user:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отключить пользователя"})
+			return
+		}
+		user.DisabledAt = &now
+	}
+	c.JSON(http.StatusOK, userInfo(user))
+}
+
+// EnableUser godoc
+// @Summary Enable a user
+// @Description Enable a disabled account. Needs the users:disable permission.
+// @Tags admin
+// @Produce  json
+// @Param   id  path     int  true  "User ID"
+// @Success 200 {object} UserInfo
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /admin/users/{id}/enable [post]
+func EnableUser(c *gin.Context) {
+	var user models.User
+	if !findUser(c, &user) {
+		return
+	}
+	if err := database.DB.Model(&user).Update("disabled_at", nil).Error; err != nil {
+		log.Println("Error while enabling user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось включить пользователя"})
+		return
+	}
+	user.DisabledAt = nil
+	c.JSON(http.StatusOK, userInfo(user))
+}
+
+// SetUserRole godoc
+// @Summary Change a user's role
+// @Description Change the role of a user. Needs the users:roles permission. Administrators cannot change their own role.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param   id    path     int        true  "User ID"
+// @Param   role  body     RoleInput  true  "Role"
+// @Success 200 {object} UserInfo
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /admin/users/{id}/role [put]
+func SetUserRole(c *gin.Context) {
+	var user models.User
+	if !findUser(c, &user) {
+		return
+	}
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Иначе последний администратор может лишить систему администраторов
+	if user.ID == currentUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot change your own role"})
+		return
+	}
+	if err := database.DB.Model(&user).Update("role", *input.Role).Error; err != nil {
+		log.Println("Error while changing user role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить роль"})
+		return
+	}
+	user.Role = *input.Role
+	c.JSON(http.StatusOK, userInfo(user))
+}
+
+// GetStats godoc
+// @Summary System stats
+// @Description Count users, sessions, ToDo items, projects and workspaces. Needs the stats:view permission.
+// @Tags admin
+// @Produce  json
+// @Success 200 {object} Stats
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /admin/stats [get]
+func GetStats(c *gin.Context) {
+	var stats Stats
+	counts := []struct {
+		query *gorm.DB
+		dest  *int64
+	}{
+		{database.DB.Model(&models.User{}), &stats.Users},
+		{database.DB.Model(&models.User{}).Where("disabled_at IS NOT NULL"), &stats.DisabledUsers},
+		{database.DB.Model(&models.Session{}).Where("revoked_at IS NULL"), &stats.ActiveSessions},
+		{database.DB.Model(&models.ToDo{}), &stats.ToDos},
+		{database.DB.Model(&models.ToDo{}).Where("completed = ?", true), &stats.CompletedToDos},
+		{database.DB.Model(&models.ToDo{}).Unscoped().Where("deleted_at IS NOT NULL"), &stats.DeletedToDos},
+		{database.DB.Model(&models.Project{}), &stats.Projects},
+		{database.DB.Model(&models.Workspace{}), &stats.Workspaces},
+	}
+	for _, count := range counts {
+		if err := count.query.Count(count.dest).Error; err != nil {
+			log.Println("Error while counting stats:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить статистику"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetAuditLog godoc
+// @Summary Audit log
+// @Description List security events, newest first, such as login lockouts. Needs the audit:view permission.
+// @Tags admin
+// @Produce  json
+// @Param   action  query    string  false  "Event type, for example login.lockout"
+// @Param   limit   query    int     false  "Page size, 50 by default, at most 200"
+// @Param   offset  query    int     false  "Number of events to skip"
+// @Success 200 {array} models.AuditLog
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Router /admin/audit [get]
+func GetAuditLog(c *gin.Context) {
+	limit, offset, err := limitOffset(c, defaultAuditLimit, maxAuditLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Model(&models.AuditLog{})
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить журнал"})
+		return
+	}
+	events := []models.AuditLog{}
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить журнал"})
+		return
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, events)
+}
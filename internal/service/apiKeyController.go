@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyPrefix отличает API ключи от JWT в заголовке Authorization
+const APIKeyPrefix = "tdk_"
+
+// apiKeyPrefixLen — сколько первых символов ключа хранится открыто, чтобы ключ можно было узнать
+const apiKeyPrefixLen = len(APIKeyPrefix) + 8
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyInput — новый API ключ
+type APIKeyInput struct {
+	Name      string            `json:"name" binding:"required"`
+	Scopes    []models.APIScope `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time        `json:"expires_at"`
+}
+
+// CreatedAPIKey — созданный ключ. Сам ключ возвращается только в этом ответе.
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// validateScopes проверяет, что scope известны и не повторяются
+func validateScopes(scopes []models.APIScope) error {
+	seen := map[models.APIScope]bool{}
+	for _, scope := range scopes {
+		known := false
+		for _, s := range models.APIScopes {
+			known = known || s == scope
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+		if seen[scope] {
+			return fmt.Errorf("duplicate scope %q", scope)
+		}
+		seen[scope] = true
+	}
+	return nil
+}
+
+// AuthenticateAPIKey находит действующий ключ и его владельца и отмечает время использования ключа
+func AuthenticateAPIKey(key string) (models.User, models.APIKey, error) {
+	var apiKey models.APIKey
+	if err := database.DB.Where("key_hash = ? AND revoked_at IS NULL", hashToken(key)).First(&apiKey).Error; err != nil {
+		return models.User{}, apiKey, errInvalidAPIKey
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return models.User{}, apiKey, errInvalidAPIKey
+	}
+	var user models.User
+	if err := database.DB.Where("disabled_at IS NULL AND deletion_scheduled_at IS NULL").First(&user, apiKey.UserID).Error; err != nil {
+		return user, apiKey, errInvalidAPIKey
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&apiKey).UpdateColumn("last_used_at", &now).Error; err != nil {
+		log.Println("Error while updating API key usage:", err)
+	}
+	return user, apiKey, nil
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create a personal API key with scopes todos:read and todos:write and an optional expiry. The key is shown only once. Send it as "Authorization: Bearer <key>".
+// @Tags api-keys
+// @Accept  json
+// @Produce  json
+// @Param   key  body     APIKeyInput  true  "API key"
+// @Success 200 {object} CreatedAPIKey
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /api-keys [post]
+func CreateAPIKey(c *gin.Context) {
+	var input APIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateScopes(input.Scopes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	secret, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать ключ"})
+		return
+	}
+	key := APIKeyPrefix + secret
+	apiKey := models.APIKey{
+		UserID:    currentUserID(c),
+		Name:      input.Name,
+		Prefix:    key[:apiKeyPrefixLen],
+		KeyHash:   hashToken(key),
+		Scopes:    input.Scopes,
+		ExpiresAt: input.ExpiresAt,
+	}
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		log.Println("Error while creating API key:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать ключ"})
+		return
+	}
+	c.JSON(http.StatusOK, CreatedAPIKey{APIKey: apiKey, Key: key})
+}
+
+// GetAPIKeys godoc
+// @Summary List API keys
+// @Description List API keys of the current user, including revoked ones. The keys themselves are not returned.
+// @Tags api-keys
+// @Produce  json
+// @Success 200 {array} models.APIKey
+// @Failure 500 {object} gin.H
+// @Router /api-keys [get]
+func GetAPIKeys(c *gin.Context) {
+	keys := []models.APIKey{}
+	if err := database.DB.Where("user_id = ?", currentUserID(c)).Order("id").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить ключи"})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Tags api-keys
+// @Produce  json
+// @Param   id  path     int  true  "API key ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /api-keys/{id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	result := database.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), currentUserID(c)).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Println("Error while revoking API key:", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отозвать ключ"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ключ не найден"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Ключ отозван"})
+}
@@ -3,46 +3,79 @@ package service
 import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
-	"time"
 	"todo-app/internal/database"
 	"todo-app/internal/models"
 )
 
-var JwtSecret = []byte("секретный_ключ")
-
 type Claims struct {
-	Username string `json:"username"`
+	Username  string          `json:"username"`
+	SessionID uint            `json:"sid"`
+	Role      models.UserRole `json:"role"`
 	jwt.StandardClaims
 }
 
+// RegisterInput — данные нового пользователя
+type RegisterInput struct {
+	Username string  `json:"username" binding:"required"`
+	Password string  `json:"password" binding:"required"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+}
+
+// LoginInput — имя пользователя и пароль
+type LoginInput struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with a username and password
+// @Description Register a new user with a username, a password and an optional email. A link for verifying the email is sent to it. The password must be at least 8 characters long, must not contain the username and must not be a known breached password.
 // @Tags auth
 // @Accept  json
 // @Produce  json
-// @Param   user  body     models.User  true  "User data"
+// @Param   user  body     RegisterInput  true  "User data"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} gin.H
+// @Failure 409 {object} gin.H
 // @Failure 500 {object} gin.H
 // @Router /register [post]
 func Register(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var input RegisterInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Роль, отключение и подтверждение адреса не задаются при регистрации:
+	// их меняет администратор или ссылка из письма
+	user := models.User{Username: input.Username, Password: input.Password, Email: input.Email}
+	if user.Email != nil {
+		email := normalizeEmail(*user.Email)
+		user.Email = &email
+		if taken, err := emailTaken(email, 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Can not create user"})
+			return
+		} else if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
+	}
+
+	if err := validatePassword(user.Username, user.Password); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Хеширование пароля
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(user.Password)
 	if err != nil {
+		log.Println("Error while hashing password:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Can not hash password"})
+		return
 	}
 
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 
 	// Сохранение нового пользователя в БД
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -50,56 +83,91 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Can not create user"})
 		return
 	}
+	if user.Email != nil {
+		sendVerificationEmail(user)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User successfully created"})
 }
 
 // Login godoc
 // @Summary Log in a user
-// @Description Log in a user and receive a JWT token
+// @Description Log in a user and receive a short-lived JWT access token and a refresh token. With two-factor login turned on the response is {"mfa_required": true, "mfa_token": ...} instead; finish the login with POST /login/mfa. Repeated failures lock the username or the client IP for a while with 429 and Retry-After.
 // @Tags auth
 // @Accept  json
 // @Produce  json
-// @Param   user  body     models.User  true  "User credentials"
+// @Param   user  body     LoginInput  true  "User credentials"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} gin.H
 // @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 429 {object} gin.H
 // @Failure 500 {object} gin.H
 // @Router /login [post]
 func Login(c *gin.Context) {
 	var user models.User
-	var input models.User
+	var input LoginInput
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Пока вход заблокирован после неудачных попыток, пароль не проверяется
+	if !checkLoginLock(c, input.Username) {
+		return
+	}
+
 	// Проверка существования пользователя
 	if err := database.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверное имя пользователя или пароль"})
+		loginFailed(c, input.Username, nil, "Неверное имя пользователя или пароль")
 		return
 	}
 
 	// Проверка пароля
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверное имя пользователя или пароль"})
+	ok, rehash := checkPassword(user.Password, input.Password)
+	if !ok {
+		loginFailed(c, input.Username, &user.ID, "Неверное имя пользователя или пароль")
+		return
 	}
-
-	// Создание JWT токена
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Username: input.Username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	// Хеш со старыми параметрами пересчитывается, пока известен пароль
+	if rehash {
+		if hash, err := hashPassword(input.Password); err != nil {
+			log.Println("Error while rehashing password:", err)
+		} else if err := database.DB.Model(&user).Update("password", hash).Error; err != nil {
+			log.Println("Error while rehashing password:", err)
+		}
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(JwtSecret)
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Учётная запись отключена"})
+		return
+	}
+
+	response, mfa, err := loginResponse(c, user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать JWT токен"})
+		log.Println("Error while logging in:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось войти"})
 		return
 	}
+	// Счётчик неудач сбрасывается только после полного входа, второй шаг ещё впереди
+	if !mfa {
+		clearLoginFailures(user.Username)
+	}
+	c.JSON(http.StatusOK, response)
+}
 
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+// loginResponse завершает вход после проверки пароля или входа через SSO: создаёт сессию с access
+// и refresh токенами, а с включённой 2FA вместо них выдаёт токен для второго шага входа
+func loginResponse(c *gin.Context, user models.User) (response gin.H, mfa bool, err error) {
+	if _, enabled, err := userTOTP(database.DB, user.ID); err != nil {
+		return nil, false, err
+	} else if enabled {
+		token, err := beginMFAChallenge(user.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		return gin.H{"mfa_required": true, "mfa_token": token}, true, nil
+	}
+	tokens, err := startSession(c, user)
+	return tokens, false, err
 }
@@ -42,9 +42,9 @@ func TestRegister(t *testing.T) {
 	r.POST("/register", Register)
 
 	// Пример данных для запроса
-	user := models.User{
+	user := RegisterInput{
 		Username: "testuser",
-		Password: "password123",
+		Password: "correct horse battery",
 	}
 	jsonValue, _ := json.Marshal(user)
 
@@ -86,7 +86,7 @@ func TestLogin(t *testing.T) {
 	r.POST("/login", Login)
 
 	// Пример данных для запроса
-	loginPayload := models.User{
+	loginPayload := LoginInput{
 		Username: "testuser",
 		Password: "password123",
 	}
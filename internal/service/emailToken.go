@@ -0,0 +1,130 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+	"todo-app/internal/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Назначение токена из письма, передаётся в aud. Access токены aud не имеют.
+const (
+	purposeVerifyEmail   = "verify_email"
+	purposeResetPassword = "reset_password"
+)
+
+var (
+	EmailVerificationTTL = 24 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+var errInvalidEmailToken = errors.New("invalid or expired token")
+
+// emailClaims — токен из письма. Подписан теми же ключами, что и access токены.
+type emailClaims struct {
+	// Email — адрес, который подтверждает токен. После смены адреса старые ссылки не действуют.
+	Email string `json:"email,omitempty"`
+	// Password — отпечаток хеша пароля. После смены пароля ссылка для сброса не действует.
+	Password string `json:"pwd,omitempty"`
+	jwt.StandardClaims
+}
+
+func passwordFingerprint(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:8])
+}
+
+// newEmailToken выдаёт пользователю одноразовый токен с назначением purpose
+func newEmailToken(purpose string, user models.User, ttl time.Duration) (string, error) {
+	jti, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	claims := emailClaims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  purpose,
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Id:        jti,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+	switch purpose {
+	case purposeVerifyEmail:
+		if user.Email == nil {
+			return "", errors.New("user has no email")
+		}
+		claims.Email = *user.Email
+	case purposeResetPassword:
+		claims.Password = passwordFingerprint(user.Password)
+	}
+	return Keys.Sign(claims)
+}
+
+// parseEmailToken проверяет подпись, назначение и срок токена и находит его пользователя
+func parseEmailToken(tx *gorm.DB, token, purpose string) (models.User, emailClaims, error) {
+	var user models.User
+	var claims emailClaims
+	parsed, err := jwt.ParseWithClaims(token, &claims, Keys.Keyfunc)
+	if err != nil || !parsed.Valid || !claims.VerifyAudience(purpose, true) || claims.Id == "" || claims.ExpiresAt == 0 {
+		return user, claims, errInvalidEmailToken
+	}
+	if err := tx.Where("disabled_at IS NULL").First(&user, claims.Subject).Error; err != nil {
+		return user, claims, errInvalidEmailToken
+	}
+	switch purpose {
+	case purposeVerifyEmail:
+		if user.Email == nil || *user.Email != claims.Email {
+			return user, claims, errInvalidEmailToken
+		}
+	case purposeResetPassword:
+		if claims.Password != passwordFingerprint(user.Password) {
+			return user, claims, errInvalidEmailToken
+		}
+	}
+	return user, claims, nil
+}
+
+// checkEmailToken проверяет токен, не отмечая его использованным
+func checkEmailToken(tx *gorm.DB, token, purpose string) (models.User, error) {
+	user, claims, err := parseEmailToken(tx, token, purpose)
+	if err != nil {
+		return user, err
+	}
+	var used int64
+	if err := tx.Model(&models.UsedToken{}).Where("jti = ?", claims.Id).Count(&used).Error; err != nil {
+		return user, err
+	}
+	if used > 0 {
+		return user, errInvalidEmailToken
+	}
+	return user, nil
+}
+
+// useEmailToken проверяет токен, находит его пользователя и отмечает токен использованным
+func useEmailToken(tx *gorm.DB, token, purpose string) (models.User, error) {
+	user, claims, err := parseEmailToken(tx, token, purpose)
+	if err != nil {
+		return user, err
+	}
+
+	// Запись с jti вставит только первый из запросов с этим токеном
+	if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.UsedToken{}).Error; err != nil {
+		return user, err
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UsedToken{JTI: claims.Id, ExpiresAt: time.Unix(claims.ExpiresAt, 0)})
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, errInvalidEmailToken
+	}
+	return user, nil
+}
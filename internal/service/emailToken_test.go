@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailToken(t *testing.T) {
+	user := setupTestDB()
+	email := "user@example.com"
+	database.DB.Model(&user).Update("email", email)
+	user.Email = &email
+
+	verify, err := newEmailToken(purposeVerifyEmail, user, time.Hour)
+	assert.NoError(t, err)
+	reset, err := newEmailToken(purposeResetPassword, user, time.Hour)
+	assert.NoError(t, err)
+
+	// Токен подходит только для своего назначения
+	_, err = useEmailToken(database.DB, verify, purposeResetPassword)
+	assert.ErrorIs(t, err, errInvalidEmailToken)
+	found, err := useEmailToken(database.DB, verify, purposeVerifyEmail)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+	_, err = useEmailToken(database.DB, verify, purposeVerifyEmail)
+	assert.ErrorIs(t, err, errInvalidEmailToken)
+
+	// Ссылка для сброса перестаёт действовать после смены пароля
+	database.DB.Model(&user).Update("password", "changed")
+	_, err = useEmailToken(database.DB, reset, purposeResetPassword)
+	assert.ErrorIs(t, err, errInvalidEmailToken)
+
+	expired, _ := newEmailToken(purposeVerifyEmail, user, -time.Minute)
+	_, err = useEmailToken(database.DB, expired, purposeVerifyEmail)
+	assert.ErrorIs(t, err, errInvalidEmailToken)
+
+	// Ссылка для старого адреса не подтверждает новый
+	old, _ := newEmailToken(purposeVerifyEmail, user, time.Hour)
+	database.DB.Model(&user).Update("email", "new@example.com")
+	_, err = useEmailToken(database.DB, old, purposeVerifyEmail)
+	assert.ErrorIs(t, err, errInvalidEmailToken)
+
+	var used int64
+	database.DB.Model(&models.UsedToken{}).Count(&used)
+	assert.Equal(t, int64(1), used)
+}
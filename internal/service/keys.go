@@ -0,0 +1,371 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// SigningKey — ключ, которым подписываются или проверяются JWT.
+// У ключей только для проверки (публичных) signKey равен nil.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet хранит активный ключ подписи и все ключи, которые ещё принимаются при проверке,
+// поэтому ключи можно менять, не разлогинивая пользователей.
+type KeySet struct {
+	active string
+	keys   map[string]*SigningKey
+}
+
+// Keys используется для выпуска и проверки всех токенов приложения.
+// До вызова LoadSigningKeys это случайный HS256 ключ, живущий до перезапуска.
+var Keys = newEphemeralKeySet()
+
+func newEphemeralKeySet() *KeySet {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	ks := &KeySet{keys: map[string]*SigningKey{}}
+	ks.add(newHMACKey("ephemeral", secret))
+	ks.active = "ephemeral"
+	return ks
+}
+
+func newHMACKey(kid string, secret []byte) *SigningKey {
+	return &SigningKey{ID: kid, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+func (ks *KeySet) add(key *SigningKey) {
+	ks.keys[key.ID] = key
+}
+
+// Sign подписывает claims активным ключом и проставляет заголовок kid
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := ks.keys[ks.active]
+	if key == nil || key.signKey == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// Keyfunc выбирает ключ проверки по kid и не допускает подмены алгоритма
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key := ks.keys[kid]
+	if key == nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// LoadSigningKeys загружает ключи из окружения:
+//
+//	JWT_SECRET      — секрет для HS256, его kid задаётся JWT_SECRET_KID (по умолчанию "default")
+//	JWT_KEYS_DIR    — каталог с ключами: <kid>.pem (приватный или публичный RSA/EC ключ) и <kid>.secret (HS256)
+//	JWT_ACTIVE_KID  — ключ, которым подписываются новые токены
+//
+// Если ничего не задано, остаётся случайный ключ, и токены перестают действовать после перезапуска.
+func LoadSigningKeys() error {
+	ks, err := loadKeySet(os.Getenv("JWT_SECRET"), os.Getenv("JWT_SECRET_KID"), os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		return err
+	}
+	if ks == nil {
+		log.Println("JWT signing keys are not configured, using a random key until restart")
+		return nil
+	}
+	Keys = ks
+	return nil
+}
+
+func loadKeySet(secret, secretKid, dir, activeKid string) (*KeySet, error) {
+	if secret == "" && dir == "" {
+		return nil, nil
+	}
+
+	ks := &KeySet{keys: map[string]*SigningKey{}}
+	if secret != "" {
+		if secretKid == "" {
+			secretKid = "default"
+		}
+		ks.add(newHMACKey(secretKid, []byte(secret)))
+	}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("read keys dir: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			key, err := loadKeyFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			if key == nil {
+				continue
+			}
+			if _, exists := ks.keys[key.ID]; exists {
+				return nil, fmt.Errorf("duplicate key id %q", key.ID)
+			}
+			ks.add(key)
+		}
+	}
+
+	if activeKid == "" {
+		activeKid = defaultActiveKid(ks)
+		if activeKid == "" {
+			return nil, errors.New("several signing keys found, set JWT_ACTIVE_KID")
+		}
+	}
+	active, ok := ks.keys[activeKid]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found", activeKid)
+	}
+	if active.signKey == nil {
+		return nil, fmt.Errorf("active key %q has no private part", activeKid)
+	}
+	ks.active = activeKid
+	return ks, nil
+}
+
+// defaultActiveKid возвращает единственный ключ с приватной частью, если он один
+func defaultActiveKid(ks *KeySet) string {
+	var candidates []string
+	for kid, key := range ks.keys {
+		if key.signKey != nil {
+			candidates = append(candidates, kid)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	return ""
+}
+
+func loadKeyFile(path string) (*SigningKey, error) {
+	ext := filepath.Ext(path)
+	kid := strings.TrimSuffix(filepath.Base(path), ext)
+
+	switch ext {
+	case ".secret":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		secret := strings.TrimSpace(string(data))
+		if secret == "" {
+			return nil, fmt.Errorf("key %q: empty secret", kid)
+		}
+		return newHMACKey(kid, []byte(secret)), nil
+	case ".pem":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parsePEMKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		return key, nil
+	default:
+		return nil, nil
+	}
+}
+
+func parsePEMKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, signKey: k, verifyKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{ID: kid, Method: jwt.SigningMethodRS256, verifyKey: k}, nil
+	case *ecdsa.PrivateKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{ID: kid, Method: method, signKey: k, verifyKey: &k.PublicKey}, nil
+	case *ecdsa.PublicKey:
+		method, err := ecdsaMethod(k.Curve)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{ID: kid, Method: method, verifyKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+func ecdsaMethod(curve elliptic.Curve) (jwt.SigningMethod, error) {
+	switch curve {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	default:
+		return nil, errors.New("unsupported elliptic curve")
+	}
+}
+
+// JSONWebKey — публичный ключ в формате RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// VerifyKey восстанавливает из JWK ключ проверки подписи и его алгоритм
+func (jwk JSONWebKey) VerifyKey() (interface{}, jwt.SigningMethod, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		method := jwt.GetSigningMethod(jwk.Alg)
+		if jwk.Alg == "" {
+			method = jwt.SigningMethodRS256
+		}
+		if _, ok := method.(*jwt.SigningMethodRSA); !ok {
+			return nil, nil, fmt.Errorf("key %q: unsupported algorithm %q for RSA", jwk.Kid, jwk.Alg)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, method, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil, fmt.Errorf("key %q: unsupported curve %q", jwk.Kid, jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+		}
+		method, err := ecdsaMethod(curve)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, method, nil
+	}
+	return nil, nil, fmt.Errorf("key %q: unsupported key type %q", jwk.Kid, jwk.Kty)
+}
+
+// PublicKeys возвращает асимметричные ключи проверки. HS256 секреты не публикуются.
+func (ks *KeySet) PublicKeys() []JSONWebKey {
+	jwks := []JSONWebKey{}
+	for _, key := range ks.keys {
+		jwk := JSONWebKey{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		default:
+			continue
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys that verify tokens issued by this application
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/jwks.json [get]
+func JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": Keys.PublicKeys()})
+}
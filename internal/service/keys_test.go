@@ -0,0 +1,178 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRSAKey(t *testing.T, dir, kid string) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writeECKey(t *testing.T, dir, kid string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testClaims() *Claims {
+	return &Claims{
+		Username:       "testuser",
+		StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()},
+	}
+}
+
+func TestKeySetSignsWithActiveKid(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "rsa-1")
+	writeECKey(t, dir, "ec-1")
+
+	for kid, alg := range map[string]string{"rsa-1": "RS256", "ec-1": "ES256"} {
+		ks, err := loadKeySet("", "", dir, kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokenString, err := ks.Sign(testClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		claims := &Claims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, ks.Keyfunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, token.Valid)
+		assert.Equal(t, kid, token.Header["kid"])
+		assert.Equal(t, alg, token.Method.Alg())
+		assert.Equal(t, "testuser", claims.Username)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "old")
+
+	oldKeys, err := loadKeySet("", "", dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := oldKeys.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Добавляем новый ключ и делаем его активным, старый остаётся для проверки
+	writeECKey(t, dir, "new")
+	newKeys, err := loadKeySet("", "", dir, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jwt.ParseWithClaims(oldToken, &Claims{}, newKeys.Keyfunc)
+	assert.NoError(t, err)
+
+	newToken, err := newKeys.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jwt.ParseWithClaims(newToken, &Claims{}, oldKeys.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestKeySetRejectsAlgorithmMismatch(t *testing.T) {
+	ks, err := loadKeySet("secret", "hs", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Токен, подписанный другим алгоритмом под тем же kid, не принимается
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, testClaims())
+	token.Header["kid"] = "hs"
+	tokenString, _ := token.SignedString([]byte("secret"))
+
+	_, err = jwt.ParseWithClaims(tokenString, &Claims{}, ks.Keyfunc)
+	assert.Error(t, err)
+
+	// Как и токен без kid
+	token = jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	tokenString, _ = token.SignedString([]byte("secret"))
+	_, err = jwt.ParseWithClaims(tokenString, &Claims{}, ks.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	ks, err := loadKeySet("", "", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, ks)
+
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "a")
+	writeRSAKey(t, dir, "b")
+	_, err = loadKeySet("", "", dir, "")
+	assert.Error(t, err)
+
+	_, err = loadKeySet("", "", dir, "missing")
+	assert.Error(t, err)
+
+	// Публичный ключ не может быть активным
+	pubDir := t.TempDir()
+	key := writeRSAKey(t, t.TempDir(), "tmp")
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	os.WriteFile(filepath.Join(pubDir, "pub.pem"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+	_, err = loadKeySet("", "", pubDir, "pub")
+	assert.Error(t, err)
+}
+
+func TestPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "rsa-1")
+	writeECKey(t, dir, "ec-1")
+
+	ks, err := loadKeySet("secret", "hs", dir, "rsa-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := ks.PublicKeys()
+	if !assert.Len(t, jwks, 2) { // HS256 секрет не публикуется
+		t.FailNow()
+	}
+	assert.Equal(t, "ec-1", jwks[0].Kid)
+	assert.Equal(t, "EC", jwks[0].Kty)
+	assert.Equal(t, "P-256", jwks[0].Crv)
+	assert.Len(t, jwks[0].X, 43)
+	assert.Equal(t, "rsa-1", jwks[1].Kid)
+	assert.Equal(t, "RSA", jwks[1].Kty)
+	assert.Equal(t, "AQAB", jwks[1].E)
+}
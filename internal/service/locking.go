@@ -0,0 +1,15 @@
+package service
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// forUpdate блокирует выбранные строки до конца транзакции. SQLite такой блокировки не знает,
+// но и не пускает в базу двух писателей сразу, поэтому там она не нужна.
+func forUpdate(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() == "postgres" {
+		return db.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return db
+}
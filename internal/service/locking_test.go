@@ -0,0 +1,49 @@
+package service
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestForUpdate(t *testing.T) {
+	setupTestDB()
+	lockedAdmins := func(db *gorm.DB) string {
+		return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			var ids []uint
+			return tx.Model(&models.WorkspaceMember{}).Scopes(forUpdate).Where("role = ?", models.RoleAdmin).Pluck("id", &ids)
+		})
+	}
+
+	// На Postgres строки блокируются, SQLite FOR UPDATE не поддерживает
+	pg, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, lockedAdmins(pg), "FOR UPDATE")
+	assert.NotContains(t, lockedAdmins(database.DB), "FOR UPDATE")
+}
+
+func TestLockAdminsOrder(t *testing.T) {
+	var sql bytes.Buffer
+	pg, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+		Logger:               logger.New(log.New(&sql, "", 0), logger.Config{LogLevel: logger.Info}),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Одновременные понижения блокируют администраторов в одном порядке и не ждут друг друга по кругу
+	_, err = lockAdmins(pg, 1)
+	assert.NoError(t, err)
+	assert.Regexp(t, `ORDER BY id FOR UPDATE`, sql.String())
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginLimitConfig — пороги защиты входа от перебора паролей
+type LoginLimitConfig struct {
+	MaxFailures      int           // неудачных попыток для имени пользователя до блокировки, 0 выключает проверку
+	MaxFailuresPerIP int           // то же для IP адреса
+	Window           time.Duration // после такой паузы без ошибок счёт начинается заново
+	Lockout          time.Duration // длина первой блокировки, каждая следующая подряд вдвое длиннее
+	MaxLockout       time.Duration // дольше блокировка не бывает
+}
+
+var LoginLimits = LoginLimitConfig{
+	MaxFailures:      5,
+	MaxFailuresPerIP: 20,
+	Window:           15 * time.Minute,
+	Lockout:          time.Minute,
+	MaxLockout:       time.Hour,
+}
+
+type loginKey struct {
+	key   string
+	limit int
+}
+
+func loginKeys(username, ip string) []loginKey {
+	return []loginKey{
+		{"user:" + username, LoginLimits.MaxFailures},
+		{"ip:" + ip, LoginLimits.MaxFailuresPerIP},
+	}
+}
+
+// lockoutDuration — длина блокировки с номером lockouts, начиная с нуля
+func lockoutDuration(lockouts int) time.Duration {
+	d := LoginLimits.Lockout
+	for i := 0; i < lockouts && d < LoginLimits.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > LoginLimits.MaxLockout {
+		d = LoginLimits.MaxLockout
+	}
+	return d
+}
+
+// loginLockedUntil возвращает, до какого времени вход заблокирован для имени пользователя или IP.
+// Нулевое время — вход не заблокирован.
+func loginLockedUntil(username, ip string) (time.Time, error) {
+	keys := make([]string, 0, 2)
+	for _, k := range loginKeys(username, ip) {
+		keys = append(keys, k.key)
+	}
+	var counters []models.LoginCounter
+	if err := database.DB.Where("key IN ? AND locked_until > ?", keys, time.Now()).Find(&counters).Error; err != nil {
+		return time.Time{}, err
+	}
+	var until time.Time
+	for _, counter := range counters {
+		if counter.LockedUntil.After(until) {
+			until = *counter.LockedUntil
+		}
+	}
+	return until, nil
+}
+
+// registerLoginFailure учитывает неудачную попытку входа и блокирует ключ, достигший порога.
+// Счётчики меняются одним UPDATE, поэтому одновременные попытки на разных экземплярах не теряются.
+// Возвращает время окончания блокировки, если она началась.
+func registerLoginFailure(username, ip string, userID *uint) (time.Time, error) {
+	var lockedUntil time.Time
+	for _, k := range loginKeys(username, ip) {
+		if k.limit <= 0 {
+			continue
+		}
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			stale := now.Add(-LoginLimits.Window)
+			counter := models.LoginCounter{Key: k.key, LastFailureAt: now}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+				return err
+			}
+			// Давние ошибки забываются, а цепочка блокировок прерывается, если с конца последней прошло окно
+			err := tx.Model(&models.LoginCounter{}).Where("key = ?", k.key).Updates(map[string]interface{}{
+				"failures":        gorm.Expr("CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END", stale),
+				"lockouts":        gorm.Expr("CASE WHEN last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?) THEN 0 ELSE lockouts END", stale, stale),
+				"last_failure_at": now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("key = ?", k.key).First(&counter).Error; err != nil {
+				return err
+			}
+			if counter.Failures < k.limit {
+				return nil
+			}
+
+			lockout := lockoutDuration(counter.Lockouts)
+			until := now.Add(lockout)
+			// Блокировку ставит только один из одновременных запросов
+			result := tx.Model(&models.LoginCounter{}).Where("key = ? AND failures >= ?", k.key, k.limit).Updates(map[string]interface{}{
+				"failures":     0,
+				"lockouts":     gorm.Expr("lockouts + 1"),
+				"locked_until": until,
+			})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			if until.After(lockedUntil) {
+				lockedUntil = until
+			}
+			return tx.Create(&models.AuditLog{
+				Action:   models.AuditLoginLockout,
+				UserID:   userID,
+				Username: username,
+				IP:       ip,
+				Details:  fmt.Sprintf("%s locked for %s after %d failed attempts", k.key, lockout, counter.Failures),
+			}).Error
+		})
+		if err != nil {
+			return lockedUntil, err
+		}
+	}
+	return lockedUntil, nil
+}
+
+// clearLoginFailures сбрасывает счётчик имени пользователя после успешного входа.
+// Счётчик IP не сбрасывается, иначе перебор можно прерывать входом в свою учётную запись.
+func clearLoginFailures(username string) {
+	if err := database.DB.Where("key = ?", "user:"+username).Delete(&models.LoginCounter{}).Error; err != nil {
+		log.Println("Error while clearing login failures:", err)
+	}
+}
+
+// PurgeLoginCounters удаляет счётчики, которые к now уже ничего не значат: последняя ошибка старше окна,
+// а блокировка кончилась раньше, чем окно началось. Следующая ошибка для такого ключа всё равно начала бы
+// счёт и цепочку блокировок заново. Без очистки таблица растёт от попыток входа под выдуманными именами.
+func PurgeLoginCounters(db *gorm.DB, now time.Time) (int64, error) {
+	stale := now.Add(-LoginLimits.Window)
+	result := db.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", stale, stale).
+		Delete(&models.LoginCounter{})
+	return result.RowsAffected, result.Error
+}
+
+// tooManyLoginAttempts отвечает 429 с заголовком Retry-After до конца блокировки
+func tooManyLoginAttempts(c *gin.Context, until time.Time) {
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Слишком много попыток входа, попробуйте позже"})
+}
+
+// checkLoginLock отвечает 429, если вход для имени пользователя или IP клиента заблокирован
+func checkLoginLock(c *gin.Context, username string) bool {
+	until, err := loginLockedUntil(username, c.ClientIP())
+	if err != nil {
+		log.Println("Error while checking login lockout:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось войти"})
+		return false
+	}
+	if !until.IsZero() {
+		tooManyLoginAttempts(c, until)
+		return false
+	}
+	return true
+}
+
+// loginFailed учитывает неудачную попытку и отвечает 401, или 429, если попытка привела к блокировке
+func loginFailed(c *gin.Context, username string, userID *uint, message string) {
+	until, err := registerLoginFailure(username, c.ClientIP(), userID)
+	if err != nil {
+		log.Println("Error while registering login failure:", err)
+	}
+	if !until.IsZero() {
+		tooManyLoginAttempts(c, until)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func setupLoginRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.Default()
+	r.POST("/login", Login)
+	return r
+}
+
+func login(router *gin.Engine, username, password string) (int, string) {
+	w := doJSON(router, "POST", "/login", `{"username":"`+username+`","password":"`+password+`"}`)
+	return w.Code, w.Header().Get("Retry-After")
+}
+
+// unlock делает вид, что блокировка уже закончилась
+func unlock() {
+	database.DB.Model(&models.LoginCounter{}).Where("locked_until IS NOT NULL").Update("locked_until", time.Now().Add(-time.Second))
+}
+
+func TestLoginLockout(t *testing.T) {
+	setupTestDB()
+	router := setupLoginRouter()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	database.DB.Create(&models.User{Username: "alice", Password: string(hash)})
+	defer func(limits LoginLimitConfig) { LoginLimits = limits }(LoginLimits)
+	LoginLimits = LoginLimitConfig{MaxFailures: 3, MaxFailuresPerIP: 100, Window: time.Hour, Lockout: time.Minute, MaxLockout: 3 * time.Minute}
+
+	for i := 0; i < 2; i++ {
+		code, _ := login(router, "alice", "wrong")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	}
+	// Попытка, достигшая порога, блокирует вход, и верный пароль уже не помогает
+	code, retryAfter := login(router, "alice", "wrong")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "60", retryAfter)
+	code, retryAfter = login(router, "alice", "secret")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	seconds, _ := strconv.Atoi(retryAfter)
+	assert.InDelta(t, 60, seconds, 2)
+
+	var events []models.AuditLog
+	database.DB.Where("action = ?", models.AuditLoginLockout).Find(&events)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "alice", events[0].Username)
+		assert.NotNil(t, events[0].UserID)
+	}
+
+	// Следующая блокировка подряд вдвое длиннее, но не больше MaxLockout
+	unlock()
+	for i := 0; i < 3; i++ {
+		code, retryAfter = login(router, "alice", "wrong")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "120", retryAfter)
+	unlock()
+	for i := 0; i < 3; i++ {
+		code, retryAfter = login(router, "alice", "wrong")
+	}
+	assert.Equal(t, "180", retryAfter)
+
+	// Успешный вход сбрасывает счётчик имени пользователя
+	unlock()
+	code, _ = login(router, "alice", "secret")
+	assert.Equal(t, http.StatusOK, code)
+	var counters int64
+	database.DB.Model(&models.LoginCounter{}).Where("key = ?", "user:alice").Count(&counters)
+	assert.Zero(t, counters)
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	setupTestDB()
+	router := setupLoginRouter()
+	defer func(limits LoginLimitConfig) { LoginLimits = limits }(LoginLimits)
+	LoginLimits = LoginLimitConfig{MaxFailures: 100, MaxFailuresPerIP: 3, Window: time.Hour, Lockout: time.Minute, MaxLockout: time.Hour}
+
+	// Перебор разных имён с одного адреса тоже блокируется, в том числе несуществующих
+	for _, username := range []string{"a", "b", "c"} {
+		login(router, username, "wrong")
+	}
+	code, retryAfter := login(router, "d", "wrong")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.NotEmpty(t, retryAfter)
+
+	var events int64
+	database.DB.Model(&models.AuditLog{}).Where("action = ?", models.AuditLoginLockout).Count(&events)
+	assert.Equal(t, int64(1), events)
+}
+
+func TestLoginFailuresWindow(t *testing.T) {
+	setupTestDB()
+	defer func(limits LoginLimitConfig) { LoginLimits = limits }(LoginLimits)
+	LoginLimits = LoginLimitConfig{MaxFailures: 2, Window: time.Minute, Lockout: time.Minute, MaxLockout: time.Hour}
+
+	_, err := registerLoginFailure("bob", "10.0.0.1", nil)
+	assert.NoError(t, err)
+	// Ошибки старше окна забываются
+	database.DB.Model(&models.LoginCounter{}).Where("key = ?", "user:bob").Update("last_failure_at", time.Now().Add(-2*time.Minute))
+	until, err := registerLoginFailure("bob", "10.0.0.1", nil)
+	assert.NoError(t, err)
+	assert.True(t, until.IsZero())
+	until, _ = registerLoginFailure("bob", "10.0.0.1", nil)
+	assert.False(t, until.IsZero())
+}
+
+func TestPurgeLoginCounters(t *testing.T) {
+	setupTestDB()
+	defer func(limits LoginLimitConfig) { LoginLimits = limits }(LoginLimits)
+	LoginLimits.Window = time.Hour
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time { at := now.Add(-d); return &at }
+
+	database.DB.Create(&[]models.LoginCounter{
+		{Key: "user:ghost", Failures: 1, LastFailureAt: *ago(2 * time.Hour)},
+		{Key: "user:recent", Failures: 1, LastFailureAt: *ago(time.Minute)},
+		{Key: "user:locked", Lockouts: 1, LastFailureAt: *ago(2 * time.Hour), LockedUntil: ago(-time.Hour)},
+		{Key: "user:chain", Lockouts: 2, LastFailureAt: *ago(2 * time.Hour), LockedUntil: ago(30 * time.Minute)},
+		{Key: "ip:10.0.0.1", Lockouts: 1, LastFailureAt: *ago(3 * time.Hour), LockedUntil: ago(2 * time.Hour)},
+	})
+
+	purged, err := PurgeLoginCounters(database.DB, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+
+	// Остаются свежие ошибки, идущая блокировка и цепочка блокировок, которая ещё не прервалась
+	var keys []string
+	database.DB.Model(&models.LoginCounter{}).Order("key").Pluck("key", &keys)
+	assert.Equal(t, []string{"user:chain", "user:locked", "user:recent"}, keys)
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"todo-app/internal/mailer"
+)
+
+const defaultMailFrom = "ToDo App <noreply@localhost>"
+
+// Mailer отправляет письма пользователям. По умолчанию письма только выводятся в журнал.
+var Mailer mailer.Mailer = mailer.NewLog(os.Stdout, defaultMailFrom)
+
+// AppURL — адрес приложения для ссылок в письмах
+var AppURL = "http://localhost:8080"
+
+// ResetURL — страница, на которую ведёт ссылка для сброса пароля. Токен добавляется параметром token.
+// Пустой адрес ведёт на форму самого приложения, GET /password/reset.
+var ResetURL = ""
+
+// LoadMailer настраивает отправку писем из окружения:
+//
+//	SMTP_ADDR                    — SMTP сервер host:port. Без него письма не отправляются, а пишутся в журнал
+//	SMTP_USERNAME, SMTP_PASSWORD — учётная запись на сервере, если он требует аутентификации
+//	MAIL_FROM                    — адрес отправителя
+//	MAIL_FILE                    — без SMTP_ADDR письма дописываются в этот файл, а не в журнал
+//	APP_URL                      — адрес приложения для ссылок в письмах
+//	RESET_URL                    — страница сброса пароля во внешнем интерфейсе, если он есть
+//
+// Запись писем в журнал или файл — только для разработки: в письмах рабочие ссылки для сброса пароля
+// и подтверждения адреса. В остальных окружениях env без SMTP_ADDR приложение не запускается.
+func LoadMailer(env string) error {
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		AppURL = strings.TrimSuffix(appURL, "/")
+	}
+	ResetURL = os.Getenv("RESET_URL")
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = defaultMailFrom
+	}
+
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		Mailer = mailer.SMTP{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+		log.Printf("Sending mail through %s", addr)
+		return nil
+	}
+	if env != "development" {
+		return fmt.Errorf("SMTP_ADDR is required in %s, without it emails with reset and verification links would be written to the log", env)
+	}
+	if path := os.Getenv("MAIL_FILE"); path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		Mailer = mailer.NewLog(file, from)
+		log.Printf("Writing mail to %s", path)
+		return nil
+	}
+	Mailer = mailer.NewLog(os.Stdout, from)
+	return nil
+}
+
+// passwordResetLink возвращает ссылку для сброса пароля с токеном
+func passwordResetLink(token string) string {
+	base := ResetURL
+	if base == "" {
+		base = AppURL + "/password/reset"
+	}
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
+
+// mailQueueSize — сколько писем может ждать отправки. Когда очередь полна, новые письма не отправляются.
+const mailQueueSize = 256
+
+var (
+	mailJobs    = make(chan func(), mailQueueSize)
+	mailPending sync.WaitGroup
+	mailWorker  sync.Once
+)
+
+// enqueueMail ставит работу с письмом в очередь. Письма отправляются в фоне по одному,
+// чтобы медленный SMTP сервер не задерживал ответы и не выдавал по времени ответа, что письмо ушло.
+func enqueueMail(job func()) {
+	mailWorker.Do(func() {
+		go func() {
+			for job := range mailJobs {
+				job()
+				mailPending.Done()
+			}
+		}()
+	})
+	mailPending.Add(1)
+	select {
+	case mailJobs <- job:
+	default:
+		mailPending.Done()
+		log.Println("Mail queue is full, dropping mail")
+	}
+}
+
+// FlushMail ждёт, пока уйдут письма из очереди. Вызывается при остановке сервера и в тестах.
+func FlushMail() {
+	mailPending.Wait()
+}
+
+// deliverMail отправляет письмо сразу. Ошибка только записывается в журнал: письмо не должно
+// ломать запрос, который его вызвал.
+func deliverMail(m mailer.Mailer, to, subject, body string) {
+	if err := m.Send(mailer.Message{To: to, Subject: subject, Body: body}); err != nil {
+		log.Println("Error while sending mail:", err)
+	}
+}
+
+// sendMail ставит письмо в очередь на отправку
+func sendMail(to, subject, body string) {
+	m := Mailer
+	enqueueMail(func() { deliverMail(m, to, subject, body) })
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"testing"
+	"todo-app/internal/mailer"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMailerNeedsSMTPOutsideDevelopment(t *testing.T) {
+	defer func(m mailer.Mailer, appURL, resetURL string) { Mailer, AppURL, ResetURL = m, appURL, resetURL }(Mailer, AppURL, ResetURL)
+	t.Setenv("SMTP_ADDR", "")
+	t.Setenv("MAIL_FILE", "")
+
+	// Ссылки из писем не должны попадать в журнал рабочего сервера
+	for _, env := range []string{"staging", "production"} {
+		assert.ErrorContains(t, LoadMailer(env), "SMTP_ADDR is required", env)
+	}
+	assert.NoError(t, LoadMailer("development"))
+
+	t.Setenv("SMTP_ADDR", "smtp.example.com:587")
+	assert.NoError(t, LoadMailer("production"))
+	assert.IsType(t, mailer.SMTP{}, Mailer)
+}
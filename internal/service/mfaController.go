@@ -0,0 +1,400 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	// mfaChallengeTTL — сколько действует токен входа, ожидающего кода второго фактора
+	mfaChallengeTTL = 5 * time.Minute
+	// maxMFAAttempts — после стольких неверных кодов токен входа удаляется и нужно снова ввести пароль
+	maxMFAAttempts    = 5
+	recoveryCodeCount = 10
+)
+
+var errInvalidMFACode = errors.New("invalid code")
+
+// TOTPCodeInput — код из приложения-аутентификатора или код восстановления
+type TOTPCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAInput — второй шаг входа
+type MFAInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TOTPEnrollment — секрет для приложения-аутентификатора
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// userTOTP загружает подключённый второй фактор пользователя. enabled false, если 2FA не включена.
+func userTOTP(db *gorm.DB, userID uint) (totp models.TOTP, enabled bool, err error) {
+	err = db.Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&totp).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return totp, false, nil
+	}
+	return totp, err == nil, err
+}
+
+// newRecoveryCodes заменяет коды восстановления пользователя новыми и возвращает их
+func newRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: hashToken(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor принимает код TOTP или неиспользованный код восстановления.
+// Принятый код больше не действует.
+func verifySecondFactor(tx *gorm.DB, totp models.TOTP, code string) error {
+	code = strings.TrimSpace(code)
+	if step, ok := checkTOTP(totp.Secret, code, time.Now(), totp.LastStep); ok {
+		// Условие на last_step не даёт принять один код в двух одновременных запросах
+		result := tx.Model(&models.TOTP{}).Where("id = ? AND last_step < ?", totp.ID, step).Update("last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidMFACode
+		}
+		return nil
+	}
+
+	normalized := strings.ToLower(strings.ReplaceAll(code, "-", ""))
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", totp.UserID, hashToken(normalized)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+// beginMFAChallenge запоминает вход с проверенным паролем и возвращает токен для второго шага
+func beginMFAChallenge(userID uint) (string, error) {
+	token, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	challenge := models.MFAChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Заодно удаляем входы, которые так и не завершились
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.MFAChallenge{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&challenge).Error
+	})
+	return token, err
+}
+
+// removeTOTP отключает второй фактор пользователя вместе с кодами восстановления и начатыми входами
+func removeTOTP(tx *gorm.DB, userID uint) error {
+	for _, model := range []interface{}{&models.TOTP{}, &models.RecoveryCode{}, &models.MFAChallenge{}} {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnrollTOTP godoc
+// @Summary Start two-factor enrollment
+// @Description Create a TOTP secret for the current user. Show the provisioning URI as a QR code in an authenticator app, then confirm with POST /auth/totp/verify. Starting again replaces an unconfirmed secret.
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} TOTPEnrollment
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /auth/totp/enroll [post]
+func EnrollTOTP(c *gin.Context) {
+	userID := currentUserID(c)
+	if _, enabled, err := userTOTP(database.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось подключить 2FA"})
+		return
+	} else if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "2FA уже включена"})
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось подключить 2FA"})
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND confirmed_at IS NULL", userID).Delete(&models.TOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TOTP{UserID: userID, Secret: secret}).Error
+	})
+	if err != nil {
+		log.Println("Error while enrolling TOTP:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось подключить 2FA"})
+		return
+	}
+	c.JSON(http.StatusOK, TOTPEnrollment{Secret: secret, ProvisioningURI: totpURI(secret, c.GetString("username"))})
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm two-factor enrollment
+// @Description Check a code from the authenticator app and turn on two-factor login. Returns one-time recovery codes, which are shown only once.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   code  body     TOTPCodeInput  true  "Code from the app"
+// @Success 200 {object} map[string][]string
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /auth/totp/verify [post]
+func ConfirmTOTP(c *gin.Context) {
+	var input TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var totp models.TOTP
+	if err := database.DB.Where("user_id = ? AND confirmed_at IS NULL", currentUserID(c)).First(&totp).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Подключение 2FA не начато"})
+		return
+	}
+	step, ok := checkTOTP(totp.Secret, strings.TrimSpace(input.Code), time.Now(), totp.LastStep)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный код"})
+		return
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&totp).Updates(map[string]interface{}{"confirmed_at": time.Now(), "last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		codes, err = newRecoveryCodes(tx, totp.UserID)
+		return err
+	})
+	if err != nil {
+		log.Println("Error while confirming TOTP:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось подключить 2FA"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Replace recovery codes
+// @Description Replace all recovery codes of the current user with new ones. Needs a current code.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   code  body     TOTPCodeInput  true  "Code from the app or a recovery code"
+// @Success 200 {object} map[string][]string
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /auth/totp/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	changeTOTP(c, func(tx *gorm.DB, totp models.TOTP) (gin.H, error) {
+		codes, err := newRecoveryCodes(tx, totp.UserID)
+		return gin.H{"recovery_codes": codes}, err
+	})
+}
+
+// DisableTOTP godoc
+// @Summary Turn off two-factor login
+// @Description Turn off two-factor login for the current user. Needs a current code.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   code  body     TOTPCodeInput  true  "Code from the app or a recovery code"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /auth/totp/disable [post]
+func DisableTOTP(c *gin.Context) {
+	changeTOTP(c, func(tx *gorm.DB, totp models.TOTP) (gin.H, error) {
+		return gin.H{"message": "2FA отключена"}, removeTOTP(tx, totp.UserID)
+	})
+}
+
+// changeTOTP проверяет код текущего пользователя и выполняет change в той же транзакции
+func changeTOTP(c *gin.Context, change func(tx *gorm.DB, totp models.TOTP) (gin.H, error)) {
+	var input TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	totp, enabled, err := userTOTP(database.DB, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить 2FA"})
+		return
+	}
+	if !enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "2FA не включена"})
+		return
+	}
+
+	var response gin.H
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, totp, input.Code); err != nil {
+			return err
+		}
+		var err error
+		response, err = change(tx, totp)
+		return err
+	})
+	if errors.Is(err, errInvalidMFACode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный код"})
+		return
+	}
+	if err != nil {
+		log.Println("Error while changing TOTP:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить 2FA"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// LoginMFA godoc
+// @Summary Finish two-factor login
+// @Description Exchange the mfa_token from /login and a code from the authenticator app, or a recovery code, for the access and refresh tokens. After 5 wrong codes the mfa_token stops working. Wrong codes count as failed logins.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body     MFAInput  true  "Challenge token and code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 429 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /login/mfa [post]
+func LoginMFA(c *gin.Context) {
+	var input MFAInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var challenge models.MFAChallenge
+	err := database.DB.Where("token_hash = ? AND expires_at > ?", hashToken(input.MFAToken), time.Now()).First(&challenge).Error
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, challenge.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Учётная запись отключена"})
+		return
+	}
+	totp, enabled, err := userTOTP(database.DB, user.ID)
+	if err != nil || !enabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	if !checkLoginLock(c, user.Username) {
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, totp, input.Code); err != nil {
+			return err
+		}
+		// Токен входа одноразовый
+		result := tx.Delete(&models.MFAChallenge{}, challenge.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidMFACode
+		}
+		return nil
+	})
+	if errors.Is(err, errInvalidMFACode) {
+		// Неудачная попытка учитывается вне откаченной транзакции
+		if challenge.Attempts+1 >= maxMFAAttempts {
+			err = database.DB.Delete(&challenge).Error
+		} else {
+			err = database.DB.Model(&challenge).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+		}
+		if err != nil {
+			log.Println("Error while counting MFA attempts:", err)
+		}
+		loginFailed(c, user.Username, &user.ID, "Неверный код")
+		return
+	}
+	if err != nil {
+		log.Println("Error while checking MFA code:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось проверить код"})
+		return
+	}
+
+	tokens, err := startSession(c, user)
+	if err != nil {
+		log.Println("Error while starting session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать JWT токен"})
+		return
+	}
+	clearLoginFailures(user.Username)
+	c.JSON(http.StatusOK, tokens)
+}
+
+// ResetUserTOTP godoc
+// @Summary Reset a user's two-factor login
+// @Description Turn off two-factor login of a user who lost their device, with their recovery codes. Needs the users:mfa permission.
+// @Tags admin
+// @Produce  json
+// @Param   id  path     int  true  "User ID"
+// @Success 200 {object} UserInfo
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /admin/users/{id}/totp [delete]
+func ResetUserTOTP(c *gin.Context) {
+	var user models.User
+	if !findUser(c, &user) {
+		return
+	}
+	if err := database.DB.Transaction(func(tx *gorm.DB) error { return removeTOTP(tx, user.ID) }); err != nil {
+		log.Println("Error while resetting TOTP:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось сбросить 2FA"})
+		return
+	}
+	c.JSON(http.StatusOK, userInfo(user))
+}
@@ -0,0 +1,581 @@
+package service
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// oidcLoginTTL — сколько ждать возврата пользователя от провайдера
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcStateCookie хранит хеш state в браузере, который начал вход. Обратный вызов принимается только
+// от этого браузера: иначе чужую ссылку на вход или привязку можно подсунуть жертве.
+const oidcStateCookie = "oidc_state"
+
+var defaultOIDCScopes = []string{"openid", "profile", "email"}
+
+var (
+	errOIDCNotEnabled  = errors.New("OIDC login is not configured")
+	errInvalidOIDCFlow = errors.New("invalid or expired state")
+	errInvalidIDToken  = errors.New("invalid ID token")
+	errIdentityLinked  = errors.New("identity is linked to another user")
+)
+
+// OIDCConfig — настройки входа через внешнего провайдера OpenID Connect
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string   // пусто у публичных клиентов, им достаточно PKCE
+	RedirectURL  string   // адрес /auth/oidc/callback приложения, зарегистрированный у провайдера
+	Scopes       []string // по умолчанию openid, profile и email
+}
+
+// OIDCProvider — провайдер, адреса которого получены из его discovery документа
+type OIDCProvider struct {
+	config                OIDCConfig
+	client                *http.Client
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+
+	mu   sync.Mutex
+	keys map[string]JSONWebKey
+}
+
+// OIDC — настроенный провайдер. Пока он nil, вход через OIDC выключен.
+var OIDC *OIDCProvider
+
+// LoadOIDC настраивает вход через OIDC из окружения:
+//
+//	OIDC_ISSUER         — адрес провайдера, его настройки читаются из /.well-known/openid-configuration
+//	OIDC_CLIENT_ID      — ID клиента у провайдера
+//	OIDC_CLIENT_SECRET  — секрет клиента
+//	OIDC_REDIRECT_URL   — адрес /auth/oidc/callback приложения
+//	OIDC_SCOPES         — scope через пробел, по умолчанию "openid profile email"
+//
+// Без OIDC_ISSUER вход через OIDC выключен.
+func LoadOIDC() error {
+	config := OIDCConfig{
+		Issuer:       os.Getenv("OIDC_ISSUER"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}
+	if config.Issuer == "" {
+		return nil
+	}
+	provider, err := NewOIDCProvider(config, &http.Client{Timeout: 10 * time.Second})
+	if err != nil {
+		return err
+	}
+	OIDC = provider
+	log.Printf("OIDC login enabled with issuer %s", config.Issuer)
+	return nil
+}
+
+// NewOIDCProvider читает discovery документ провайдера и проверяет, что он выдан для config.Issuer
+func NewOIDCProvider(config OIDCConfig, client *http.Client) (*OIDCProvider, error) {
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("OIDC client ID and redirect URL are required")
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = defaultOIDCScopes
+	}
+	p := &OIDCProvider{config: config, client: client}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	if discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery: issuer %q does not match %q", discovery.Issuer, config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery: provider metadata is incomplete")
+	}
+	p.authorizationEndpoint = discovery.AuthorizationEndpoint
+	p.tokenEndpoint = discovery.TokenEndpoint
+	p.jwksURI = discovery.JWKSURI
+	return p, nil
+}
+
+func (p *OIDCProvider) getJSON(url string, dest interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(dest)
+}
+
+// codeChallenge возвращает S256 challenge PKCE для verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authCodeURL возвращает адрес, по которому пользователь входит у провайдера
+func (p *OIDCProvider) authCodeURL(state, nonce, verifier string) string {
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.authorizationEndpoint + separator + query.Encode()
+}
+
+// exchange обменивает код авторизации на ID токен
+func (p *OIDCProvider) exchange(code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token endpoint: %s: %s", resp.Status, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", fmt.Errorf("token endpoint: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint: no id_token in response")
+	}
+	return tokens.IDToken, nil
+}
+
+// key находит ключ провайдера по kid. Неизвестный kid перечитывает JWKS, так что провайдер может менять ключи.
+func (p *OIDCProvider) key(kid string) (JSONWebKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err := p.getJSON(p.jwksURI, &set); err != nil {
+		return JSONWebKey{}, err
+	}
+	p.keys = map[string]JSONWebKey{}
+	for _, key := range set.Keys {
+		if key.Use == "" || key.Use == "sig" {
+			p.keys[key.Kid] = key
+		}
+	}
+	// Токен без kid можно проверить, только если ключ у провайдера один
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	key, ok := p.keys[kid]
+	if !ok {
+		return JSONWebKey{}, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// keyfunc выбирает ключ проверки ID токена и не допускает подмены алгоритма
+func (p *OIDCProvider) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	jwk, err := p.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	key, method, err := jwk.VerifyKey()
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key, nil
+}
+
+// IDTokenClaims — поля ID токена, которые нужны приложению
+type IDTokenClaims struct {
+	Subject           string
+	Email             string
+	PreferredUsername string
+}
+
+// verify проверяет подпись ID токена, провайдера, клиента, срок действия и nonce
+func (p *OIDCProvider) verify(rawIDToken, nonce string) (IDTokenClaims, error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(rawIDToken, claims, p.keyfunc); err != nil {
+		return IDTokenClaims{}, fmt.Errorf("%w: %v", errInvalidIDToken, err)
+	}
+
+	str := func(name string) string {
+		s, _ := claims[name].(string)
+		return s
+	}
+	if str("iss") != p.config.Issuer {
+		return IDTokenClaims{}, fmt.Errorf("%w: unexpected issuer %q", errInvalidIDToken, str("iss"))
+	}
+	var audience []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+	}
+	found := false
+	for _, a := range audience {
+		found = found || a == p.config.ClientID
+	}
+	if !found {
+		return IDTokenClaims{}, fmt.Errorf("%w: token is not issued for this client", errInvalidIDToken)
+	}
+	if azp := str("azp"); azp != "" && azp != p.config.ClientID {
+		return IDTokenClaims{}, fmt.Errorf("%w: unexpected authorized party %q", errInvalidIDToken, azp)
+	}
+	// Valid проверяет exp, только если он есть, а у ID токена он обязателен
+	if _, ok := claims["exp"]; !ok {
+		return IDTokenClaims{}, fmt.Errorf("%w: no expiration time", errInvalidIDToken)
+	}
+	if str("nonce") != nonce {
+		return IDTokenClaims{}, fmt.Errorf("%w: nonce mismatch", errInvalidIDToken)
+	}
+	if str("sub") == "" {
+		return IDTokenClaims{}, fmt.Errorf("%w: no subject", errInvalidIDToken)
+	}
+	return IDTokenClaims{Subject: str("sub"), Email: str("email"), PreferredUsername: str("preferred_username")}, nil
+}
+
+// beginOIDCLogin запоминает state, nonce и verifier нового входа, привязывает state к браузеру cookie
+// и возвращает адрес входа у провайдера.
+// Если userID задан, после входа учётная запись провайдера будет привязана к этому пользователю.
+func beginOIDCLogin(c *gin.Context, userID *uint) (string, error) {
+	if OIDC == nil {
+		return "", errOIDCNotEnabled
+	}
+	var values [3]string
+	for i := range values {
+		v, err := newRefreshToken()
+		if err != nil {
+			return "", err
+		}
+		values[i] = v
+	}
+	login := models.OIDCLogin{
+		State:        values[0],
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		UserID:       userID,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Заодно удаляем входы, которые так и не завершились
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLogin{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&login).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	setOIDCStateCookie(c, hashToken(login.State), int(oidcLoginTTL/time.Second))
+	return OIDC.authCodeURL(login.State, login.Nonce, login.CodeVerifier), nil
+}
+
+// setOIDCStateCookie ставит или, с maxAge < 0, удаляет cookie с хешем state. SameSite=Lax нужен,
+// чтобы cookie пришла с переходом от провайдера обратно в приложение.
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || strings.HasPrefix(OIDC.config.RedirectURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/auth/oidc", "", secure, true)
+}
+
+// checkOIDCState проверяет, что обратный вызов пришёл в браузер, который начал вход
+func checkOIDCState(c *gin.Context, state string) bool {
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(hashToken(state))) == 1
+}
+
+// finishOIDCLogin находит и удаляет вход по state, чтобы его нельзя было завершить дважды
+func finishOIDCLogin(state string) (models.OIDCLogin, error) {
+	var login models.OIDCLogin
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state = ?", state).First(&login).Error; err != nil {
+			return errInvalidOIDCFlow
+		}
+		result := tx.Delete(&login)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || time.Now().After(login.ExpiresAt) {
+			return errInvalidOIDCFlow
+		}
+		return nil
+	})
+	return login, err
+}
+
+// userForIdentity возвращает пользователя, привязанного к учётной записи провайдера.
+// При первом входе создаётся новый пользователь с именем из ID токена.
+func userForIdentity(claims IDTokenClaims) (models.User, error) {
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.Identity
+		err := tx.Where("issuer = ? AND subject = ?", OIDC.config.Issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			return tx.First(&user, identity.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Пароля у такого пользователя нет, войти он может только через провайдера
+		if user.Username, err = uniqueUsername(tx, claims); err != nil {
+			return err
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Identity{
+			UserID: user.ID, Issuer: OIDC.config.Issuer, Subject: claims.Subject, Email: claims.Email,
+		}).Error
+	})
+	return user, err
+}
+
+// uniqueUsername подбирает свободное имя пользователя по ID токену
+func uniqueUsername(tx *gorm.DB, claims IDTokenClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = claims.Email
+	}
+	if base == "" {
+		base = "user"
+	}
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		var count int64
+		if err := tx.Model(&models.User{}).Unscoped().Where("username = ?", name).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return name, nil
+		}
+	}
+}
+
+// linkIdentity привязывает учётную запись провайдера к пользователю userID
+func linkIdentity(userID uint, claims IDTokenClaims) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.Identity
+		err := tx.Where("issuer = ? AND subject = ?", OIDC.config.Issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			if identity.UserID != userID {
+				return errIdentityLinked
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(&models.Identity{
+			UserID: userID, Issuer: OIDC.config.Issuer, Subject: claims.Subject, Email: claims.Email,
+		}).Error
+	})
+}
+
+// OIDCLogin godoc
+// @Summary Log in with SSO
+// @Description Redirect to the OpenID Connect provider. After the login the provider returns the user to /auth/oidc/callback.
+// @Tags auth
+// @Success 302
+// @Failure 404 {object} gin.H
+// @Router /auth/oidc/login [get]
+func OIDCLogin(c *gin.Context) {
+	authURL, err := beginOIDCLogin(c, nil)
+	if errors.Is(err, errOIDCNotEnabled) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("Error while starting OIDC login:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось начать вход"})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// LinkOIDC godoc
+// @Summary Link an SSO account
+// @Description Start linking an account at the OpenID Connect provider to the current user. Open the returned URL in the same browser: the response sets a cookie that the callback requires.
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} gin.H
+// @Router /auth/oidc/link [post]
+func LinkOIDC(c *gin.Context) {
+	userID := currentUserID(c)
+	authURL, err := beginOIDCLogin(c, &userID)
+	if errors.Is(err, errOIDCNotEnabled) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("Error while starting OIDC link:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось начать привязку"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// OIDCCallback godoc
+// @Summary SSO callback
+// @Description Finish the OpenID Connect login and receive the same access and refresh tokens as /login. Users are created on their first login. With two-factor login turned on the response is {"mfa_required": true, "mfa_token": ...} as in /login; finish the login with POST /login/mfa. If the login was started by /auth/oidc/link, the account is linked instead. The callback is accepted only in the browser that started the login, which holds the cookie set then.
+// @Tags auth
+// @Produce  json
+// @Param   code   query    string  true  "Authorization code"
+// @Param   state  query    string  true  "State"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /auth/oidc/callback [get]
+func OIDCCallback(c *gin.Context) {
+	if OIDC == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": errOIDCNotEnabled.Error()})
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "provider denied the login: " + e})
+		return
+	}
+	// Вход, начатый в другом браузере, не завершается и не тратится
+	if !checkOIDCState(c, c.Query("state")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidOIDCFlow.Error()})
+		return
+	}
+	setOIDCStateCookie(c, "", -1)
+	login, err := finishOIDCLogin(c.Query("state"))
+	if errors.Is(err, errInvalidOIDCFlow) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("Error while finishing OIDC login:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось завершить вход"})
+		return
+	}
+
+	rawIDToken, err := OIDC.exchange(c.Query("code"), login.CodeVerifier)
+	if err != nil {
+		log.Println("Error while exchanging OIDC code:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Не удалось получить токен провайдера"})
+		return
+	}
+	claims, err := OIDC.verify(rawIDToken, login.Nonce)
+	if err != nil {
+		log.Println("Rejected OIDC ID token:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errInvalidIDToken.Error()})
+		return
+	}
+
+	if login.UserID != nil {
+		err := linkIdentity(*login.UserID, claims)
+		if errors.Is(err, errIdentityLinked) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Println("Error while linking identity:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось привязать учётную запись"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Учётная запись привязана"})
+		return
+	}
+
+	user, err := userForIdentity(claims)
+	if err != nil {
+		log.Println("Error while finding user for identity:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось завершить вход"})
+		return
+	}
+	if user.DisabledAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Учётная запись отключена"})
+		return
+	}
+	// Вход через провайдера не заменяет второй фактор, включённый у пользователя
+	response, _, err := loginResponse(c, user)
+	if err != nil {
+		log.Println("Error while logging in with OIDC:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось завершить вход"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"todo-app/internal/oidctest"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOIDCVerify(t *testing.T) {
+	mock := oidctest.NewServer("todo-app")
+	defer mock.Close()
+	provider, err := NewOIDCProvider(OIDCConfig{
+		Issuer:      mock.Issuer(),
+		ClientID:    "todo-app",
+		RedirectURL: "http://localhost/auth/oidc/callback",
+	}, mock.Client())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":   mock.Issuer(),
+			"aud":   "todo-app",
+			"sub":   "42",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "n",
+			"email": "user@example.com",
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	identity, err := provider.verify(mock.IDToken(claims(nil)), "n")
+	assert.NoError(t, err)
+	assert.Equal(t, IDTokenClaims{Subject: "42", Email: "user@example.com"}, identity)
+	_, err = provider.verify(mock.IDToken(claims(jwt.MapClaims{"aud": []string{"other", "todo-app"}, "azp": "todo-app"})), "n")
+	assert.NoError(t, err)
+
+	rejected := map[string]jwt.MapClaims{
+		"another client": {"aud": "other"},
+		"another party":  {"aud": []string{"other", "todo-app"}, "azp": "other"},
+		"another issuer": {"iss": "https://evil.example.com"},
+		"another nonce":  {"nonce": "m"},
+		"expired":        {"exp": time.Now().Add(-time.Minute).Unix()},
+		"no expiration":  {"exp": nil},
+		"no subject":     {"sub": nil},
+	}
+	for name, changes := range rejected {
+		_, err := provider.verify(mock.IDToken(claims(changes)), "n")
+		assert.ErrorIs(t, err, errInvalidIDToken, name)
+	}
+
+	// Токен, подписанный не ключом провайдера, не принимается
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil)).SignedString([]byte("secret"))
+	_, err = provider.verify(forged, "n")
+	assert.ErrorIs(t, err, errInvalidIDToken)
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordBytes — bcrypt учитывает только первые 72 байта пароля
+const maxPasswordBytes = 72
+
+// PasswordPolicyConfig — требования к новым паролям
+type PasswordPolicyConfig struct {
+	MinLength int // в символах
+}
+
+var PasswordPolicy = PasswordPolicyConfig{MinLength: 8}
+
+//go:embed breached-passwords.txt
+var defaultBreachedPasswords string
+
+// breachedPasswords — SHA-1 в hex верхнего регистра паролей из утечек, как в списках Have I Been Pwned
+var breachedPasswords = map[string]bool{}
+
+func init() {
+	if err := addBreachedPasswords(strings.NewReader(defaultBreachedPasswords)); err != nil {
+		panic(err)
+	}
+}
+
+func passwordSHA1(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// addBreachedPasswords добавляет пароли из списка: по одному на строку, открытым текстом
+// или SHA-1 в hex с необязательным ":число" в конце. Пустые строки и строки с # пропускаются.
+func addBreachedPasswords(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		if _, err := hex.DecodeString(hash); err == nil && len(hash) == 2*sha1.Size {
+			breachedPasswords[strings.ToUpper(hash)] = true
+			continue
+		}
+		breachedPasswords[passwordSHA1(line)] = true
+	}
+	return scanner.Err()
+}
+
+// LoadPasswordBlocklist добавляет к встроенному списку паролей из утечек пароли из файла
+func LoadPasswordBlocklist(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return addBreachedPasswords(file)
+}
+
+// validatePassword проверяет новый пароль пользователя username по политике паролей
+func validatePassword(username, password string) error {
+	if utf8.RuneCountInString(password) < PasswordPolicy.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", PasswordPolicy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes long", maxPasswordBytes)
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errors.New("password must not contain the username")
+	}
+	if breachedPasswords[passwordSHA1(password)] {
+		return errors.New("password is too common, it appears in known data breaches")
+	}
+	return nil
+}
+
+// Алгоритмы хеширования паролей
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// PasswordHashConfig — как хешируются новые пароли. Хеши со старыми параметрами
+// принимаются и пересчитываются при следующем входе.
+type PasswordHashConfig struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32 // КиБ
+	Argon2Threads uint8
+}
+
+var PasswordHashing = PasswordHashConfig{
+	Algorithm:     HashBcrypt,
+	BcryptCost:    bcrypt.DefaultCost,
+	Argon2Time:    3,
+	Argon2Memory:  64 * 1024,
+	Argon2Threads: 2,
+}
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Validate проверяет, что алгоритм известен, а параметры допустимы
+func (config PasswordHashConfig) Validate() error {
+	switch config.Algorithm {
+	case HashBcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashArgon2id:
+		if config.Argon2Time < 1 || config.Argon2Memory < 8*uint32(config.Argon2Threads) || config.Argon2Threads < 1 {
+			return errors.New("argon2id time and threads must be positive and memory at least 8 KiB per thread")
+		}
+	default:
+		return fmt.Errorf("unknown password hash %q, must be %s or %s", config.Algorithm, HashBcrypt, HashArgon2id)
+	}
+	return nil
+}
+
+// hashPassword хеширует пароль текущим алгоритмом. Хеш Argon2id записывается в формате PHC:
+// $argon2id$v=19$m=65536,t=3,p=2$<соль>$<ключ>
+func hashPassword(password string) (string, error) {
+	config := PasswordHashing
+	if config.Algorithm != HashArgon2id {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), config.BcryptCost)
+		return string(hash), err
+	}
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, config.Argon2Time, config.Argon2Memory, config.Argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		config.Argon2Memory, config.Argon2Time, config.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword сравнивает пароль с хешем. rehash сообщает, что хеш создан с другими
+// алгоритмом или параметрами и его стоит пересчитать.
+func checkPassword(hash, password string) (ok, rehash bool) {
+	config := PasswordHashing
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return true, config.Algorithm != HashBcrypt || err != nil || cost != config.BcryptCost
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time == 0 || threads == 0 {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, false
+	}
+	actual := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, false
+	}
+	return true, config.Algorithm != HashArgon2id || memory != config.Argon2Memory || time != config.Argon2Time || threads != config.Argon2Threads
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidatePassword(t *testing.T) {
+	assert.NoError(t, validatePassword("alice", "correct horse battery"))
+	assert.NoError(t, validatePassword("alice", "пароль-из-кириллицы"))
+
+	rejected := map[string]string{
+		"short":               "Sh0rt!",
+		"too long for bcrypt": strings.Repeat("x", maxPasswordBytes+1),
+		"contains username":   "my-ALICE-password",
+		"breached":            "qwerty123",
+	}
+	for name, password := range rejected {
+		assert.Error(t, validatePassword("alice", password), name)
+	}
+	// Восемь символов кириллицы — это восемь символов, хотя байт в них 16
+	assert.NoError(t, validatePassword("alice", "ёжикёжик"))
+}
+
+func TestLoadPasswordBlocklist(t *testing.T) {
+	defer func(saved map[string]bool) { breachedPasswords = saved }(breachedPasswords)
+	breachedPasswords = map[string]bool{}
+
+	// Открытым текстом и в формате Have I Been Pwned: SHA-1 и число утечек
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "# comment\nletmein-please\r\n" + strings.ToLower(passwordSHA1("hunter2hunter2")) + ":42\n"
+	assert.NoError(t, os.WriteFile(path, []byte(list), 0o600))
+	assert.NoError(t, LoadPasswordBlocklist(path))
+
+	assert.Error(t, validatePassword("", "letmein-please"))
+	assert.Error(t, validatePassword("", "hunter2hunter2"))
+	assert.NoError(t, validatePassword("", "# comment"))
+}
+
+func TestPasswordHashing(t *testing.T) {
+	defer func(saved PasswordHashConfig) { PasswordHashing = saved }(PasswordHashing)
+	PasswordHashing = PasswordHashConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.MinCost, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+	assert.NoError(t, PasswordHashing.Validate())
+
+	bcryptHash, err := hashPassword("secret")
+	assert.NoError(t, err)
+	ok, rehash := checkPassword(bcryptHash, "secret")
+	assert.True(t, ok)
+	assert.False(t, rehash)
+	ok, _ = checkPassword(bcryptHash, "wrong")
+	assert.False(t, ok)
+
+	PasswordHashing.Algorithm = HashArgon2id
+	argonHash, err := hashPassword("secret")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(argonHash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+	ok, rehash = checkPassword(argonHash, "secret")
+	assert.True(t, ok)
+	assert.False(t, rehash)
+	ok, _ = checkPassword(argonHash, "wrong")
+	assert.False(t, ok)
+
+	// Хеши с другим алгоритмом или параметрами принимаются, но требуют пересчёта
+	ok, rehash = checkPassword(bcryptHash, "secret")
+	assert.True(t, ok)
+	assert.True(t, rehash)
+	PasswordHashing.Argon2Time = 2
+	ok, rehash = checkPassword(argonHash, "secret")
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	ok, _ = checkPassword("$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$a2V5", "secret")
+	assert.False(t, ok)
+	assert.Error(t, PasswordHashConfig{Algorithm: "md5"}.Validate())
+}
+
+func TestLoginRehashesPassword(t *testing.T) {
+	setupTestDB()
+	router := setupLoginRouter()
+	defer func(saved PasswordHashConfig) { PasswordHashing = saved }(PasswordHashing)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	database.DB.Create(&models.User{Username: "alice", Password: string(hash)})
+
+	PasswordHashing = PasswordHashConfig{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 1024, Argon2Threads: 1}
+	code, _ := login(router, "alice", "correct horse battery")
+	assert.Equal(t, http.StatusOK, code)
+
+	var user models.User
+	database.DB.Where("username = ?", "alice").First(&user)
+	assert.True(t, strings.HasPrefix(user.Password, "$argon2id$"))
+	code, _ = login(router, "alice", "correct horse battery")
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+)
+
+// AccountDeletionGrace — сколько удалённая учётная запись ждёт окончательного удаления.
+// Вход в течение этого срока отменяет удаление.
+var AccountDeletionGrace = 30 * 24 * time.Hour
+
+const (
+	maxDisplayNameLength = 100
+	maxAvatarURLLength   = 2048
+)
+
+var errWrongPassword = errors.New("wrong password")
+
+// ProfileInput — изменяемые поля профиля. Непереданные поля не меняются, пустая строка очищает поле.
+type ProfileInput struct {
+	DisplayName *string `json:"display_name"`
+	Timezone    *string `json:"timezone"`
+	Locale      *string `json:"locale"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+// ChangePasswordInput — текущий и новый пароль
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// DeleteAccountInput — подтверждение удаления учётной записи паролем
+type DeleteAccountInput struct {
+	Password string `json:"password"`
+}
+
+// apply проверяет переданные поля и переносит их в профиль пользователя
+func (input ProfileInput) apply(user *models.User) error {
+	if input.DisplayName != nil {
+		name := strings.TrimSpace(*input.DisplayName)
+		if utf8.RuneCountInString(name) > maxDisplayNameLength {
+			return fmt.Errorf("display_name must be at most %d characters long", maxDisplayNameLength)
+		}
+		user.DisplayName = name
+	}
+	if input.Timezone != nil {
+		// LoadLocation принимает и "Local", но часовой пояс сервера пользователю ни о чём не говорит
+		if tz := *input.Timezone; tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+				return fmt.Errorf("unknown timezone %q", tz)
+			}
+		}
+		user.Timezone = *input.Timezone
+	}
+	if input.Locale != nil {
+		locale := *input.Locale
+		if locale != "" {
+			tag, err := language.Parse(locale)
+			if err != nil {
+				return fmt.Errorf("invalid locale %q", locale)
+			}
+			locale = tag.String()
+		}
+		user.Locale = locale
+	}
+	if input.AvatarURL != nil {
+		avatar := *input.AvatarURL
+		if avatar != "" {
+			u, err := url.Parse(avatar)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("avatar_url must be an absolute http or https URL")
+			}
+			if len(avatar) > maxAvatarURLLength {
+				return fmt.Errorf("avatar_url must be at most %d characters long", maxAvatarURLLength)
+			}
+		}
+		user.AvatarURL = avatar
+	}
+	return nil
+}
+
+// confirmPassword проверяет пароль пользователя перед опасным действием.
+// У учётных записей, созданных через SSO, пароля нет, и подтверждать нечем.
+func confirmPassword(user models.User, password string) error {
+	if user.Password == "" {
+		return nil
+	}
+	if ok, _ := checkPassword(user.Password, password); !ok {
+		return errWrongPassword
+	}
+	return nil
+}
+
+// GetProfile godoc
+// @Summary Get the current user
+// @Description Get the account and profile of the current user
+// @Tags profile
+// @Produce  json
+// @Success 200 {object} models.User
+// @Failure 500 {object} gin.H
+// @Router /me [get]
+func GetProfile(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить профиль"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateProfile godoc
+// @Summary Update the profile
+// @Description Change the display name, the timezone (IANA name such as Europe/Moscow), the locale (BCP 47 tag such as ru-RU) or the avatar URL. Omitted fields are left unchanged, an empty string clears a field.
+// @Tags profile
+// @Accept  json
+// @Produce  json
+// @Param   profile  body     ProfileInput  true  "Profile fields"
+// @Success 200 {object} models.User
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me [patch]
+func UpdateProfile(c *gin.Context) {
+	var input ProfileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить профиль"})
+		return
+	}
+	if err := input.apply(&user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Model(&user).Select("display_name", "timezone", "locale", "avatar_url").Updates(&user).Error; err != nil {
+		log.Println("Error while updating profile:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить профиль"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// ChangePassword godoc
+// @Summary Change the password
+// @Description Set a new password after checking the current one. Accounts created through single sign-on have no password and may omit current_password. All other sessions are signed out.
+// @Tags profile
+// @Accept  json
+// @Produce  json
+// @Param   body  body     ChangePasswordInput  true  "Current and new password"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me/password [post]
+func ChangePassword(c *gin.Context) {
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить пароль"})
+		return
+	}
+	if err := confirmPassword(user, input.CurrentPassword); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Неверный текущий пароль"})
+		return
+	}
+	if err := validatePassword(user.Username, input.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hash, err := hashPassword(input.NewPassword)
+	if err != nil {
+		log.Println("Error while hashing password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить пароль"})
+		return
+	}
+
+	// Текущая сессия остаётся, остальные завершаются: пароль мог узнать кто-то другой
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hash).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, "user_id = ? AND id <> ?", user.ID, c.GetUint("sessionID"))
+	})
+	if err != nil {
+		log.Println("Error while changing password:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить пароль"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Пароль изменён"})
+}
+
+// DeleteAccount godoc
+// @Summary Delete the account
+// @Description Schedule the account of the current user for deletion and sign out all sessions. The account and its personal data are deleted for good after the grace period (30 days by default); logging in before that cancels the deletion. Accounts with a password must confirm it.
+// @Tags profile
+// @Accept  json
+// @Produce  json
+// @Param   body  body     DeleteAccountInput  false  "Password"
+// @Success 202 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /me [delete]
+func DeleteAccount(c *gin.Context) {
+	var input DeleteAccountInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, currentUserID(c)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось удалить учётную запись"})
+		return
+	}
+	if err := confirmPassword(user, input.Password); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Неверный пароль"})
+		return
+	}
+
+	deleteAt := time.Now().Add(AccountDeletionGrace)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("deletion_scheduled_at", deleteAt).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, "user_id = ?", user.ID)
+	})
+	if err != nil {
+		log.Println("Error while scheduling account deletion:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось удалить учётную запись"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "Учётная запись будет удалена. Войдите до этого срока, чтобы отменить удаление",
+		"deletion_scheduled_at": deleteAt,
+	})
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func validateProject(project *models.Project) error {
+	if project.Color != "" && !colorPattern.MatchString(project.Color) {
+		return errors.New("color must be in #RRGGBB format")
+	}
+	return nil
+}
+
+// ProjectInput — поля проекта, которые задаёт клиент. ID, владелец, пространство
+// и поля gorm.Model системные, и в теле запроса они игнорируются.
+type ProjectInput struct {
+	Name     string `json:"name" binding:"required"`
+	Color    string `json:"color"`
+	Archived bool   `json:"archived"`
+	Position int    `json:"position"`
+}
+
+// projectInputOf возвращает изменяемые поля проекта, чтобы поля, которых нет в запросе, не менялись
+func projectInputOf(project *models.Project) ProjectInput {
+	return ProjectInput{Name: project.Name, Color: project.Color, Archived: project.Archived, Position: project.Position}
+}
+
+// apply переносит поля из input в проект
+func (in ProjectInput) apply(project *models.Project) {
+	project.Name = in.Name
+	project.Color = in.Color
+	project.Archived = in.Archived
+	project.Position = in.Position
+}
+
+// checkProject проверяет, что задачу переносят в проект того же пространства
+func checkProject(db *gorm.DB, sp space, projectID *uint) error {
+	if projectID == nil {
+		return nil
+	}
+	var count int64
+	db.Model(&models.Project{}).Scopes(sp.scope).Where("id = ?", *projectID).Count(&count)
+	if count == 0 {
+		return errors.New("project not found")
+	}
+	return nil
+}
+
+// findProject загружает проект из пути запроса или отвечает 404
+func findProject(c *gin.Context, project *models.Project) bool {
+	if err := database.DB.Scopes(ownedBy(resourceOwnerID(c))).First(project, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Проект не найден"})
+		return false
+	}
+	return true
+}
+
+// GetProjects godoc
+// @Summary List projects
+// @Description List projects of the current user ordered by position
+// @Tags projects
+// @Produce  json
+// @Param   archived  query    bool  false  "Filter by archived flag"
+// @Success 200 {array} models.Project
+// @Failure 400 {object} gin.H
+// @Router /projects [get]
+func GetProjects(c *gin.Context) {
+	query := database.DB.Scopes(currentSpace(c).scope)
+	if s := c.Query("archived"); s != "" {
+		archived, err := strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "archived must be true or false"})
+			return
+		}
+		query = query.Where("archived = ?", archived)
+	}
+
+	var projects []models.Project
+	query.Order("position, id").Find(&projects)
+	c.JSON(http.StatusOK, projects)
+}
+
+// GetProject godoc
+// @Summary Get a project
+// @Tags projects
+// @Produce  json
+// @Param   id  path     int  true  "Project ID"
+// @Success 200 {object} models.Project
+// @Failure 404 {object} gin.H
+// @Router /projects/{id} [get]
+func GetProject(c *gin.Context) {
+	var project models.Project
+	if !findProject(c, &project) {
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+// CreateProject godoc
+// @Summary Create a project
+// @Description Create a project. Without a position it is placed after the existing ones.
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   project  body     ProjectInput  true  "Project"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /projects [post]
+func CreateProject(c *gin.Context) {
+	var input ProjectInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var project models.Project
+	input.apply(&project)
+	if err := validateProject(&project); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sp := currentSpace(c)
+	project.UserID, project.WorkspaceID = sp.userID, sp.workspaceID
+	if project.Position == 0 {
+		var last struct{ Max int }
+		database.DB.Model(&models.Project{}).Scopes(sp.scope).Select("COALESCE(MAX(position), 0) AS max").Scan(&last)
+		project.Position = last.Max + 1
+	}
+
+	if err := database.DB.Create(&project).Error; err != nil {
+		log.Println("Error while creating project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать проект"})
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+// UpdateProject godoc
+// @Summary Update a project
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   id       path     int             true  "Project ID"
+// @Param   project  body     ProjectInput  true  "Project"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /projects/{id} [put]
+func UpdateProject(c *gin.Context) {
+	var project models.Project
+	if !findProject(c, &project) {
+		return
+	}
+	input := projectInputOf(&project)
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.apply(&project)
+	if err := validateProject(&project); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&project).Error; err != nil {
+		log.Println("Error while updating project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить проект"})
+		return
+	}
+	c.JSON(http.StatusOK, project)
+}
+
+// DeleteProject godoc
+// @Summary Delete a project
+// @Description Delete a project. A project with tasks is deleted together with them when cascade=true, otherwise the request fails with 409.
+// @Tags projects
+// @Produce  json
+// @Param   id       path     int   true   "Project ID"
+// @Param   cascade  query    bool  false  "Delete the project tasks too"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /projects/{id} [delete]
+func DeleteProject(c *gin.Context) {
+	var project models.Project
+	if !findProject(c, &project) {
+		return
+	}
+	cascade, _ := strconv.ParseBool(c.Query("cascade"))
+
+	errHasToDos := errors.New("project has tasks")
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		todos := tx.Model(&models.ToDo{}).Where("project_id = ?", project.ID)
+		if cascade {
+			if err := todos.Delete(&models.ToDo{}).Error; err != nil {
+				return err
+			}
+		} else {
+			var count int64
+			if err := todos.Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errHasToDos
+			}
+		}
+		if err := tx.Unscoped().Where("project_id = ?", project.ID).Delete(&models.Share{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&project).Error
+	})
+
+	switch {
+	case errors.Is(err, errHasToDos):
+		c.JSON(http.StatusConflict, gin.H{"error": "Project has tasks, use cascade=true to delete them"})
+	case err != nil:
+		log.Println("Error while deleting project:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось удалить проект"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Проект удалён"})
+	}
+}
+
+// GetProjectToDos godoc
+// @Summary List project ToDos
+// @Description List ToDo items of a project. Accepts the same filters and pagination as GET /todos.
+// @Tags projects
+// @Produce  json
+// @Param   id  path     int  true  "Project ID"
+// @Success 200 {array} models.ToDo
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /projects/{id}/todos [get]
+func GetProjectToDos(c *gin.Context) {
+	var project models.Project
+	if !findProject(c, &project) {
+		return
+	}
+	listToDos(c, space{userID: project.UserID, workspaceID: project.WorkspaceID}.scope, func(db *gorm.DB) *gorm.DB {
+		return db.Where("project_id = ?", project.ID)
+	})
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupProjectRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/projects", GetProjects)
+	router.POST("/projects", CreateProject)
+	router.GET("/projects/:id", GetProject)
+	router.PUT("/projects/:id", UpdateProject)
+	router.DELETE("/projects/:id", DeleteProject)
+	router.GET("/projects/:id/todos", GetProjectToDos)
+	router.POST("/todos", CreateToDo)
+	router.PUT("/todos/:id", UpdateToDo)
+	router.PATCH("/todos/:id", PatchToDo)
+	return router
+}
+
+func doJSON(router *gin.Engine, method, url, body string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if body == "" {
+		req, _ = http.NewRequest(method, url, nil)
+	} else {
+		req, _ = http.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func idPath(prefix string, id uint) string {
+	return prefix + "/" + strconv.FormatUint(uint64(id), 10)
+}
+
+func TestCreateAndListProjects(t *testing.T) {
+	user := setupTestDB()
+	router := setupProjectRouter(user)
+
+	w := doJSON(router, "POST", "/projects", `{"name":"Work","color":"#ff8800"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(router, "POST", "/projects", `{"name":"Home","archived":true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var home models.Project
+	json.Unmarshal(w.Body.Bytes(), &home)
+	assert.Equal(t, user.ID, home.UserID)
+	assert.Equal(t, 2, home.Position)
+
+	// Без имени и с неверным цветом проект не создаётся
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/projects", `{"color":"#ff8800"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/projects", `{"name":"Bad","color":"red"}`).Code)
+
+	w = doJSON(router, "GET", "/projects?archived=false", "")
+	var projects []models.Project
+	json.Unmarshal(w.Body.Bytes(), &projects)
+	assert.Len(t, projects, 1)
+	assert.Equal(t, "Work", projects[0].Name)
+}
+
+func TestProjectSystemFieldsAreIgnored(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+	router := setupProjectRouter(user)
+
+	w := doJSON(router, "POST", "/projects", `{"name":"Work","ID":99,"user_id":`+strconv.Itoa(int(other.ID))+`,"CreatedAt":"2020-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var project models.Project
+	json.Unmarshal(w.Body.Bytes(), &project)
+	assert.NotEqual(t, uint(99), project.ID)
+	assert.Equal(t, user.ID, project.UserID)
+	assert.Equal(t, 1, project.Position)
+	assert.NotEqual(t, 2020, project.CreatedAt.Year())
+
+	// PUT меняет только поля из запроса и не трогает системные
+	w = doJSON(router, "PUT", idPath("/projects", project.ID), `{"name":"Office","DeletedAt":"2020-01-01T00:00:00Z","CreatedAt":"2020-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var saved models.Project
+	assert.NoError(t, database.DB.First(&saved, project.ID).Error)
+	assert.Equal(t, "Office", saved.Name)
+	assert.Equal(t, 1, saved.Position)
+	assert.Equal(t, project.CreatedAt.Unix(), saved.CreatedAt.Unix())
+}
+
+func TestForeignProjectIsNotFound(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+	router := setupProjectRouter(user)
+
+	foreign := models.Project{UserID: other.ID, Name: "Secret"}
+	database.DB.Create(&foreign)
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", idPath("/projects", foreign.ID), "").Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "PUT", idPath("/projects", foreign.ID), `{"name":"Mine"}`).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "DELETE", idPath("/projects", foreign.ID), "").Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", idPath("/projects", foreign.ID)+"/todos", "").Code)
+
+	// Задачу нельзя положить в чужой проект
+	body := `{"title":"Task","project_id":` + strconv.FormatUint(uint64(foreign.ID), 10) + `}`
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/todos", body).Code)
+}
+
+func TestMoveToDoBetweenProjects(t *testing.T) {
+	user := setupTestDB()
+	router := setupProjectRouter(user)
+
+	work := models.Project{UserID: user.ID, Name: "Work"}
+	home := models.Project{UserID: user.ID, Name: "Home"}
+	database.DB.Create(&work)
+	database.DB.Create(&home)
+
+	todo := models.ToDo{UserID: user.ID, Title: "Task", ProjectID: &work.ID}
+	database.DB.Create(&todo)
+
+	body := `{"project_id":` + strconv.FormatUint(uint64(home.ID), 10) + `}`
+	assert.Equal(t, http.StatusOK, doJSON(router, "PATCH", idPath("/todos", todo.ID), body).Code)
+
+	w := doJSON(router, "GET", idPath("/projects", home.ID)+"/todos", "")
+	var todos []models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todos)
+	assert.Len(t, todos, 1)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+
+	w = doJSON(router, "GET", idPath("/projects", work.ID)+"/todos", "")
+	json.Unmarshal(w.Body.Bytes(), &todos)
+	assert.Empty(t, todos)
+
+	// null убирает задачу из проекта
+	assert.Equal(t, http.StatusOK, doJSON(router, "PATCH", idPath("/todos", todo.ID), `{"project_id":null}`).Code)
+	var stored models.ToDo
+	database.DB.First(&stored, todo.ID)
+	assert.Nil(t, stored.ProjectID)
+}
+
+func TestDeleteProjectCascade(t *testing.T) {
+	user := setupTestDB()
+	router := setupProjectRouter(user)
+
+	project := models.Project{UserID: user.ID, Name: "Work"}
+	database.DB.Create(&project)
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Task", ProjectID: &project.ID})
+
+	// Без cascade проект с задачами не удаляется
+	assert.Equal(t, http.StatusConflict, doJSON(router, "DELETE", idPath("/projects", project.ID), "").Code)
+	assert.NoError(t, database.DB.First(&models.Project{}, project.ID).Error)
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", idPath("/projects", project.ID)+"?cascade=true", "").Code)
+	assert.Error(t, database.DB.First(&models.Project{}, project.ID).Error)
+
+	var count int64
+	database.DB.Model(&models.ToDo{}).Count(&count)
+	assert.Zero(t, count)
+
+	// Пустой проект удаляется и без cascade
+	empty := models.Project{UserID: user.ID, Name: "Empty"}
+	database.DB.Create(&empty)
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", idPath("/projects", empty.ID), "").Code)
+}
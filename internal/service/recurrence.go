@@ -0,0 +1,337 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrencePeriods ограничивает перебор периодов для правил, которые редко или никогда не срабатывают
+const maxRecurrencePeriods = 10000
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// weekdayNum — элемент BYDAY: день недели и необязательный порядковый номер (2TU, -1FR)
+type weekdayNum struct {
+	n   int
+	day time.Weekday
+}
+
+// recurrenceRule — разобранное правило RRULE (RFC 5545). Поддерживаются FREQ от DAILY до YEARLY,
+// INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY и BYMONTH.
+type recurrenceRule struct {
+	freq       string
+	interval   int
+	count      int
+	until      *time.Time
+	byDay      []weekdayNum
+	byMonthDay []int
+	byMonth    []time.Month
+}
+
+// parseRecurrence разбирает строку RRULE. Дата UNTIL без времени означает конец дня в поясе loc.
+func parseRecurrence(s string, loc *time.Location) (*recurrenceRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	rule := &recurrenceRule{interval: 1}
+	seen := map[string]bool{}
+
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(name)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid recurrence part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("recurrence part %s is repeated", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			rule.freq = strings.ToUpper(value)
+		case "INTERVAL":
+			rule.interval, err = strconv.Atoi(value)
+			if err == nil && rule.interval < 1 {
+				err = errors.New("must be positive")
+			}
+		case "COUNT":
+			rule.count, err = strconv.Atoi(value)
+			if err == nil && rule.count < 1 {
+				err = errors.New("must be positive")
+			}
+		case "UNTIL":
+			rule.until, err = parseUntil(value, loc)
+		case "BYDAY":
+			rule.byDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			rule.byMonthDay, err = parseIntList(value, -31, 31)
+		case "BYMONTH":
+			var months []int
+			months, err = parseIntList(value, 1, 12)
+			for _, m := range months {
+				rule.byMonth = append(rule.byMonth, time.Month(m))
+			}
+		case "WKST":
+			// Недели всегда начинаются с понедельника, как и в фильтре due=week
+			if strings.ToUpper(value) != "MO" {
+				err = errors.New("only MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported recurrence part %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recurrence %s: %v", name, err)
+		}
+	}
+
+	switch rule.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	case "":
+		return nil, errors.New("recurrence FREQ is required")
+	default:
+		return nil, fmt.Errorf("unsupported recurrence frequency %s", rule.freq)
+	}
+	if rule.count > 0 && rule.until != nil {
+		return nil, errors.New("recurrence cannot have both COUNT and UNTIL")
+	}
+	if rule.freq == "WEEKLY" && len(rule.byMonthDay) > 0 {
+		return nil, errors.New("BYMONTHDAY cannot be used with weekly recurrence")
+	}
+	for _, wd := range rule.byDay {
+		if wd.n != 0 && (rule.freq == "DAILY" || rule.freq == "WEEKLY" || len(rule.byMonthDay) > 0) {
+			return nil, errors.New("numbered BYDAY is only allowed in monthly and yearly recurrence without BYMONTHDAY")
+		}
+	}
+	return rule, nil
+}
+
+func parseUntil(value string, loc *time.Location) (*time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return &t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return &t, nil
+	}
+	day, err := time.ParseInLocation("20060102", value, loc)
+	if err != nil {
+		return nil, errors.New("must be a date or a date-time")
+	}
+	until := day.AddDate(0, 0, 1).Add(-time.Second)
+	return &until, nil
+}
+
+func parseByDay(value string) ([]weekdayNum, error) {
+	var result []weekdayNum
+	for _, item := range strings.Split(strings.ToUpper(value), ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("unknown weekday %q", item)
+		}
+		day, ok := weekdayCodes[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", item)
+		}
+		wd := weekdayNum{day: day}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, fmt.Errorf("invalid weekday number in %q", item)
+			}
+			wd.n = n
+		}
+		result = append(result, wd)
+	}
+	return result, nil
+}
+
+func parseIntList(value string, min, max int) ([]int, error) {
+	var result []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || n == 0 || n < min || n > max {
+			return nil, fmt.Errorf("%q must be between %d and %d", item, min, max)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// occurrences возвращает до n повторений, наступающих строго после after.
+// start — первое повторение серии (DTSTART) в часовом поясе задачи, оно же первое по COUNT.
+// Повторения сохраняют время суток start, поэтому переход на летнее время не сдвигает их.
+func (r *recurrenceRule) occurrences(start, after time.Time, n int) []time.Time {
+	var result []time.Time
+	emitted := 1
+	if start.After(after) {
+		result = append(result, start)
+	}
+
+	base := civilDate(start)
+	for period := 0; period < maxRecurrencePeriods && len(result) < n; period++ {
+		for _, day := range r.periodDays(base, period) {
+			t := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+			if !t.After(start) {
+				continue
+			}
+			if r.until != nil && t.After(*r.until) {
+				return result
+			}
+			emitted++
+			if r.count > 0 && emitted > r.count {
+				return result
+			}
+			if t.After(after) {
+				result = append(result, t)
+				if len(result) == n {
+					return result
+				}
+			}
+		}
+	}
+	return result
+}
+
+// civilDate возвращает календарную дату t в виде полуночи UTC, чтобы считать дни без учёта перевода часов
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// periodDays возвращает отсортированные дни повторений в периоде с номером period от base
+func (r *recurrenceRule) periodDays(base time.Time, period int) []time.Time {
+	step := period * r.interval
+	var days []time.Time
+
+	switch r.freq {
+	case "DAILY":
+		day := base.AddDate(0, 0, step)
+		if r.matchesMonth(day) && r.matchesMonthDay(day) && r.matchesWeekday(day) {
+			days = append(days, day)
+		}
+	case "WEEKLY":
+		monday := base.AddDate(0, 0, -mondayOffset(base)+7*step)
+		if len(r.byDay) == 0 {
+			days = append(days, monday.AddDate(0, 0, mondayOffset(base)))
+		}
+		for _, wd := range r.byDay {
+			days = append(days, monday.AddDate(0, 0, (int(wd.day)+6)%7))
+		}
+		days = slices.DeleteFunc(days, func(day time.Time) bool { return !r.matchesMonth(day) })
+	case "MONTHLY":
+		month := time.Date(base.Year(), base.Month()+time.Month(step), 1, 0, 0, 0, 0, time.UTC)
+		if r.matchesMonth(month) {
+			days = r.monthDays(month, base)
+		}
+	case "YEARLY":
+		year := base.Year() + step
+		if len(r.byDay) > 0 && len(r.byMonth) == 0 && len(r.byMonthDay) == 0 {
+			// Без BYMONTH номер дня недели считается от начала года
+			first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+			for _, wd := range r.byDay {
+				days = append(days, weekdaysIn(first, first.AddDate(1, 0, 0), wd)...)
+			}
+			break
+		}
+		months := r.byMonth
+		switch {
+		case len(months) > 0:
+		case len(r.byMonthDay) > 0:
+			// BYMONTHDAY без BYMONTH повторяется в каждом месяце года
+			for m := time.January; m <= time.December; m++ {
+				months = append(months, m)
+			}
+		default:
+			months = []time.Month{base.Month()}
+		}
+		for _, m := range months {
+			days = append(days, r.monthDays(time.Date(year, m, 1, 0, 0, 0, 0, time.UTC), base)...)
+		}
+	}
+
+	slices.SortFunc(days, func(a, b time.Time) int { return a.Compare(b) })
+	return slices.CompactFunc(days, func(a, b time.Time) bool { return a.Equal(b) })
+}
+
+// monthDays возвращает дни повторений в месяце, начинающемся с first
+func (r *recurrenceRule) monthDays(first, base time.Time) []time.Time {
+	next := first.AddDate(0, 1, 0)
+	last := next.AddDate(0, 0, -1).Day()
+	var days []time.Time
+
+	switch {
+	case len(r.byMonthDay) > 0:
+		for _, md := range r.byMonthDay {
+			if md < 0 {
+				md += last + 1
+			}
+			if md >= 1 && md <= last {
+				days = append(days, first.AddDate(0, 0, md-1))
+			}
+		}
+		days = slices.DeleteFunc(days, func(day time.Time) bool { return !r.matchesWeekday(day) })
+	case len(r.byDay) > 0:
+		for _, wd := range r.byDay {
+			days = append(days, weekdaysIn(first, next, wd)...)
+		}
+	case base.Day() <= last:
+		// Месяцы без такого числа пропускаются, как того требует RFC 5545
+		days = append(days, first.AddDate(0, 0, base.Day()-1))
+	}
+	return days
+}
+
+// weekdaysIn возвращает дни недели wd.day в промежутке [from, to), а при заданном номере — только n-й из них
+func weekdaysIn(from, to time.Time, wd weekdayNum) []time.Time {
+	var days []time.Time
+	day := from.AddDate(0, 0, (int(wd.day)-int(from.Weekday())+7)%7)
+	for ; day.Before(to); day = day.AddDate(0, 0, 7) {
+		days = append(days, day)
+	}
+	switch {
+	case wd.n > 0 && wd.n <= len(days):
+		return days[wd.n-1 : wd.n]
+	case wd.n < 0 && -wd.n <= len(days):
+		return days[len(days)+wd.n : len(days)+wd.n+1]
+	case wd.n != 0:
+		return nil
+	}
+	return days
+}
+
+func mondayOffset(day time.Time) int {
+	return (int(day.Weekday()) + 6) % 7
+}
+
+func (r *recurrenceRule) matchesMonth(day time.Time) bool {
+	return len(r.byMonth) == 0 || slices.Contains(r.byMonth, day.Month())
+}
+
+func (r *recurrenceRule) matchesMonthDay(day time.Time) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, md := range r.byMonthDay {
+		if md == day.Day() || md+last+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *recurrenceRule) matchesWeekday(day time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	for _, wd := range r.byDay {
+		if wd.day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
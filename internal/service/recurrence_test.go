@@ -0,0 +1,111 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func occurrenceDates(t *testing.T, rrule string, start time.Time, n int) []string {
+	rule, err := parseRecurrence(rrule, start.Location())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dates []string
+	for _, occ := range rule.occurrences(start, start, n) {
+		dates = append(dates, occ.Format("2006-01-02"))
+	}
+	return dates
+}
+
+func TestRecurrenceFrequencies(t *testing.T) {
+	// Среда 31 января 2024 года
+	start := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, []string{"2024-02-02", "2024-02-04", "2024-02-06"},
+		occurrenceDates(t, "FREQ=DAILY;INTERVAL=2", start, 3))
+	assert.Equal(t, []string{"2024-02-02", "2024-02-05", "2024-02-07", "2024-02-09"},
+		occurrenceDates(t, "RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR", start, 4))
+	assert.Equal(t, []string{"2024-02-14", "2024-02-28"},
+		occurrenceDates(t, "FREQ=WEEKLY;INTERVAL=2", start, 2))
+
+	// Месяцы без 31 числа пропускаются
+	assert.Equal(t, []string{"2024-03-31", "2024-05-31", "2024-07-31"},
+		occurrenceDates(t, "FREQ=MONTHLY", start, 3))
+	assert.Equal(t, []string{"2024-02-29", "2024-03-31"},
+		occurrenceDates(t, "FREQ=MONTHLY;BYMONTHDAY=-1", start, 2))
+
+	// Второй вторник и последняя пятница месяца
+	assert.Equal(t, []string{"2024-02-13", "2024-03-12", "2024-04-09"},
+		occurrenceDates(t, "FREQ=MONTHLY;BYDAY=2TU", start, 3))
+	assert.Equal(t, []string{"2024-02-23", "2024-03-29"},
+		occurrenceDates(t, "FREQ=MONTHLY;BYDAY=-1FR", start, 2))
+
+	// День благодарения: четвёртый четверг ноября
+	assert.Equal(t, []string{"2024-11-28", "2025-11-27"},
+		occurrenceDates(t, "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", start, 2))
+	assert.Equal(t, []string{"2025-01-31", "2026-01-31"},
+		occurrenceDates(t, "FREQ=YEARLY", start, 2))
+}
+
+func TestRecurrenceCountAndUntil(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	// Начало серии считается первым повторением
+	assert.Equal(t, []string{"2024-01-02", "2024-01-03"},
+		occurrenceDates(t, "FREQ=DAILY;COUNT=3", start, 10))
+	assert.Equal(t, []string{"2024-01-08", "2024-01-15"},
+		occurrenceDates(t, "FREQ=WEEKLY;UNTIL=20240115", start, 10))
+	assert.Equal(t, []string{"2024-01-08"},
+		occurrenceDates(t, "FREQ=WEEKLY;UNTIL=20240115T080000Z", start, 10))
+
+	// COUNT отсчитывается от начала серии, а не от текущего повторения
+	rule, _ := parseRecurrence("FREQ=DAILY;COUNT=3", time.UTC)
+	assert.Len(t, rule.occurrences(start, start.AddDate(0, 0, 1), 10), 1)
+	assert.Empty(t, rule.occurrences(start, start.AddDate(0, 0, 2), 10))
+
+	// Правило, которое никогда не срабатывает, не зацикливается
+	rule, _ = parseRecurrence("FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", time.UTC)
+	assert.Empty(t, rule.occurrences(start, start, 1))
+}
+
+func TestRecurrenceKeepsWallClockAcrossDST(t *testing.T) {
+	loc, _ := time.LoadLocation("Europe/Berlin")
+	// Переход на летнее время 31 марта 2024 года
+	start := time.Date(2024, 3, 29, 9, 0, 0, 0, loc)
+
+	rule, err := parseRecurrence("FREQ=DAILY", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	occurrences := rule.occurrences(start, start, 3)
+	if !assert.Len(t, occurrences, 3) {
+		t.FailNow()
+	}
+	for _, occ := range occurrences {
+		assert.Equal(t, 9, occ.Hour())
+	}
+	assert.Equal(t, time.Date(2024, 3, 30, 8, 0, 0, 0, time.UTC), occurrences[0].UTC())
+	assert.Equal(t, time.Date(2024, 3, 31, 7, 0, 0, 0, time.UTC), occurrences[1].UTC())
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	for _, rrule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20240101",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=2MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYSETPOS=1",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;WKST=SU",
+	} {
+		_, err := parseRecurrence(rrule, time.UTC)
+		assert.Error(t, err, rrule)
+	}
+}
@@ -0,0 +1,422 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ShareInput — приглашение пользователя к задаче или проекту
+type ShareInput struct {
+	Username   string            `json:"username" binding:"required"`
+	Permission models.Permission `json:"permission" binding:"required"`
+}
+
+// acceptedShares ограничивает запрос принятыми приглашениями пользователя
+func acceptedShares(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ? AND accepted_at IS NOT NULL", userID)
+	}
+}
+
+// Access — владелец ресурса, его рабочее пространство и права текущего пользователя на ресурс
+type Access struct {
+	OwnerID     uint
+	WorkspaceID *uint
+	Permission  models.Permission
+}
+
+// workspacePermission возвращает права, которые пользователю даёт роль в рабочем пространстве ресурса
+func workspacePermission(userID uint, workspaceID *uint) (models.Permission, error) {
+	if workspaceID == nil {
+		return models.PermissionNone, nil
+	}
+	role, err := WorkspaceRoleOf(userID, *workspaceID)
+	return role.Permission(), err
+}
+
+// ToDoAccess находит задачу, в том числе удалённую, и возвращает её владельца и права пользователя на неё.
+// Владелец личной задачи — её автор. В рабочем пространстве права дают роль участника
+// и приглашения: берутся наибольшие из роли и приглашений к самой задаче, её родителям и её проекту.
+func ToDoAccess(userID uint, id string) (Access, error) {
+	var todo models.ToDo
+	err := database.DB.Unscoped().Select("id", "user_id", "workspace_id", "parent_id", "project_id").First(&todo, id).Error
+	if err != nil {
+		return Access{}, err
+	}
+	access := Access{OwnerID: todo.UserID, WorkspaceID: todo.WorkspaceID}
+	if todo.UserID == userID && todo.WorkspaceID == nil {
+		access.Permission = models.PermissionOwner
+		return access, nil
+	}
+	if access.Permission, err = workspacePermission(userID, todo.WorkspaceID); err != nil {
+		return access, err
+	}
+
+	ids := []uint{todo.ID}
+	if todo.ParentID != nil {
+		// Испорченная цепочка родителей не мешает проверить приглашение к самой задаче
+		chain, _ := parentChain(database.DB, spaceOf(&todo), *todo.ParentID)
+		ids = append(ids, chain...)
+	}
+	shared := database.DB.Where("to_do_id IN ?", ids)
+	if todo.ProjectID != nil {
+		shared = shared.Or("project_id = ?", *todo.ProjectID)
+	}
+	var permission models.Permission
+	err = database.DB.Model(&models.Share{}).Scopes(acceptedShares(userID)).Where(shared).
+		Select("COALESCE(MAX(permission), 0)").Scan(&permission).Error
+	access.Permission = max(access.Permission, permission)
+	return access, err
+}
+
+// ProjectAccess находит проект и возвращает его владельца и права пользователя на него.
+// Права считаются так же, как у задач.
+func ProjectAccess(userID uint, id string) (Access, error) {
+	var project models.Project
+	if err := database.DB.Select("id", "user_id", "workspace_id").First(&project, id).Error; err != nil {
+		return Access{}, err
+	}
+	access := Access{OwnerID: project.UserID, WorkspaceID: project.WorkspaceID}
+	if project.UserID == userID && project.WorkspaceID == nil {
+		access.Permission = models.PermissionOwner
+		return access, nil
+	}
+	var err error
+	if access.Permission, err = workspacePermission(userID, project.WorkspaceID); err != nil {
+		return access, err
+	}
+	var permission models.Permission
+	err = database.DB.Model(&models.Share{}).Scopes(acceptedShares(userID)).Where("project_id = ?", project.ID).
+		Select("COALESCE(MAX(permission), 0)").Scan(&permission).Error
+	access.Permission = max(access.Permission, permission)
+	return access, err
+}
+
+// InvitationAccess находит приглашение. Распоряжаться им может только приглашённый пользователь.
+func InvitationAccess(userID uint, id string) (Access, error) {
+	var share models.Share
+	if err := database.DB.Select("id", "user_id").First(&share, id).Error; err != nil {
+		return Access{}, err
+	}
+	if share.UserID != userID {
+		return Access{OwnerID: share.UserID}, nil
+	}
+	return Access{OwnerID: userID, Permission: models.PermissionOwner}, nil
+}
+
+// createShare приглашает пользователя из тела запроса к ресурсу share и отвечает клиенту.
+// Повторное приглашение того же пользователя меняет его права.
+func createShare(c *gin.Context, share models.Share) {
+	var input ShareInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var user models.User
+	if err := database.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+	if user.ID == share.OwnerID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot share with the owner"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(&models.Share{UserID: user.ID, ToDoID: share.ToDoID, ProjectID: share.ProjectID}).First(&share).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		share.UserID, share.Permission = user.ID, input.Permission
+		return tx.Save(&share).Error
+	})
+	if err != nil {
+		log.Println("Error while sharing:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось открыть доступ"})
+		return
+	}
+	share.Username = user.Username
+	c.JSON(http.StatusOK, share)
+}
+
+// listShares отвечает списком приглашений к ресурсу с именами приглашённых
+func listShares(c *gin.Context, query *gorm.DB) {
+	var shares []models.Share
+	if err := query.Order("id").Find(&shares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить приглашения"})
+		return
+	}
+	if err := fillShareUsers(shares); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить приглашения"})
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
+
+// fillShareUsers заполняет имена приглашённых пользователей и владельцев
+func fillShareUsers(shares []models.Share) error {
+	var ids []uint
+	for _, share := range shares {
+		ids = append(ids, share.UserID, share.OwnerID)
+	}
+	var users []models.User
+	if err := database.DB.Select("id", "username").Find(&users, ids).Error; err != nil {
+		return err
+	}
+	names := make(map[uint]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	for i := range shares {
+		shares[i].Username = names[shares[i].UserID]
+		shares[i].Owner = names[shares[i].OwnerID]
+	}
+	return nil
+}
+
+// revokeShare удаляет приглашение id из отобранных query
+func revokeShare(c *gin.Context, query *gorm.DB, id string) {
+	result := query.Unscoped().Where("id = ?", id).Delete(&models.Share{})
+	if result.Error != nil {
+		log.Println("Error while revoking share:", result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось закрыть доступ"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Приглашение не найдено"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Доступ закрыт"})
+}
+
+// fillSharedResources загружает задачи и проекты приглашений. Приглашения к удалённым ресурсам пропускаются.
+func fillSharedResources(shares []models.Share) ([]models.Share, error) {
+	var todoIDs, projectIDs []uint
+	for _, share := range shares {
+		if share.ToDoID != nil {
+			todoIDs = append(todoIDs, *share.ToDoID)
+		}
+		if share.ProjectID != nil {
+			projectIDs = append(projectIDs, *share.ProjectID)
+		}
+	}
+	var todos []models.ToDo
+	if err := database.DB.Preload("Tags").Find(&todos, todoIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := attachProgress(database.DB, todos); err != nil {
+		return nil, err
+	}
+	var projects []models.Project
+	if err := database.DB.Find(&projects, projectIDs).Error; err != nil {
+		return nil, err
+	}
+
+	todoByID := make(map[uint]*models.ToDo, len(todos))
+	for i := range todos {
+		todoByID[todos[i].ID] = &todos[i]
+	}
+	projectByID := make(map[uint]*models.Project, len(projects))
+	for i := range projects {
+		projectByID[projects[i].ID] = &projects[i]
+	}
+
+	result := make([]models.Share, 0, len(shares))
+	for _, share := range shares {
+		if share.ToDoID != nil {
+			share.ToDo = todoByID[*share.ToDoID]
+		}
+		if share.ProjectID != nil {
+			share.Project = projectByID[*share.ProjectID]
+		}
+		if share.ToDo != nil || share.Project != nil {
+			result = append(result, share)
+		}
+	}
+	return result, fillShareUsers(result)
+}
+
+// ShareToDo godoc
+// @Summary Share a ToDo
+// @Description Invite a user to a ToDo item and its subtasks as viewer, editor or owner. Inviting the same user again changes the permission.
+// @Tags sharing
+// @Accept  json
+// @Produce  json
+// @Param   id     path     int         true  "ToDo ID"
+// @Param   share  body     ShareInput  true  "Invitation"
+// @Success 200 {object} models.Share
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /todos/{id}/shares [post]
+func ShareToDo(c *gin.Context) {
+	var todo models.ToDo
+	if err := database.DB.Scopes(ownedBy(resourceOwnerID(c))).First(&todo, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+		return
+	}
+	createShare(c, models.Share{OwnerID: todo.UserID, ToDoID: &todo.ID})
+}
+
+// GetToDoShares godoc
+// @Summary List ToDo shares
+// @Description List invitations to a ToDo item, both pending and accepted
+// @Tags sharing
+// @Produce  json
+// @Param   id  path     int  true  "ToDo ID"
+// @Success 200 {array} models.Share
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /todos/{id}/shares [get]
+func GetToDoShares(c *gin.Context) {
+	listShares(c, database.DB.Where("to_do_id = ?", c.Param("id")))
+}
+
+// RevokeToDoShare godoc
+// @Summary Revoke a ToDo share
+// @Tags sharing
+// @Produce  json
+// @Param   id       path     int  true  "ToDo ID"
+// @Param   shareId  path     int  true  "Share ID"
+// @Success 200 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /todos/{id}/shares/{shareId} [delete]
+func RevokeToDoShare(c *gin.Context) {
+	revokeShare(c, database.DB.Where("to_do_id = ?", c.Param("id")), c.Param("shareId"))
+}
+
+// ShareProject godoc
+// @Summary Share a project
+// @Description Invite a user to a project and all its ToDo items as viewer, editor or owner. Inviting the same user again changes the permission.
+// @Tags sharing
+// @Accept  json
+// @Produce  json
+// @Param   id     path     int         true  "Project ID"
+// @Param   share  body     ShareInput  true  "Invitation"
+// @Success 200 {object} models.Share
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /projects/{id}/shares [post]
+func ShareProject(c *gin.Context) {
+	var project models.Project
+	if !findProject(c, &project) {
+		return
+	}
+	createShare(c, models.Share{OwnerID: project.UserID, ProjectID: &project.ID})
+}
+
+// GetProjectShares godoc
+// @Summary List project shares
+// @Description List invitations to a project, both pending and accepted
+// @Tags sharing
+// @Produce  json
+// @Param   id  path     int  true  "Project ID"
+// @Success 200 {array} models.Share
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /projects/{id}/shares [get]
+func GetProjectShares(c *gin.Context) {
+	listShares(c, database.DB.Where("project_id = ?", c.Param("id")))
+}
+
+// RevokeProjectShare godoc
+// @Summary Revoke a project share
+// @Tags sharing
+// @Produce  json
+// @Param   id       path     int  true  "Project ID"
+// @Param   shareId  path     int  true  "Share ID"
+// @Success 200 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /projects/{id}/shares/{shareId} [delete]
+func RevokeProjectShare(c *gin.Context) {
+	revokeShare(c, database.DB.Where("project_id = ?", c.Param("id")), c.Param("shareId"))
+}
+
+// GetInvitations godoc
+// @Summary List invitations
+// @Description List pending invitations of the current user with the shared ToDo items and projects
+// @Tags sharing
+// @Produce  json
+// @Success 200 {array} models.Share
+// @Failure 500 {object} gin.H
+// @Router /invitations [get]
+func GetInvitations(c *gin.Context) {
+	respondShares(c, database.DB.Where("user_id = ? AND accepted_at IS NULL", currentUserID(c)))
+}
+
+// GetShared godoc
+// @Summary List shared items
+// @Description List ToDo items and projects other users have shared with the current user, with the permission for each
+// @Tags sharing
+// @Produce  json
+// @Success 200 {array} models.Share
+// @Failure 500 {object} gin.H
+// @Router /shared [get]
+func GetShared(c *gin.Context) {
+	respondShares(c, database.DB.Scopes(acceptedShares(currentUserID(c))))
+}
+
+func respondShares(c *gin.Context, query *gorm.DB) {
+	var shares []models.Share
+	if err := query.Order("id").Find(&shares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить приглашения"})
+		return
+	}
+	shares, err := fillSharedResources(shares)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить приглашения"})
+		return
+	}
+	c.JSON(http.StatusOK, shares)
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an invitation
+// @Tags sharing
+// @Produce  json
+// @Param   id  path     int  true  "Invitation ID"
+// @Success 200 {object} models.Share
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /invitations/{id}/accept [post]
+func AcceptInvitation(c *gin.Context) {
+	var share models.Share
+	if err := database.DB.Where("user_id = ?", currentUserID(c)).First(&share, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Приглашение не найдено"})
+		return
+	}
+	if share.AcceptedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Приглашение уже принято"})
+		return
+	}
+	now := time.Now()
+	if err := database.DB.Model(&share).Update("accepted_at", &now).Error; err != nil {
+		log.Println("Error while accepting invitation:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось принять приглашение"})
+		return
+	}
+	c.JSON(http.StatusOK, share)
+}
+
+// DeclineInvitation godoc
+// @Summary Decline an invitation
+// @Description Decline a pending invitation or give up access to an item shared earlier
+// @Tags sharing
+// @Produce  json
+// @Param   id  path     int  true  "Invitation ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /invitations/{id}/decline [post]
+func DeclineInvitation(c *gin.Context) {
+	revokeShare(c, database.DB.Where("user_id = ?", currentUserID(c)), c.Param("id"))
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxTagLength = 64
+
+var errTagNotFound = errors.New("tag not found")
+
+type renameTagRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type mergeTagsRequest struct {
+	Sources []string `json:"sources" binding:"required"`
+	Target  string   `json:"target" binding:"required"`
+}
+
+// normalizeTagNames обрезает пробелы, убирает повторы и проверяет длину имён
+func normalizeTagNames(names []string) ([]string, error) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, errors.New("tag name must not be empty")
+		}
+		if len(name) > maxTagLength {
+			return nil, fmt.Errorf("tag name must be at most %d characters", maxTagLength)
+		}
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// TagNames — метки задачи во входных данных. Их можно передавать именами или объектами с полем name.
+type TagNames []string
+
+func (n *TagNames) UnmarshalJSON(data []byte) error {
+	var tags []models.Tag
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return err
+	}
+	if tags == nil {
+		*n = nil
+		return nil
+	}
+	names := make(TagNames, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	*n = names
+	return nil
+}
+
+// resolveTags находит метки пользователя по именам и создаёт недостающие
+func resolveTags(tx *gorm.DB, userID uint, names []string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	if len(names) == 0 {
+		return tags, nil
+	}
+	if err := tx.Where("user_id = ? AND name IN ?", userID, names).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	existing := map[string]bool{}
+	for _, tag := range tags {
+		existing[tag.Name] = true
+	}
+	for _, name := range names {
+		if existing[name] {
+			continue
+		}
+		tag := models.Tag{UserID: userID, Name: name}
+		if err := tx.Create(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// setToDoTags заменяет метки задачи. При names == nil метки не меняются, а только загружаются для ответа.
+func setToDoTags(tx *gorm.DB, todo *models.ToDo, names []string) error {
+	if names == nil {
+		todo.Tags = []models.Tag{}
+		return tx.Model(todo).Association("Tags").Find(&todo.Tags)
+	}
+
+	tags, err := resolveTags(tx, todo.UserID, names)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(todo).Association("Tags").Replace(tags); err != nil {
+		return err
+	}
+	todo.Tags = tags
+	return nil
+}
+
+// tagFilter отбирает задачи, у которых есть хотя бы одна (any) или все (all) метки из names
+func tagFilter(names []string, mode string) (func(*gorm.DB) *gorm.DB, error) {
+	if mode != "any" && mode != "all" {
+		return nil, errors.New("tag_mode must be any or all")
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		sub := db.Session(&gorm.Session{NewDB: true}).
+			Table("todo_tags").
+			Select("todo_tags.to_do_id").
+			Joins("JOIN tags ON tags.id = todo_tags.tag_id").
+			Where("tags.name IN ?", names)
+		if mode == "all" {
+			sub = sub.Group("todo_tags.to_do_id").Having("COUNT(DISTINCT tags.name) = ?", len(names))
+		}
+		return db.Where("id IN (?)", sub)
+	}, nil
+}
+
+// GetTags godoc
+// @Summary List tags
+// @Description List tags of the current user ordered by name
+// @Tags tags
+// @Produce  json
+// @Success 200 {array} models.Tag
+// @Router /tags [get]
+func GetTags(c *gin.Context) {
+	var tags []models.Tag
+	database.DB.Scopes(ownedBy(currentUserID(c))).Order("name").Find(&tags)
+	c.JSON(http.StatusOK, tags)
+}
+
+// RenameTag godoc
+// @Summary Rename a tag
+// @Description Rename a tag on all tasks of the current user. Renaming to the name of another tag fails with 409, merge the tags instead.
+// @Tags tags
+// @Accept  json
+// @Produce  json
+// @Param   id    path     int               true  "Tag ID"
+// @Param   body  body     renameTagRequest  true  "New name"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /tags/{id} [put]
+func RenameTag(c *gin.Context) {
+	var input renameTagRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	names, err := normalizeTagNames([]string{input.Name})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := currentUserID(c)
+	var tag models.Tag
+	if err := database.DB.Scopes(ownedBy(userID)).First(&tag, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Метка не найдена"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.Tag{}).Scopes(ownedBy(userID)).Where("name = ? AND id <> ?", names[0], tag.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tag with this name already exists, merge the tags instead"})
+		return
+	}
+
+	tag.Name = names[0]
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := bumpTaggedVersions(tx, []uint{tag.ID}); err != nil {
+			return err
+		}
+		return tx.Save(&tag).Error
+	})
+	if err != nil {
+		log.Println("Error while renaming tag:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось переименовать метку"})
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// MergeTags godoc
+// @Summary Merge tags
+// @Description Replace the source tags with the target tag on all tasks of the current user and delete the source tags. The target tag is created if it does not exist.
+// @Tags tags
+// @Accept  json
+// @Produce  json
+// @Param   body  body     mergeTagsRequest  true  "Source tag names and target tag name"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /tags/merge [post]
+func MergeTags(c *gin.Context) {
+	var input mergeTagsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sources, err := normalizeTagNames(input.Sources)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	targets, err := normalizeTagNames([]string{input.Target})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Целевая метка среди источников просто остаётся на месте
+	sources = slices.DeleteFunc(sources, func(name string) bool { return name == targets[0] })
+
+	userID := currentUserID(c)
+	var target models.Tag
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		sourceTags := []models.Tag{}
+		if len(sources) > 0 {
+			if err := tx.Scopes(ownedBy(userID)).Where("name IN ?", sources).Find(&sourceTags).Error; err != nil {
+				return err
+			}
+		}
+		if len(sourceTags) != len(sources) {
+			return errTagNotFound
+		}
+
+		resolved, err := resolveTags(tx, userID, targets)
+		if err != nil {
+			return err
+		}
+		target = resolved[0]
+
+		var sourceIDs []uint
+		for _, tag := range sourceTags {
+			sourceIDs = append(sourceIDs, tag.ID)
+		}
+		if len(sourceIDs) == 0 {
+			return nil
+		}
+
+		// Переносим связи на целевую метку, не дублируя уже существующие
+		if err := tx.Exec(`INSERT INTO todo_tags (to_do_id, tag_id)
+			SELECT DISTINCT to_do_id, CAST(? AS BIGINT) FROM todo_tags
+			WHERE tag_id IN ? AND to_do_id NOT IN (SELECT to_do_id FROM todo_tags WHERE tag_id = ?)`,
+			target.ID, sourceIDs, target.ID).Error; err != nil {
+			return err
+		}
+		if err := bumpTaggedVersions(tx, sourceIDs); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM todo_tags WHERE tag_id IN ?", sourceIDs).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Tag{}, sourceIDs).Error
+	})
+
+	switch {
+	case errors.Is(err, errTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Метка не найдена"})
+	case err != nil:
+		log.Println("Error while merging tags:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось объединить метки"})
+	default:
+		c.JSON(http.StatusOK, target)
+	}
+}
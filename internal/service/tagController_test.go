@@ -0,0 +1,157 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTagRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/todos", GetAllToDos)
+	router.POST("/todos", CreateToDo)
+	router.PUT("/todos/:id", UpdateToDo)
+	router.PATCH("/todos/:id", PatchToDo)
+	router.GET("/tags", GetTags)
+	router.PUT("/tags/:id", RenameTag)
+	router.POST("/tags/merge", MergeTags)
+	return router
+}
+
+func createTagged(t *testing.T, router *gin.Engine, body string) models.ToDo {
+	w := doJSON(router, "POST", "/todos", body)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var todo models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	return todo
+}
+
+func tagNamesOfToDo(todo models.ToDo) []string {
+	names := []string{}
+	for _, tag := range todo.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func TestToDoTagsInline(t *testing.T) {
+	user := setupTestDB()
+	router := setupTagRouter(user)
+
+	todo := createTagged(t, router, `{"title":"Task","tags":["work"," urgent ","work"]}`)
+	assert.ElementsMatch(t, []string{"work", "urgent"}, tagNamesOfToDo(todo))
+
+	// Без поля tags PATCH не меняет метки
+	w := doJSON(router, "PATCH", idPath("/todos", todo.ID), `{"title":"Renamed"}`)
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	assert.ElementsMatch(t, []string{"work", "urgent"}, tagNamesOfToDo(todo))
+
+	// Метки можно передавать и объектами
+	w = doJSON(router, "PATCH", idPath("/todos", todo.ID), `{"tags":[{"name":"home"}]}`)
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	assert.Equal(t, []string{"home"}, tagNamesOfToDo(todo))
+
+	w = doJSON(router, "PATCH", idPath("/todos", todo.ID), `{"tags":[]}`)
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	assert.Empty(t, todo.Tags)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/todos", `{"title":"Task","tags":[""]}`).Code)
+
+	// Метки не создаются заново для каждой задачи
+	createTagged(t, router, `{"title":"Other","tags":["work"]}`)
+	var count int64
+	database.DB.Model(&models.Tag{}).Where("name = ?", "work").Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestGetAllToDosTagFilter(t *testing.T) {
+	user := setupTestDB()
+	router := setupTagRouter(user)
+
+	createTagged(t, router, `{"title":"Both","tags":["work","urgent"]}`)
+	createTagged(t, router, `{"title":"Work only","tags":["work"]}`)
+	createTagged(t, router, `{"title":"Home","tags":["home"]}`)
+	createTagged(t, router, `{"title":"None"}`)
+
+	titles, _ := listTitles(t, router, "tags=work,urgent")
+	assert.Equal(t, []string{"Both", "Work only"}, titles)
+	titles, _ = listTitles(t, router, "tags=work,urgent&tag_mode=all")
+	assert.Equal(t, []string{"Both"}, titles)
+	titles, _ = listTitles(t, router, "tags=home,urgent&tag_mode=any")
+	assert.Equal(t, []string{"Both", "Home"}, titles)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/todos?tags=work&tag_mode=some", "").Code)
+}
+
+// toDoVersion возвращает текущую версию задачи, от которой зависит её ETag
+func toDoVersion(id uint) uint {
+	var todo models.ToDo
+	database.DB.Unscoped().Select("version").First(&todo, id)
+	return todo.Version
+}
+
+func TestRenameTag(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+	router := setupTagRouter(user)
+
+	todo := createTagged(t, router, `{"title":"Task","tags":["wrk"]}`)
+	home := createTagged(t, router, `{"title":"Task","tags":["home"]}`)
+	wrk := todo.Tags[0]
+
+	w := doJSON(router, "PUT", idPath("/tags", wrk.ID), `{"name":"work"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// Метки входят в представление задачи, поэтому ETag задачи с переименованной меткой меняется
+	assert.Equal(t, todo.Version+1, toDoVersion(todo.ID))
+	assert.Equal(t, home.Version, toDoVersion(home.ID))
+	titles, _ := listTitles(t, router, "tags=work")
+	assert.Equal(t, []string{"Task"}, titles)
+
+	assert.Equal(t, http.StatusConflict, doJSON(router, "PUT", idPath("/tags", wrk.ID), `{"name":"home"}`).Code)
+
+	foreign := models.Tag{UserID: other.ID, Name: "secret"}
+	database.DB.Create(&foreign)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "PUT", idPath("/tags", foreign.ID), `{"name":"mine"}`).Code)
+}
+
+func TestMergeTags(t *testing.T) {
+	user := setupTestDB()
+	router := setupTagRouter(user)
+
+	a := createTagged(t, router, `{"title":"A","tags":["wrk","job"]}`)
+	b := createTagged(t, router, `{"title":"B","tags":["job","work"]}`)
+	c := createTagged(t, router, `{"title":"C","tags":["home"]}`)
+
+	w := doJSON(router, "POST", "/tags/merge", `{"sources":["wrk","job","work"],"target":"work"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, a.Version+1, toDoVersion(a.ID))
+	assert.Equal(t, b.Version+1, toDoVersion(b.ID))
+	assert.Equal(t, c.Version, toDoVersion(c.ID))
+
+	titles, _ := listTitles(t, router, "tags=work")
+	assert.Equal(t, []string{"A", "B"}, titles)
+
+	w = doJSON(router, "GET", "/tags", "")
+	var tags []models.Tag
+	json.Unmarshal(w.Body.Bytes(), &tags)
+	assert.Equal(t, []string{"home", "work"}, tagNamesOfToDo(models.ToDo{Tags: tags}))
+
+	// Связи не дублируются
+	var links int64
+	database.DB.Table("todo_tags").Count(&links)
+	assert.Equal(t, int64(3), links)
+
+	// Несуществующий источник
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", "/tags/merge", `{"sources":["missing"],"target":"work"}`).Code)
+
+	// Имя после слияния снова свободно
+	todo := createTagged(t, router, `{"title":"D","tags":["job"]}`)
+	assert.Equal(t, []string{"job"}, tagNamesOfToDo(todo))
+}
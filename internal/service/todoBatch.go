@@ -0,0 +1,220 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// maxBatchOperations ограничивает число операций в одном пакетном запросе
+const maxBatchOperations = 500
+
+const (
+	batchAtomic     = "atomic"
+	batchBestEffort = "best_effort"
+)
+
+var (
+	errToDoNotFound    = errors.New("task not found")
+	errPermanentDelete = errors.New("only the owner can delete tasks permanently")
+)
+
+// BatchOperation — одна операция пакетного запроса.
+// create берёт задачу из todo, update применяет todo к задаче id как merge patch,
+// complete выполняет задачу id, delete удаляет её.
+type BatchOperation struct {
+	Op        string          `json:"op" binding:"required"`
+	ID        uint            `json:"id"`
+	ToDo      json.RawMessage `json:"todo"`
+	IfMatch   string          `json:"if_match"`
+	Cascade   bool            `json:"cascade"`
+	Permanent bool            `json:"permanent"`
+}
+
+// BatchRequest — тело POST /todos/batch
+type BatchRequest struct {
+	Mode       string           `json:"mode"`
+	Operations []BatchOperation `json:"operations" binding:"required"`
+}
+
+// BatchResult — результат одной операции: код как у отдельного запроса и задача или ошибка
+type BatchResult struct {
+	Index  int          `json:"index"`
+	Status int          `json:"status"`
+	ToDo   *models.ToDo `json:"todo,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// batchError переводит ошибку операции в код ответа и сообщение для клиента
+func batchError(err error) (int, string) {
+	var reqErr requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return http.StatusBadRequest, reqErr.Error()
+	case errors.Is(err, errToDoNotFound):
+		return http.StatusNotFound, "Задача не найдена"
+	case errors.Is(err, errPermanentDelete):
+		return http.StatusForbidden, err.Error()
+	case errors.Is(err, errVersionConflict):
+		return http.StatusPreconditionFailed, err.Error()
+	case errors.Is(err, errPatchTestFailed):
+		return http.StatusConflict, err.Error()
+	}
+	log.Printf("Не удалось выполнить операцию: %v", err)
+	return http.StatusInternalServerError, "Не удалось выполнить операцию"
+}
+
+// findBatchToDo загружает задачу пространства и проверяет if_match операции
+func findBatchToDo(tx *gorm.DB, sp space, op BatchOperation) (models.ToDo, error) {
+	var todo models.ToDo
+	if op.ID == 0 {
+		return todo, badRequest(errors.New("id is required"))
+	}
+	if err := tx.Scopes(sp.scope).Preload("Tags").First(&todo, op.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return todo, errToDoNotFound
+		}
+		return todo, err
+	}
+	if op.IfMatch != "" && !etagMatches(op.IfMatch, toDoETag(&todo), false) {
+		return todo, errVersionConflict
+	}
+	return todo, nil
+}
+
+// runBatchOperation выполняет одну операцию в транзакции tx с правами permission на пространство sp.
+// Для delete возвращает nil.
+func runBatchOperation(tx *gorm.DB, sp space, permission models.Permission, op BatchOperation) (*models.ToDo, error) {
+	switch op.Op {
+	case "create":
+		if op.ToDo == nil {
+			return nil, badRequest(errors.New("todo is required"))
+		}
+		var input ToDoInput
+		if err := json.Unmarshal(op.ToDo, &input); err != nil {
+			return nil, badRequest(err)
+		}
+		if err := binding.Validator.ValidateStruct(&input); err != nil {
+			return nil, badRequest(err)
+		}
+		todo, err := createToDo(tx, sp, input)
+		return &todo, err
+	case "update", "complete":
+		todo, err := findBatchToDo(tx, sp, op)
+		if err != nil {
+			return nil, err
+		}
+		var input ToDoInput
+		if op.Op == "complete" {
+			input = toDoInputOf(&todo)
+			input.Completed = true
+		} else {
+			if op.ToDo == nil {
+				return nil, badRequest(errors.New("todo is required"))
+			}
+			if input, err = patchToDo(&todo, mergePatchType, op.ToDo); err != nil {
+				return nil, err
+			}
+		}
+		if err := updateToDo(tx, &todo, input, op.Cascade); err != nil {
+			return nil, err
+		}
+		return &todo, nil
+	case "delete":
+		if op.Permanent && permission < models.PermissionOwner {
+			return nil, errPermanentDelete
+		}
+		if op.Permanent {
+			tx = tx.Unscoped().Session(&gorm.Session{})
+		}
+		todo, err := findBatchToDo(tx, sp, op)
+		if err != nil {
+			return nil, err
+		}
+		return nil, deleteToDo(tx, &todo, op.Permanent)
+	default:
+		return nil, badRequest(fmt.Errorf("unknown op %q", op.Op))
+	}
+}
+
+// BatchToDos godoc
+// @Summary Run several ToDo operations at once
+// @Description Run create, update (merge patch), complete and delete operations in one transaction and return a result for each of them. In atomic mode (default) a failed operation rolls back the whole batch: the response has its status, and the other operations get 424. In best_effort mode only failed operations are rolled back and the response is 200.
+// @Tags todos
+// @Accept  json
+// @Produce  json
+// @Param   batch  body     BatchRequest  true  "Operations"
+// @Success 200 {object} gin.H
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 412 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /todos/batch [post]
+func BatchToDos(c *gin.Context) {
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch req.Mode {
+	case "":
+		req.Mode = batchAtomic
+	case batchAtomic, batchBestEffort:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be atomic or best_effort"})
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("batch must have from 1 to %d operations", maxBatchOperations)})
+		return
+	}
+
+	sp, permission := currentSpace(c), requestPermission(c)
+	results := make([]BatchResult, len(req.Operations))
+	failed := -1
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for i, op := range req.Operations {
+			// Каждая операция идёт в своей точке сохранения, чтобы её ошибка откатывала только её
+			var todo *models.ToDo
+			err := tx.Transaction(func(savepoint *gorm.DB) (err error) {
+				todo, err = runBatchOperation(savepoint, sp, permission, op)
+				return err
+			})
+			if err != nil {
+				status, message := batchError(err)
+				results[i] = BatchResult{Index: i, Status: status, Error: message}
+				if req.Mode == batchAtomic {
+					failed = i
+					return err
+				}
+				continue
+			}
+			results[i] = BatchResult{Index: i, Status: http.StatusOK, ToDo: todo}
+		}
+		return nil
+	})
+
+	if failed >= 0 {
+		for i := range results {
+			if i != failed {
+				results[i] = BatchResult{Index: i, Status: http.StatusFailedDependency, Error: fmt.Sprintf("operation %d failed, batch rolled back", failed)}
+			}
+		}
+		c.JSON(results[failed].Status, gin.H{"error": fmt.Sprintf("operation %d failed: %s", failed, results[failed].Error), "results": results})
+		return
+	}
+	if err != nil {
+		respondError(c, err, "Не удалось выполнить операции")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
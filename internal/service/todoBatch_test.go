@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupBatchRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/todos", GetAllToDos)
+	router.POST("/todos", CreateToDo)
+	router.POST("/todos/batch", BatchToDos)
+	router.GET("/todos/trash", GetTrash)
+	return router
+}
+
+type batchResponse struct {
+	Error   string        `json:"error"`
+	Results []BatchResult `json:"results"`
+}
+
+func doBatch(t *testing.T, router *gin.Engine, body string, status int) batchResponse {
+	w := doJSON(router, "POST", "/todos/batch", body)
+	assert.Equal(t, status, w.Code, w.Body.String())
+	var resp batchResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+func resultStatuses(resp batchResponse) []int {
+	statuses := []int{}
+	for _, result := range resp.Results {
+		statuses = append(statuses, result.Status)
+	}
+	return statuses
+}
+
+func TestBatchToDos(t *testing.T) {
+	user := setupTestDB()
+	router := setupBatchRouter(user)
+
+	first, _ := createSubtask(t, router, "first", nil)
+	second, _ := createSubtask(t, router, "second", nil)
+
+	resp := doBatch(t, router, fmt.Sprintf(`{"operations":[
+		{"op":"create","todo":{"title":"new","tags":["work"]}},
+		{"op":"update","id":%d,"todo":{"title":"renamed"},"if_match":"\"1\""},
+		{"op":"complete","id":%d},
+		{"op":"delete","id":%d}
+	]}`, first.ID, first.ID, second.ID), http.StatusOK)
+	assert.Equal(t, []int{200, 200, 200, 200}, resultStatuses(resp))
+	assert.Equal(t, []string{"work"}, tagNamesOfToDo(*resp.Results[0].ToDo))
+	assert.Equal(t, "renamed", resp.Results[2].ToDo.Title)
+	assert.True(t, resp.Results[2].ToDo.Completed)
+	assert.Equal(t, uint(3), resp.Results[2].ToDo.Version)
+	assert.Nil(t, resp.Results[3].ToDo)
+
+	titles, _ := listTitles(t, router, "")
+	assert.Equal(t, []string{"renamed", "new"}, titles)
+	titles, _ = listTitles(t, router, "completed=true")
+	assert.Equal(t, []string{"renamed"}, titles)
+}
+
+func TestBatchToDosAtomic(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+	router := setupBatchRouter(user)
+
+	todo, _ := createSubtask(t, router, "task", nil)
+	foreign := models.ToDo{UserID: other.ID, Title: "foreign"}
+	database.DB.Create(&foreign)
+
+	// Ошибка одной операции откатывает все
+	resp := doBatch(t, router, fmt.Sprintf(`{"operations":[
+		{"op":"create","todo":{"title":"new"}},
+		{"op":"delete","id":%d},
+		{"op":"complete","id":%d}
+	]}`, todo.ID, foreign.ID), http.StatusNotFound)
+	assert.Equal(t, []int{424, 424, 404}, resultStatuses(resp))
+	assert.Contains(t, resp.Error, "operation 2")
+	titles, _ := listTitles(t, router, "")
+	assert.Equal(t, []string{"task"}, titles)
+
+	resp = doBatch(t, router, fmt.Sprintf(`{"operations":[
+		{"op":"update","id":%d,"todo":{"title":"stale"},"if_match":"\"5\""},
+		{"op":"create","todo":{"title":"new"}}
+	]}`, todo.ID), http.StatusPreconditionFailed)
+	assert.Equal(t, []int{412, 424}, resultStatuses(resp))
+
+	resp = doBatch(t, router, `{"operations":[{"op":"create","todo":{"description":"no title"}}]}`, http.StatusBadRequest)
+	assert.Equal(t, []int{400}, resultStatuses(resp))
+}
+
+func TestBatchToDosBestEffort(t *testing.T) {
+	user := setupTestDB()
+	router := setupBatchRouter(user)
+
+	todo, _ := createSubtask(t, router, "task", nil)
+
+	resp := doBatch(t, router, fmt.Sprintf(`{"mode":"best_effort","operations":[
+		{"op":"create","todo":{"title":"new"}},
+		{"op":"update","id":%d,"todo":{"id":7}},
+		{"op":"archive","id":%d},
+		{"op":"update","id":%d,"todo":{"priority":"high"}},
+		{"op":"delete"}
+	]}`, todo.ID, todo.ID, todo.ID), http.StatusOK)
+	assert.Equal(t, []int{200, 400, 400, 200, 400}, resultStatuses(resp))
+	assert.Equal(t, models.PriorityHigh, resp.Results[3].ToDo.Priority)
+	// Неудачная операция не увеличивает версию
+	assert.Equal(t, uint(2), resp.Results[3].ToDo.Version)
+
+	titles, _ := listTitles(t, router, "")
+	assert.Equal(t, []string{"task", "new"}, titles)
+}
+
+func TestBatchToDosDeleteMany(t *testing.T) {
+	user := setupTestDB()
+	router := setupBatchRouter(user)
+
+	ops := []string{}
+	for i := 0; i < 200; i++ {
+		todo, _ := createSubtask(t, router, fmt.Sprintf("task %d", i), nil)
+		ops = append(ops, fmt.Sprintf(`{"op":"delete","id":%d,"permanent":%t}`, todo.ID, i%2 == 0))
+	}
+	resp := doBatch(t, router, `{"operations":[`+strings.Join(ops, ",")+`]}`, http.StatusOK)
+	assert.Len(t, resp.Results, 200)
+
+	titles, _ := listTitles(t, router, "")
+	assert.Empty(t, titles)
+	w := doJSON(router, "GET", "/todos/trash", "")
+	assert.Equal(t, "100", w.Header().Get("X-Total-Count"))
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/todos/batch", `{"operations":[]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/todos/batch", `{"mode":"some","operations":[{"op":"delete","id":1}]}`).Code)
+	many := strings.Repeat(`{"op":"delete","id":1},`, maxBatchOperations)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "POST", "/todos/batch", `{"operations":[`+many+`{"op":"delete","id":1}]}`).Code)
+}
@@ -1,16 +1,259 @@
 package service
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"todo-app/internal/database"
 	"todo-app/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// currentUserID возвращает ID пользователя, которого AuthMiddleware положил в контекст
+func currentUserID(c *gin.Context) uint {
+	return c.GetUint("userID")
+}
+
+// resourceOwnerID возвращает владельца задачи или проекта из пути запроса. Authorize кладёт его в контекст
+// после проверки прав, ведь по приглашению можно работать с чужими данными. Без него это сам пользователь.
+func resourceOwnerID(c *gin.Context) uint {
+	if ownerID, ok := c.Get("ownerID"); ok {
+		return ownerID.(uint)
+	}
+	return currentUserID(c)
+}
+
+// requestPermission возвращает права пользователя на задачу или проект из пути запроса, а в рабочем
+// пространстве без них — права его роли. В личном списке пользователь владеет всем.
+func requestPermission(c *gin.Context) models.Permission {
+	if permission, ok := c.Get("permission"); ok {
+		return permission.(models.Permission)
+	}
+	if role, ok := c.Get("workspaceRole"); ok {
+		return role.(models.WorkspaceRole).Permission()
+	}
+	return models.PermissionOwner
+}
+
+// space — где лежат задачи и проекты: в личном списке пользователя или в рабочем пространстве команды
+type space struct {
+	userID      uint
+	workspaceID *uint
+}
+
+// currentSpace возвращает пространство запроса: рабочее, если WorkspaceContext положил его в контекст, иначе личное
+func currentSpace(c *gin.Context) space {
+	s := space{userID: currentUserID(c)}
+	if id, ok := c.Get("workspaceID"); ok {
+		workspaceID := id.(uint)
+		s.workspaceID = &workspaceID
+	}
+	return s
+}
+
+// spaceOf возвращает пространство, в котором лежит задача
+func spaceOf(todo *models.ToDo) space {
+	return space{userID: todo.UserID, workspaceID: todo.WorkspaceID}
+}
+
+// scope ограничивает запрос задачами или проектами пространства
+func (s space) scope(db *gorm.DB) *gorm.DB {
+	if s.workspaceID != nil {
+		return db.Where("workspace_id = ?", *s.workspaceID)
+	}
+	return db.Where("user_id = ? AND workspace_id IS NULL", s.userID)
+}
+
+// ownedBy ограничивает запрос задачами одного пользователя
+func ownedBy(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", userID)
+	}
+}
+
+// requestError — ошибка в данных запроса, которую нужно вернуть клиенту с кодом 400
+type requestError struct{ err error }
+
+func (e requestError) Error() string { return e.err.Error() }
+
+func badRequest(err error) error { return requestError{err} }
+
+// respondError отвечает 400 на ошибки запроса, 412 на одновременное изменение задачи и 500 на все остальные
+func respondError(c *gin.Context, err error, message string) {
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reqErr.Error()})
+		return
+	}
+	if errors.Is(err, errVersionConflict) {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("%s: %v", message, err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// ToDoInput — поля задачи, которые задаёт клиент. Остальные поля ToDo системные
+// или вычисляются сервером, и в теле запроса они игнорируются.
+type ToDoInput struct {
+	Title          string          `json:"title" binding:"required"`
+	Description    string          `json:"description"`
+	Completed      bool            `json:"completed"`
+	Priority       models.Priority `json:"priority"`
+	ProjectID      *uint           `json:"project_id"`
+	ParentID       *uint           `json:"parent_id"`
+	DueDate        *string         `json:"due_date"`
+	DueTime        *string         `json:"due_time"`
+	Timezone       string          `json:"timezone"`
+	ReminderOffset *int            `json:"reminder_offset"`
+	Recurrence     *string         `json:"recurrence"`
+	Tags           TagNames        `json:"tags"`
+}
+
+// toDoInputOf возвращает изменяемые поля задачи, чтобы к ним можно было применить PATCH
+func toDoInputOf(todo *models.ToDo) ToDoInput {
+	tags := TagNames{}
+	for _, tag := range todo.Tags {
+		tags = append(tags, tag.Name)
+	}
+	return ToDoInput{
+		Title:          todo.Title,
+		Description:    todo.Description,
+		Completed:      todo.Completed,
+		Priority:       todo.Priority,
+		ProjectID:      todo.ProjectID,
+		ParentID:       todo.ParentID,
+		DueDate:        todo.DueDate,
+		DueTime:        todo.DueTime,
+		Timezone:       todo.Timezone,
+		ReminderOffset: todo.ReminderOffset,
+		Recurrence:     todo.Recurrence,
+		Tags:           tags,
+	}
+}
+
+// apply переносит поля запроса в задачу и возвращает нормализованные имена меток
+func (in ToDoInput) apply(todo *models.ToDo) ([]string, error) {
+	todo.Title = in.Title
+	todo.Description = in.Description
+	todo.Completed = in.Completed
+	todo.Priority = in.Priority
+	todo.ProjectID = in.ProjectID
+	todo.ParentID = in.ParentID
+	todo.DueDate = in.DueDate
+	todo.DueTime = in.DueTime
+	todo.Timezone = in.Timezone
+	todo.ReminderOffset = in.ReminderOffset
+	todo.Recurrence = in.Recurrence
+	return normalizeTagNames(in.Tags)
+}
+
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// GetAllToDos godoc
+// @Summary List ToDos
+// @Description List ToDo items of the current user page by page. The total number of matching items is returned in X-Total-Count, the cursor of the next page in X-Next-Cursor.
+// @Tags todos
+// @Produce  json
+// @Param   completed       query    bool    false  "Completion state"
+// @Param   q               query    string  false  "Substring of title or description"
+// @Param   created_after   query    string  false  "RFC 3339 timestamp"
+// @Param   created_before  query    string  false  "RFC 3339 timestamp"
+// @Param   updated_after   query    string  false  "RFC 3339 timestamp"
+// @Param   updated_before  query    string  false  "RFC 3339 timestamp"
+// @Param   due             query    string  false  "Due filter: overdue, today or week"
+// @Param   tz              query    string  false  "Timezone for today and week, UTC by default"
+// @Param   sort            query    string  false  "position (default), id, created_at, updated_at, due_at, title or priority"
+// @Param   order           query    string  false  "asc or desc"
+// @Param   limit           query    int     false  "Page size, 50 by default, at most 200"
+// @Param   cursor          query    string  false  "Cursor from X-Next-Cursor, valid only with the same sort and order"
+// @Param   parent_id       query    int     false  "Only direct subtasks of this task"
+// @Param   view            query    string  false  "flat (default) or tree: top-level tasks with nested subtasks"
+// @Success 200 {array} models.ToDo
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /todos [get]
 func GetAllToDos(c *gin.Context) {
+	listToDos(c, currentSpace(c).scope)
+}
+
+// listToDos отдаёт страницу задач, отобранных scopes и параметрами запроса
+func listToDos(c *gin.Context, scopes ...func(*gorm.DB) *gorm.DB) {
+	filters, err := toDoFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		filters = append(filters, containsFilter(q))
+	}
+	p, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// В дереве фильтры и страницы относятся к задачам верхнего уровня
+	tree := false
+	switch c.DefaultQuery("view", "flat") {
+	case "flat":
+	case "tree":
+		tree = true
+		filters = append(filters, func(db *gorm.DB) *gorm.DB {
+			return db.Where("parent_id IS NULL")
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "view must be flat or tree"})
+		return
+	}
+
+	query := database.DB.Model(&models.ToDo{}).
+		Scopes(scopes...).
+		Scopes(filters...).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить задачи"})
+		return
+	}
+
+	paged, err := p.scope(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	var todos []models.ToDo
-	database.DB.Find(&todos)
+	if err := paged.Preload("Tags").Find(&todos).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить задачи"})
+		return
+	}
+
+	todos, next := p.next(todos)
+	if tree {
+		todos, err = buildTree(database.DB, todos)
+	} else {
+		err = attachProgress(database.DB, todos)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить задачи"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+	}
 	c.JSON(http.StatusOK, todos)
 }
 
@@ -20,65 +263,246 @@ func GetAllToDos(c *gin.Context) {
 // @Tags todos
 // @Accept  json
 // @Produce  json
-// @Param   todo  body     models.ToDo  true  "ToDo"
+// @Param   todo  body     ToDoInput  true  "ToDo"
 // @Success 200 {object} models.ToDo
 // @Failure 400 {object} gin.H
 // @Failure 500 {object} gin.H
 // @Router /todos [post]
 func CreateToDo(c *gin.Context) {
-	var todo models.ToDo
-	if err := c.ShouldBindJSON(&todo); err != nil {
+	var input ToDoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	database.DB.Create(&todo)
+	var todo models.ToDo
+	err := database.DB.Transaction(func(tx *gorm.DB) (err error) {
+		todo, err = createToDo(tx, currentSpace(c), input)
+		return err
+	})
+	if err != nil {
+		respondError(c, err, "Не удалось создать задачу")
+		return
+	}
+	c.Header("ETag", toDoETag(&todo))
 	c.JSON(http.StatusOK, todo)
 }
 
+// createToDo проверяет input и создаёт по нему задачу пользователя в пространстве sp
+func createToDo(tx *gorm.DB, sp space, input ToDoInput) (models.ToDo, error) {
+	todo := models.ToDo{UserID: sp.userID, WorkspaceID: sp.workspaceID, Version: 1}
+	tagNames, err := input.apply(&todo)
+	if err != nil {
+		return todo, badRequest(err)
+	}
+	if err := applySchedule(&todo, nil, time.Now()); err != nil {
+		return todo, badRequest(err)
+	}
+	if err := applyRecurrence(&todo, nil); err != nil {
+		return todo, badRequest(err)
+	}
+	if err := checkProject(tx, spaceOf(&todo), todo.ProjectID); err != nil {
+		return todo, badRequest(err)
+	}
+	if err := checkParent(tx, &todo); err != nil {
+		return todo, badRequest(err)
+	}
+	// Новая задача встаёт в конец ручного порядка
+	if todo.Position, err = nextPosition(tx, spaceOf(&todo)); err != nil {
+		return todo, err
+	}
+	if err := tx.Create(&todo).Error; err != nil {
+		return todo, err
+	}
+	return todo, setToDoTags(tx, &todo, tagNames)
+}
+
 // UpdateToDo godoc
-// @Summary Update a new ToDo
-// @Description Update a new ToDo item
+// @Summary Replace a ToDo
+// @Description Replace all client-settable fields of a ToDo item. Omitted fields are reset, use PATCH to change only some of them. With cascade=true completing a task completes its subtasks too.
 // @Tags todos
 // @Accept  json
 // @Produce  json
-// @Param   todo  body     models.ToDo  true  "ToDo"
+// @Param   id        path     int        true   "ToDo ID"
+// @Param   cascade   query    bool       false  "Complete subtasks too"
+// @Param   If-Match  header   string     false  "ETag the change is based on"
+// @Param   todo      body     ToDoInput  true   "ToDo"
 // @Success 200 {object} models.ToDo
 // @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 412 {object} gin.H
 // @Failure 500 {object} gin.H
-// @Router /todos [put]
+// @Router /todos/{id} [put]
 func UpdateToDo(c *gin.Context) {
 	var todo models.ToDo
-	id := c.Param("id")
-	if err := database.DB.First(&todo, id).Error; err != nil {
+	if err := database.DB.Scopes(ownedBy(resourceOwnerID(c))).First(&todo, c.Param("id")).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
 		return
 	}
-	if err := c.ShouldBindJSON(&todo); err != nil {
+	if !checkIfMatch(c, &todo) {
+		return
+	}
+	var input ToDoInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	database.DB.Save(&todo)
+	saveToDo(c, todo, input)
+}
+
+// saveToDo заменяет изменяемые поля задачи значениями из input, сохраняет её и отвечает клиенту
+func saveToDo(c *gin.Context, todo models.ToDo, input ToDoInput) {
+	cascade, _ := strconv.ParseBool(c.Query("cascade"))
+	err := checkMoveAccess(currentUserID(c), &todo, input)
+	if err == nil {
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			return updateToDo(tx, &todo, input, cascade)
+		})
+	}
+	if err != nil {
+		respondError(c, err, "Не удалось обновить задачу")
+		return
+	}
+	c.Header("ETag", toDoETag(&todo))
 	c.JSON(http.StatusOK, todo)
 }
 
+// checkMoveAccess проверяет, что задачу переносят в проект и под задачу, которые пользователь сам может менять.
+// Приглашение к задаче не даёт права складывать её в остальные проекты и задачи владельца.
+// Недоступные проект и задача выглядят так же, как несуществующие.
+func checkMoveAccess(userID uint, todo *models.ToDo, input ToDoInput) error {
+	if input.ProjectID != nil && !sameParent(todo.ProjectID, input.ProjectID) {
+		access, err := ProjectAccess(userID, strconv.FormatUint(uint64(*input.ProjectID), 10))
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && access.Permission < models.PermissionEditor) {
+			return badRequest(errors.New("project not found"))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if input.ParentID != nil && !sameParent(todo.ParentID, input.ParentID) {
+		access, err := ToDoAccess(userID, strconv.FormatUint(uint64(*input.ParentID), 10))
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && access.Permission < models.PermissionEditor) {
+			return badRequest(errParentNotFound)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateToDo заменяет изменяемые поля задачи значениями из input и сохраняет её.
+// С cascade выполнение задачи выполняет и все её подзадачи.
+func updateToDo(tx *gorm.DB, todo *models.ToDo, input ToDoInput, cascade bool) error {
+	previous := *todo
+	tagNames, err := input.apply(todo)
+	if err != nil {
+		return badRequest(err)
+	}
+	if err := applySchedule(todo, &previous, time.Now()); err != nil {
+		return badRequest(err)
+	}
+	if err := applyRecurrence(todo, &previous); err != nil {
+		return badRequest(err)
+	}
+	if err := checkProject(tx, spaceOf(todo), todo.ProjectID); err != nil {
+		return badRequest(err)
+	}
+	if !sameParent(previous.ParentID, todo.ParentID) {
+		if err := checkParent(tx, todo); err != nil {
+			return badRequest(err)
+		}
+	}
+
+	todo.Tags, todo.Progress, todo.Children, todo.NextOccurrence = nil, nil, nil, nil
+	if err := bumpVersion(tx, todo); err != nil {
+		return err
+	}
+	if err := tx.Save(todo).Error; err != nil {
+		return err
+	}
+	if cascade && todo.Completed {
+		if err := completeDescendants(tx, todo.ID, time.Now()); err != nil {
+			return err
+		}
+	}
+	if err := setToDoTags(tx, todo, tagNames); err != nil {
+		return err
+	}
+	// Выполнение повторяющейся задачи создаёт её следующее повторение
+	if todo.Completed && !previous.Completed && todo.Recurrence != nil {
+		next, err := createNextOccurrence(tx, todo, time.Now())
+		if err != nil {
+			return err
+		}
+		todo.NextOccurrence = next
+	}
+	updated := []models.ToDo{*todo}
+	if err := attachProgress(tx, updated); err != nil {
+		return err
+	}
+	todo.Progress = updated[0].Progress
+	return nil
+}
+
 // DeleteToDo godoc
-// @Summary Delete a new ToDo
-// @Description Delete a new ToDo item
+// @Summary Delete a ToDo
+// @Description Move a ToDo item and its subtasks to the trash. With permanent=true delete them for good, this also works for items already in the trash. Only the owner can delete for good.
 // @Tags todos
-// @Accept  json
 // @Produce  json
-// @Param   todo  body     models.ToDo  true  "ToDo"
-// @Success 200 {object} models.ToDo
-// @Failure 400 {object} gin.H
+// @Param   id         path     int     true   "ToDo ID"
+// @Param   permanent  query    bool    false  "Delete for good instead of moving to the trash"
+// @Param   If-Match   header   string  false  "ETag the deletion is based on"
+// @Success 200 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 412 {object} gin.H
 // @Failure 500 {object} gin.H
-// @Router /todos [delete]
+// @Router /todos/{id} [delete]
 func DeleteToDo(c *gin.Context) {
+	permanent, _ := strconv.ParseBool(c.Query("permanent"))
+	// Редактор может только перенести задачу в корзину, откуда владелец её восстановит
+	if permanent && requestPermission(c) < models.PermissionOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+	db := database.DB
+	if permanent {
+		db = db.Unscoped().Session(&gorm.Session{})
+	}
+
 	var todo models.ToDo
 	id := c.Param("id")
-	if err := database.DB.First(&todo, id).Error; err != nil {
+	if err := db.Scopes(ownedBy(resourceOwnerID(c))).First(&todo, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
 		return
 	}
-	database.DB.Delete(&todo)
+	if !checkIfMatch(c, &todo) {
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return deleteToDo(tx, &todo, permanent)
+	})
+	if err != nil {
+		respondError(c, err, "Не удалось удалить задачу")
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Задача удалена"})
 }
+
+// deleteToDo переносит задачу с подзадачами в корзину, а с permanent удаляет их навсегда.
+// Для permanent tx должен быть без фильтра удалённых задач.
+func deleteToDo(tx *gorm.DB, todo *models.ToDo, permanent bool) error {
+	if err := bumpVersion(tx, todo); err != nil {
+		return err
+	}
+	// Подзадачи удаляются вместе с задачей
+	ids, _, err := descendantIDs(tx, todo.ID)
+	if err != nil {
+		return err
+	}
+	if permanent {
+		return purgeToDos(tx, append(ids, todo.ID))
+	}
+	return tx.Delete(&models.ToDo{}, append(ids, todo.ID)).Error
+}
@@ -17,24 +17,42 @@ import (
 	"gorm.io/gorm"
 )
 
-func setupTestDB() {
+func setupTestDB() models.User {
 	// Создаём in-memory базу данных для тестов
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&models.ToDo{})
+	database.Migrate(db)
 	database.DB = db
+
+	return createTestUser("testuser")
+}
+
+func createTestUser(username string) models.User {
+	user := models.User{Username: username, Password: "hash"}
+	database.DB.Create(&user)
+	return user
+}
+
+// withUser имитирует AuthMiddleware для обработчиков задач
+func withUser(user models.User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("username", user.Username)
+		c.Set("userID", user.ID)
+		c.Next()
+	}
 }
 
 func TestGetAllToDos(t *testing.T) {
-	setupTestDB()
+	user := setupTestDB()
 
 	// Инициализация Gin и маршрута
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
+	router.Use(withUser(user))
 	router.GET("/todos", GetAllToDos)
 
 	// Создадим несколько тестовых задач
-	database.DB.Create(&models.ToDo{Title: "Test ToDo 1", Description: "Description 1", Completed: false})
-	database.DB.Create(&models.ToDo{Title: "Test ToDo 2", Description: "Description 2", Completed: true})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Test ToDo 1", Description: "Description 1", Completed: false})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Test ToDo 2", Description: "Description 2", Completed: true})
 
 	// Отправляем GET запрос на /todos
 	req, _ := http.NewRequest("GET", "/todos", nil)
@@ -52,11 +70,12 @@ func TestGetAllToDos(t *testing.T) {
 }
 
 func TestCreateToDo(t *testing.T) {
-	setupTestDB()
+	user := setupTestDB()
 
 	// Инициализация Gin и маршрута
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
+	router.Use(withUser(user))
 	router.POST("/todos", CreateToDo)
 
 	// Создадим новую задачу
@@ -82,18 +101,20 @@ func TestCreateToDo(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, todo.Title, createdTodo.Title)
 	assert.Equal(t, todo.Description, createdTodo.Description)
+	assert.Equal(t, user.ID, createdTodo.UserID)
 }
 
 func TestUpdateToDo(t *testing.T) {
-	setupTestDB()
+	user := setupTestDB()
 
 	// Инициализация Gin и маршрута
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
+	router.Use(withUser(user))
 	router.PUT("/todos/:id", UpdateToDo)
 
 	// Создадим тестовую задачу
-	todo := models.ToDo{Title: "Old Title", Description: "Old Description", Completed: false}
+	todo := models.ToDo{UserID: user.ID, Title: "Old Title", Description: "Old Description", Completed: false}
 	database.DB.Create(&todo)
 
 	// Обновим задачу
@@ -121,15 +142,16 @@ func TestUpdateToDo(t *testing.T) {
 }
 
 func TestDeleteToDo(t *testing.T) {
-	setupTestDB()
+	user := setupTestDB()
 
 	// Инициализация Gin и маршрута
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
+	router.Use(withUser(user))
 	router.DELETE("/todos/:id", DeleteToDo)
 
 	// Создадим тестовую задачу
-	todo := models.ToDo{Title: "Test ToDo", Description: "Test Description", Completed: false}
+	todo := models.ToDo{UserID: user.ID, Title: "Test ToDo", Description: "Test Description", Completed: false}
 	database.DB.Create(&todo)
 
 	// Отправляем DELETE запрос на /todos/:id
@@ -145,3 +167,129 @@ func TestDeleteToDo(t *testing.T) {
 	err := database.DB.First(&deletedToDo, todo.ID).Error
 	assert.Error(t, err) // Ожидаем ошибку, т.к. задача должна быть удалена
 }
+
+func TestGetAllToDosReturnsOnlyOwnToDos(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/todos", GetAllToDos)
+
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Mine"})
+	database.DB.Create(&models.ToDo{UserID: other.ID, Title: "Not mine"})
+
+	req, _ := http.NewRequest("GET", "/todos", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var todos []models.ToDo
+	err := json.Unmarshal(w.Body.Bytes(), &todos)
+	assert.NoError(t, err)
+	assert.Len(t, todos, 1)
+	assert.Equal(t, "Mine", todos[0].Title)
+}
+
+func TestForeignToDoIsNotFound(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.PUT("/todos/:id", UpdateToDo)
+	router.DELETE("/todos/:id", DeleteToDo)
+
+	// Задача другого пользователя не должна быть видна ни для обновления, ни для удаления
+	foreign := models.ToDo{UserID: other.ID, Title: "Foreign"}
+	database.DB.Create(&foreign)
+	url := "/todos/" + strconv.FormatUint(uint64(foreign.ID), 10)
+
+	req, _ := http.NewRequest("PUT", url, bytes.NewBufferString(`{"title":"Hijacked"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, _ = http.NewRequest("DELETE", url, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var stored models.ToDo
+	assert.NoError(t, database.DB.First(&stored, foreign.ID).Error)
+	assert.Equal(t, "Foreign", stored.Title)
+	assert.Equal(t, other.ID, stored.UserID)
+}
+
+func TestUpdateToDoKeepsOwner(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.PUT("/todos/:id", UpdateToDo)
+
+	todo := models.ToDo{UserID: user.ID, Title: "Mine"}
+	database.DB.Create(&todo)
+
+	body := `{"title":"Still mine","user_id":` + strconv.FormatUint(uint64(other.ID), 10) + `}`
+	req, _ := http.NewRequest("PUT", "/todos/"+strconv.FormatUint(uint64(todo.ID), 10), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var stored models.ToDo
+	database.DB.First(&stored, todo.ID)
+	assert.Equal(t, user.ID, stored.UserID)
+	assert.Equal(t, "Still mine", stored.Title)
+}
+
+func TestCreateToDoRejectsReminderAfterDue(t *testing.T) {
+	user := setupTestDB()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.POST("/todos", CreateToDo)
+
+	body := `{"title":"Late reminder","due_date":"2024-12-31","due_time":"10:00","reminder_offset":-15}`
+	req, _ := http.NewRequest("POST", "/todos", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var count int64
+	database.DB.Model(&models.ToDo{}).Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestUpdateToDoSetsCompletedAt(t *testing.T) {
+	user := setupTestDB()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.PATCH("/todos/:id", PatchToDo)
+
+	todo := models.ToDo{UserID: user.ID, Title: "Task"}
+	database.DB.Create(&todo)
+
+	req, _ := http.NewRequest("PATCH", "/todos/"+strconv.FormatUint(uint64(todo.ID), 10), bytes.NewBufferString(`{"completed":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var updated models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.True(t, updated.Completed)
+	assert.NotNil(t, updated.CompletedAt)
+}
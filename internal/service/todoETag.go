@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errVersionConflict = errors.New("task was changed by another request")
+
+// toDoETag возвращает сильный ETag задачи. Он меняется вместе с версией при каждом изменении.
+func toDoETag(todo *models.ToDo) string {
+	return fmt.Sprintf(`"%d"`, todo.Version)
+}
+
+// etagMatches проверяет, есть ли etag в списке из If-Match или If-None-Match.
+// При weak=false слабые теги не совпадают ни с чем, как требует If-Match (RFC 9110).
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch отвечает 412, если клиент менял задачу по устаревшей версии.
+// Без заголовка If-Match запрос выполняется безусловно.
+func checkIfMatch(c *gin.Context, todo *models.ToDo) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || etagMatches(header, toDoETag(todo), false) {
+		return true
+	}
+	c.Header("ETag", toDoETag(todo))
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": errVersionConflict.Error()})
+	return false
+}
+
+// bumpVersion увеличивает версию задачи, только если её никто не изменил с момента загрузки.
+// Так два одновременных изменения не перезапишут друг друга, даже если оба прошли checkIfMatch.
+func bumpVersion(tx *gorm.DB, todo *models.ToDo) error {
+	result := tx.Model(&models.ToDo{}).
+		Where("id = ? AND version = ?", todo.ID, todo.Version).
+		UpdateColumn("version", todo.Version+1)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errVersionConflict
+	}
+	todo.Version++
+	return nil
+}
+
+// bumpTaggedVersions увеличивает версию всех задач, в том числе удалённых, с метками tagIDs.
+// Метки входят в представление задачи, поэтому их переименование меняет её ETag.
+func bumpTaggedVersions(tx *gorm.DB, tagIDs []uint) error {
+	return tx.Model(&models.ToDo{}).Unscoped().
+		Where("id IN (SELECT to_do_id FROM todo_tags WHERE tag_id IN ?)", tagIDs).
+		UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// GetToDo godoc
+// @Summary Get a ToDo
+// @Description Get a ToDo item with its ETag. With If-None-Match matching the current ETag the response is 304 without a body.
+// @Tags todos
+// @Produce  json
+// @Param   id             path     int     true   "ToDo ID"
+// @Param   If-None-Match  header   string  false  "ETag from a previous response"
+// @Success 200 {object} models.ToDo
+// @Success 304
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /todos/{id} [get]
+func GetToDo(c *gin.Context) {
+	var todo models.ToDo
+	if err := database.DB.Scopes(ownedBy(resourceOwnerID(c))).Preload("Tags").First(&todo, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+		return
+	}
+
+	c.Header("ETag", toDoETag(&todo))
+	if header := c.GetHeader("If-None-Match"); header != "" && etagMatches(header, toDoETag(&todo), true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	todos := []models.ToDo{todo}
+	if err := attachProgress(database.DB, todos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить задачу"})
+		return
+	}
+	c.JSON(http.StatusOK, todos[0])
+}
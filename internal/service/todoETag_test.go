@@ -0,0 +1,118 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupETagRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.POST("/todos", CreateToDo)
+	router.GET("/todos/:id", GetToDo)
+	router.PUT("/todos/:id", UpdateToDo)
+	router.PATCH("/todos/:id", PatchToDo)
+	router.DELETE("/todos/:id", DeleteToDo)
+	return router
+}
+
+func doConditional(router *gin.Engine, method, url, header, etag, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if etag != "" {
+		req.Header.Set(header, etag)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestGetToDoETag(t *testing.T) {
+	user := setupTestDB()
+	router := setupETagRouter(user)
+
+	w := doJSON(router, "POST", "/todos", `{"title":"Task"}`)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+	var todo models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	url := idPath("/todos", todo.ID)
+
+	w = doConditional(router, "GET", url, "If-None-Match", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	w = doConditional(router, "GET", url, "If-None-Match", `"7", `+etag, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// После изменения старый ETag уже не совпадает
+	w = doJSON(router, "PATCH", url, `{"completed":true}`)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	w = doConditional(router, "GET", url, "If-None-Match", etag, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "GET", idPath("/todos", 999), "").Code)
+}
+
+func TestIfMatch(t *testing.T) {
+	user := setupTestDB()
+	router := setupETagRouter(user)
+
+	w := doJSON(router, "POST", "/todos", `{"title":"Task"}`)
+	stale := w.Header().Get("ETag")
+	var todo models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	url := idPath("/todos", todo.ID)
+
+	// Первый клиент меняет задачу
+	w = doConditional(router, "PUT", url, "If-Match", stale, `{"title":"First"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	current := w.Header().Get("ETag")
+	assert.NotEqual(t, stale, current)
+
+	// Второй клиент со старым ETag получает 412 и ничего не перезаписывает
+	w = doConditional(router, "PUT", url, "If-Match", stale, `{"title":"Second"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, current, w.Header().Get("ETag"))
+	w = doConditional(router, "PATCH", url, "If-Match", stale, `{"title":"Second"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = doConditional(router, "DELETE", url, "If-Match", stale, "")
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	// Слабый ETag не подходит для If-Match
+	w = doConditional(router, "PATCH", url, "If-Match", "W/"+current, `{"title":"Second"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	var stored models.ToDo
+	database.DB.First(&stored, todo.ID)
+	assert.Equal(t, "First", stored.Title)
+
+	w = doConditional(router, "PATCH", url, "If-Match", "*", `{"title":"Any"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doConditional(router, "DELETE", url, "If-Match", w.Header().Get("ETag"), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestBumpVersionDetectsConcurrentChange(t *testing.T) {
+	user := setupTestDB()
+	todo := models.ToDo{UserID: user.ID, Title: "Task", Version: 1}
+	database.DB.Create(&todo)
+
+	// Другой запрос успел изменить задачу после того, как мы её загрузили
+	loaded := todo
+	assert.NoError(t, bumpVersion(database.DB, &todo))
+	assert.Equal(t, uint(2), todo.Version)
+	assert.ErrorIs(t, bumpVersion(database.DB, &loaded), errVersionConflict)
+}
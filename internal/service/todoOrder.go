@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+	"todo-app/internal/rank"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errNeighbourNotFound = errors.New("neighbour task not found")
+
+type moveToDoRequest struct {
+	AfterID  *uint `json:"after_id"`
+	BeforeID *uint `json:"before_id"`
+}
+
+// nextPosition возвращает ранг для новой задачи в конце списка пространства
+func nextPosition(tx *gorm.DB, sp space) (string, error) {
+	var last string
+	err := tx.Model(&models.ToDo{}).Unscoped().Scopes(sp.scope).Select("COALESCE(MAX(position), '')").Scan(&last).Error
+	return rank.After(last), err
+}
+
+// neighbourPosition возвращает ранг соседней задачи по ID, не считая перемещаемую
+func neighbourPosition(tx *gorm.DB, todo *models.ToDo, id uint) (string, error) {
+	var neighbour models.ToDo
+	if id == todo.ID {
+		return "", badRequest(errors.New("task cannot be moved next to itself"))
+	}
+	if err := tx.Select("id", "position").Scopes(spaceOf(todo).scope).First(&neighbour, id).Error; err != nil {
+		return "", badRequest(errNeighbourNotFound)
+	}
+	return neighbour.Position, nil
+}
+
+// MoveToDo godoc
+// @Summary Move a ToDo
+// @Description Place a ToDo between two neighbours in the manual order: after after_id and before before_id. If only one neighbour is given, the task is placed right next to it. Only the rank of the moved task changes.
+// @Tags todos
+// @Accept  json
+// @Produce  json
+// @Param   id        path     int              true   "ToDo ID"
+// @Param   If-Match  header   string           false  "ETag the move is based on"
+// @Param   body      body     moveToDoRequest  true   "Neighbours"
+// @Success 200 {object} models.ToDo
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 412 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /todos/{id}/move [post]
+func MoveToDo(c *gin.Context) {
+	var input moveToDoRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.AfterID == nil && input.BeforeID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after_id or before_id is required"})
+		return
+	}
+
+	var todo models.ToDo
+	if err := database.DB.Scopes(ownedBy(resourceOwnerID(c))).First(&todo, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+		return
+	}
+	if !checkIfMatch(c, &todo) {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var prev, next string
+		var err error
+		if input.AfterID != nil {
+			if prev, err = neighbourPosition(tx, &todo, *input.AfterID); err != nil {
+				return err
+			}
+		}
+		if input.BeforeID != nil {
+			if next, err = neighbourPosition(tx, &todo, *input.BeforeID); err != nil {
+				return err
+			}
+		}
+
+		// Второй сосед — ближайшая задача с другой стороны, без учёта перемещаемой
+		others := tx.Model(&models.ToDo{}).Scopes(spaceOf(&todo).scope).Where("id <> ?", todo.ID)
+		switch {
+		case input.BeforeID == nil:
+			var successors []string
+			if err := others.Where("position > ?", prev).Order("position").Limit(1).Pluck("position", &successors).Error; err != nil {
+				return err
+			}
+			if len(successors) > 0 {
+				next = successors[0]
+			}
+		case input.AfterID == nil:
+			var predecessors []string
+			if err := others.Where("position < ?", next).Order("position DESC").Limit(1).Pluck("position", &predecessors).Error; err != nil {
+				return err
+			}
+			if len(predecessors) > 0 {
+				prev = predecessors[0]
+			}
+		}
+
+		position, err := rank.Between(prev, next)
+		if errors.Is(err, rank.ErrOrder) {
+			return badRequest(errors.New("after_id must come before before_id"))
+		}
+		if err != nil {
+			return err
+		}
+		if err := bumpVersion(tx, &todo); err != nil {
+			return err
+		}
+		if err := tx.Model(&todo).Update("position", position).Error; err != nil {
+			return err
+		}
+		return setToDoTags(tx, &todo, nil)
+	})
+	if err != nil {
+		respondError(c, err, "Не удалось переместить задачу")
+		return
+	}
+	c.Header("ETag", toDoETag(&todo))
+	c.JSON(http.StatusOK, todo)
+}
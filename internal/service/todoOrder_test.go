@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupOrderRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/todos", GetAllToDos)
+	router.POST("/todos", CreateToDo)
+	router.PUT("/todos/:id", UpdateToDo)
+	router.PATCH("/todos/:id", PatchToDo)
+	router.POST("/todos/:id/move", MoveToDo)
+	return router
+}
+
+func createOrdered(t *testing.T, router *gin.Engine, titles ...string) []models.ToDo {
+	var todos []models.ToDo
+	for _, title := range titles {
+		w := doJSON(router, "POST", "/todos", `{"title":"`+title+`"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var todo models.ToDo
+		json.Unmarshal(w.Body.Bytes(), &todo)
+		todos = append(todos, todo)
+	}
+	return todos
+}
+
+func moveBody(afterID, beforeID uint) string {
+	body := map[string]uint{}
+	if afterID != 0 {
+		body["after_id"] = afterID
+	}
+	if beforeID != 0 {
+		body["before_id"] = beforeID
+	}
+	data, _ := json.Marshal(body)
+	return string(data)
+}
+
+func TestMoveToDo(t *testing.T) {
+	user := setupTestDB()
+	router := setupOrderRouter(user)
+	todos := createOrdered(t, router, "a", "b", "c", "d")
+	a, b, c, d := todos[0], todos[1], todos[2], todos[3]
+
+	titles, _ := listTitles(t, router, "")
+	assert.Equal(t, []string{"a", "b", "c", "d"}, titles)
+
+	// Между двумя соседями
+	w := doJSON(router, "POST", idPath("/todos", d.ID)+"/move", moveBody(a.ID, b.ID))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	titles, _ = listTitles(t, router, "")
+	assert.Equal(t, []string{"a", "d", "b", "c"}, titles)
+
+	// Только после задачи: встаёт сразу за ней
+	doJSON(router, "POST", idPath("/todos", a.ID)+"/move", moveBody(b.ID, 0))
+	titles, _ = listTitles(t, router, "")
+	assert.Equal(t, []string{"d", "b", "a", "c"}, titles)
+
+	// Только перед задачей, в том числе в начало списка
+	doJSON(router, "POST", idPath("/todos", c.ID)+"/move", moveBody(0, d.ID))
+	titles, _ = listTitles(t, router, "")
+	assert.Equal(t, []string{"c", "d", "b", "a"}, titles)
+
+	// В конец списка
+	doJSON(router, "POST", idPath("/todos", c.ID)+"/move", moveBody(a.ID, 0))
+	titles, _ = listTitles(t, router, "")
+	assert.Equal(t, []string{"d", "b", "a", "c"}, titles)
+
+	// Остальные задачи сохраняют свои ранги
+	var unchanged models.ToDo
+	database.DB.First(&unchanged, b.ID)
+	assert.Equal(t, b.Position, unchanged.Position)
+
+	// PUT не меняет порядок
+	doJSON(router, "PUT", idPath("/todos", d.ID), `{"title":"d","position":"zzz"}`)
+	titles, _ = listTitles(t, router, "")
+	assert.Equal(t, []string{"d", "b", "a", "c"}, titles)
+}
+
+func TestMoveToDoValidation(t *testing.T) {
+	user := setupTestDB()
+	router := setupOrderRouter(user)
+	todos := createOrdered(t, router, "a", "b", "c")
+	a, b, c := todos[0], todos[1], todos[2]
+
+	foreign := models.ToDo{UserID: createTestUser("otheruser").ID, Title: "foreign", Position: "m"}
+	database.DB.Create(&foreign)
+
+	cases := map[string]string{
+		"no neighbours":     `{}`,
+		"reversed":          moveBody(c.ID, a.ID),
+		"next to itself":    moveBody(b.ID, b.ID),
+		"foreign neighbour": moveBody(foreign.ID, 0),
+	}
+	for name, body := range cases {
+		w := doJSON(router, "POST", idPath("/todos", b.ID)+"/move", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, name)
+	}
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", idPath("/todos", foreign.ID)+"/move", moveBody(a.ID, 0)).Code)
+}
+
+func TestToDoPriority(t *testing.T) {
+	user := setupTestDB()
+	router := setupOrderRouter(user)
+
+	for _, body := range []string{`{"title":"low","priority":"low"}`, `{"title":"default"}`, `{"title":"urgent","priority":"urgent"}`} {
+		assert.Equal(t, http.StatusOK, doJSON(router, "POST", "/todos", body).Code)
+	}
+	w := doJSON(router, "POST", "/todos", `{"title":"bad","priority":"critical"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	titles, w := listTitles(t, router, "sort=priority&order=desc")
+	assert.Equal(t, []string{"urgent", "low", "default"}, titles)
+	assert.Contains(t, w.Body.String(), `"priority":"none"`)
+
+	// Курсор работает и для сортировки по приоритету
+	titles, w = listTitles(t, router, "sort=priority&order=desc&limit=2")
+	assert.Equal(t, []string{"urgent", "low"}, titles)
+	titles, _ = listTitles(t, router, "sort=priority&order=desc&limit=2&cursor="+w.Header().Get("X-Next-Cursor"))
+	assert.Equal(t, []string{"default"}, titles)
+}
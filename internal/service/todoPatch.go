@@ -0,0 +1,358 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+var (
+	errUnsupportedPatch = errors.New("PATCH body must be application/merge-patch+json or application/json-patch+json")
+	errPatchTestFailed  = errors.New("patch test operation failed")
+)
+
+// patchOperation — одна операция JSON Patch (RFC 6902)
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchToDo применяет тело PATCH к изменяемым полям задачи. Изменять можно только поля ToDoInput,
+// поэтому системные поля вроде id или created_at в патче — ошибка, а не молчаливая перезапись.
+func patchToDo(todo *models.ToDo, contentType string, body []byte) (ToDoInput, error) {
+	var input ToDoInput
+	data, _ := json.Marshal(toDoInputOf(todo))
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return input, err
+	}
+	fields := map[string]bool{}
+	for field := range doc {
+		fields[field] = true
+	}
+
+	var patched interface{}
+	switch contentType {
+	case mergePatchType, binding.MIMEJSON:
+		var patch map[string]interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return input, badRequest(errors.New("merge patch must be a JSON object"))
+		}
+		for field := range patch {
+			if !fields[field] {
+				return input, badRequest(fmt.Errorf("field %q cannot be changed", field))
+			}
+		}
+		patched = mergePatch(doc, patch)
+	case jsonPatchType:
+		var ops []patchOperation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return input, badRequest(errors.New("JSON patch must be an array of operations"))
+		}
+		var err error
+		if patched, err = applyJSONPatch(doc, ops, fields); err != nil {
+			return input, err
+		}
+	default:
+		return input, errUnsupportedPatch
+	}
+
+	data, _ = json.Marshal(patched)
+	if err := json.Unmarshal(data, &input); err != nil {
+		return input, badRequest(err)
+	}
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		return input, badRequest(err)
+	}
+	return input, nil
+}
+
+// mergePatch применяет JSON Merge Patch (RFC 7396): null удаляет поле, объекты сливаются, остальное заменяется
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+		} else {
+			targetObj[key] = mergePatch(targetObj[key], value)
+		}
+	}
+	return targetObj
+}
+
+// applyJSONPatch применяет операции JSON Patch по порядку. Если хотя бы одна не удалась, задача не меняется.
+func applyJSONPatch(doc interface{}, ops []patchOperation, fields map[string]bool) (interface{}, error) {
+	for i, op := range ops {
+		path, err := parsePointer(op.Path)
+		if err == nil && op.Op != "test" {
+			err = checkPatchField(path, fields)
+		}
+		if err != nil {
+			return nil, badRequest(fmt.Errorf("operation %d: %v", i, err))
+		}
+
+		var from []string
+		if op.Op == "move" || op.Op == "copy" {
+			if from, err = parsePointer(op.From); err == nil && op.Op == "move" {
+				err = checkPatchField(from, fields)
+			}
+			if err != nil {
+				return nil, badRequest(fmt.Errorf("operation %d: from: %v", i, err))
+			}
+		}
+
+		var value interface{}
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if op.Value == nil {
+				return nil, badRequest(fmt.Errorf("operation %d: value is required", i))
+			}
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, badRequest(fmt.Errorf("operation %d: %v", i, err))
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			doc, err = pointerAdd(doc, path, value)
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			if doc, _, err = pointerRemove(doc, path); err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "move":
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				err = errors.New("cannot move a value into itself")
+				break
+			}
+			var moved interface{}
+			if doc, moved, err = pointerRemove(doc, from); err == nil {
+				doc, err = pointerAdd(doc, path, moved)
+			}
+		case "copy":
+			var copied interface{}
+			if copied, err = pointerGet(doc, from); err == nil {
+				// Копия не должна делить вложенные объекты с источником
+				data, _ := json.Marshal(copied)
+				json.Unmarshal(data, &copied)
+				doc, err = pointerAdd(doc, path, copied)
+			}
+		case "test":
+			var current interface{}
+			if current, err = pointerGet(doc, path); err == nil && !reflect.DeepEqual(current, value) {
+				return nil, errPatchTestFailed
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, badRequest(fmt.Errorf("operation %d: %v", i, err))
+		}
+	}
+	return doc, nil
+}
+
+func checkPatchField(path []string, fields map[string]bool) error {
+	if len(path) == 0 || !fields[path[0]] {
+		field := ""
+		if len(path) > 0 {
+			field = path[0]
+		}
+		return fmt.Errorf("field %q cannot be changed", field)
+	}
+	return nil
+}
+
+// parsePointer разбирает JSON Pointer (RFC 6901) на токены
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// arrayIndex разбирает индекс массива. "-" и индекс за концом допустимы только при добавлении.
+func arrayIndex(token string, length int, adding bool) (int, error) {
+	if token == "-" && adding {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > length || (i == length && !adding) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerGet(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path member %q not found", token)
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("path member %q not found", token)
+		}
+	}
+	return node, nil
+}
+
+// pointerAdd добавляет value по пути и возвращает изменённый узел: массивы при вставке пересоздаются
+func pointerAdd(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("path member %q not found", token)
+		}
+		updated, err := pointerAdd(child, rest, value)
+		n[token] = updated
+		return n, err
+	case []interface{}:
+		i, err := arrayIndex(token, len(n), len(rest) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		n[i], err = pointerAdd(n[i], rest, value)
+		return n, err
+	default:
+		return nil, fmt.Errorf("path member %q not found", token)
+	}
+}
+
+// pointerRemove удаляет значение по пути и возвращает изменённый узел и удалённое значение
+func pointerRemove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole task")
+	}
+	token, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path member %q not found", token)
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+		updated, removed, err := pointerRemove(child, rest)
+		n[token] = updated
+		return n, removed, err
+	case []interface{}:
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		updated, removed, err := pointerRemove(n[i], rest)
+		n[i] = updated
+		return n, removed, err
+	default:
+		return nil, nil, fmt.Errorf("path member %q not found", token)
+	}
+}
+
+// PatchToDo godoc
+// @Summary Partially update a ToDo
+// @Description Change some fields of a ToDo item with JSON Merge Patch (application/merge-patch+json, also accepted as application/json) or JSON Patch (application/json-patch+json). Only the fields of ToDoInput can be changed. A failed JSON Patch test operation returns 409.
+// @Tags todos
+// @Accept  json
+// @Produce  json
+// @Param   id        path     int     true   "ToDo ID"
+// @Param   cascade   query    bool    false  "Complete subtasks too"
+// @Param   If-Match  header   string  false  "ETag the change is based on"
+// @Param   patch     body     object  true   "Merge patch object or JSON Patch operations"
+// @Success 200 {object} models.ToDo
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Failure 412 {object} gin.H
+// @Failure 415 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /todos/{id} [patch]
+func PatchToDo(c *gin.Context) {
+	var todo models.ToDo
+	if err := database.DB.Scopes(ownedBy(resourceOwnerID(c))).Preload("Tags").First(&todo, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+		return
+	}
+	if !checkIfMatch(c, &todo) {
+		return
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input, err := patchToDo(&todo, c.ContentType(), body)
+	switch {
+	case errors.Is(err, errUnsupportedPatch):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, errPatchTestFailed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		respondError(c, err, "Не удалось изменить задачу")
+	default:
+		saveToDo(c, todo, input)
+	}
+}
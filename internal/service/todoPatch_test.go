@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupPatchRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.POST("/todos", CreateToDo)
+	router.PUT("/todos/:id", UpdateToDo)
+	router.PATCH("/todos/:id", PatchToDo)
+	return router
+}
+
+func doPatch(router *gin.Engine, id uint, contentType, body string) (models.ToDo, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest("PATCH", idPath("/todos", id), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var todo models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	return todo, w
+}
+
+func createPatchTarget(t *testing.T, router *gin.Engine) models.ToDo {
+	w := doJSON(router, "POST", "/todos", `{"title":"Task","description":"Details","priority":"high",
+		"due_date":"2024-05-01","tags":["work","home"]}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var todo models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	return todo
+}
+
+func TestMergePatchToDo(t *testing.T) {
+	user := setupTestDB()
+	router := setupPatchRouter(user)
+	todo := createPatchTarget(t, router)
+
+	// Меняются только переданные поля
+	patched, w := doPatch(router, todo.ID, mergePatchType, `{"completed":true}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, patched.Completed)
+	assert.NotNil(t, patched.CompletedAt)
+	assert.Equal(t, "Details", patched.Description)
+	assert.Equal(t, models.PriorityHigh, patched.Priority)
+	assert.ElementsMatch(t, []string{"work", "home"}, tagNamesOfToDo(patched))
+
+	// null сбрасывает поле
+	patched, _ = doPatch(router, todo.ID, mergePatchType, `{"due_date":null,"description":null}`)
+	assert.Nil(t, patched.DueDate)
+	assert.Nil(t, patched.DueAt)
+	assert.Empty(t, patched.Description)
+
+	// Обязательное поле нельзя убрать
+	_, w = doPatch(router, todo.ID, mergePatchType, `{"title":null}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Системные и вычисляемые поля не меняются через PATCH
+	for _, body := range []string{`{"id":999}`, `{"created_at":"2000-01-01T00:00:00Z"}`, `{"user_id":2}`, `{"due_at":null}`, `{"position":"0"}`} {
+		_, w = doPatch(router, todo.ID, mergePatchType, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	var stored models.ToDo
+	database.DB.First(&stored, todo.ID)
+	assert.Equal(t, "Task", stored.Title)
+	assert.Equal(t, todo.CreatedAt.Unix(), stored.CreatedAt.Unix())
+}
+
+func TestJSONPatchToDo(t *testing.T) {
+	user := setupTestDB()
+	router := setupPatchRouter(user)
+	todo := createPatchTarget(t, router)
+
+	patched, w := doPatch(router, todo.ID, jsonPatchType, `[
+		{"op":"test","path":"/title","value":"Task"},
+		{"op":"replace","path":"/title","value":"Renamed"},
+		{"op":"add","path":"/tags/-","value":"urgent"},
+		{"op":"remove","path":"/tags/0"},
+		{"op":"copy","from":"/title","path":"/description"},
+		{"op":"remove","path":"/due_date"}
+	]`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "Renamed", patched.Title)
+	assert.Equal(t, "Renamed", patched.Description)
+	assert.ElementsMatch(t, []string{"home", "urgent"}, tagNamesOfToDo(patched))
+	assert.Nil(t, patched.DueDate)
+
+	// Неудачный test отменяет весь патч
+	_, w = doPatch(router, todo.ID, jsonPatchType, `[
+		{"op":"replace","path":"/title","value":"Lost"},
+		{"op":"test","path":"/completed","value":true}
+	]`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var stored models.ToDo
+	database.DB.First(&stored, todo.ID)
+	assert.Equal(t, "Renamed", stored.Title)
+
+	for _, body := range []string{
+		`[{"op":"replace","path":"/id","value":1}]`,
+		`[{"op":"replace","path":"/title"}]`,
+		`[{"op":"remove","path":"/tags/5"}]`,
+		`[{"op":"add","path":"","value":{}}]`,
+		`[{"op":"jump","path":"/title"}]`,
+		`[{"op":"replace","path":"/priority","value":"critical"}]`,
+		`{"op":"replace","path":"/title","value":"Not an array"}`,
+	} {
+		_, w = doPatch(router, todo.ID, jsonPatchType, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	_, w = doPatch(router, todo.ID, "text/plain", `title=Renamed`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func TestPutReplacesToDo(t *testing.T) {
+	user := setupTestDB()
+	router := setupPatchRouter(user)
+	todo := createPatchTarget(t, router)
+
+	// Title обязателен
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "PUT", idPath("/todos", todo.ID), `{"completed":true}`).Code)
+
+	// Непереданные поля сбрасываются, системные поля из тела игнорируются
+	w := doJSON(router, "PUT", idPath("/todos", todo.ID), `{"id":999,"title":"Replaced","created_at":"2000-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var replaced models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &replaced)
+	assert.Equal(t, todo.ID, replaced.ID)
+	assert.Equal(t, "Replaced", replaced.Title)
+	assert.Empty(t, replaced.Description)
+	assert.Equal(t, models.PriorityNone, replaced.Priority)
+	assert.Nil(t, replaced.DueDate)
+	assert.Empty(t, replaced.Tags)
+
+	var stored models.ToDo
+	database.DB.First(&stored, todo.ID)
+	assert.Equal(t, todo.CreatedAt.Unix(), stored.CreatedAt.Unix())
+}
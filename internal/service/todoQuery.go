@@ -0,0 +1,273 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// sortColumn описывает индексированную колонку, по которой можно сортировать список задач
+type sortColumn struct {
+	nullable bool
+	value    func(todo *models.ToDo) *string
+	parse    func(string) (interface{}, error)
+}
+
+var sortColumns = map[string]sortColumn{
+	"id":         {value: func(t *models.ToDo) *string { return formatUint(t.ID) }, parse: parseUint},
+	"created_at": {value: func(t *models.ToDo) *string { return formatTime(&t.CreatedAt) }, parse: parseTime},
+	"updated_at": {value: func(t *models.ToDo) *string { return formatTime(&t.UpdatedAt) }, parse: parseTime},
+	"due_at":     {nullable: true, value: func(t *models.ToDo) *string { return formatTime(t.DueAt) }, parse: parseTime},
+	"title":      {value: func(t *models.ToDo) *string { return &t.Title }, parse: parseString},
+	"position":   {value: func(t *models.ToDo) *string { return &t.Position }, parse: parseString},
+	"priority":   {value: func(t *models.ToDo) *string { return formatUint(uint(t.Priority)) }, parse: parseUint},
+}
+
+func formatUint(v uint) *string {
+	s := strconv.FormatUint(uint64(v), 10)
+	return &s
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339Nano)
+	return &s
+}
+
+func parseUint(s string) (interface{}, error)   { return strconv.ParseUint(s, 10, 64) }
+func parseTime(s string) (interface{}, error)   { return time.Parse(time.RFC3339Nano, s) }
+func parseString(s string) (interface{}, error) { return s, nil }
+
+// cursor указывает на последнюю задачу предыдущей страницы. Сортировка, для которой он выдан,
+// хранится в нём же: с другой сортировкой значение курсора сравнивалось бы не с той колонкой.
+type cursor struct {
+	Sort  string  `json:"s"`
+	Desc  bool    `json:"d,omitempty"`
+	Value *string `json:"v"`
+	ID    uint    `json:"id"`
+}
+
+func (cur cursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var cur cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cur, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return cur, errors.New("invalid cursor")
+	}
+	return cur, nil
+}
+
+// page — параметры сортировки и постраничного вывода
+type page struct {
+	sort   string
+	desc   bool
+	limit  int
+	cursor *cursor
+}
+
+func parsePage(c *gin.Context) (page, error) {
+	p := page{sort: c.DefaultQuery("sort", "position"), limit: defaultPageSize}
+
+	if _, ok := sortColumns[p.sort]; !ok {
+		return p, fmt.Errorf("cannot sort by %q", p.sort)
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		p.desc = true
+	default:
+		return p, errors.New("order must be asc or desc")
+	}
+
+	if s := c.Query("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return p, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		p.limit = limit
+	}
+
+	if s := c.Query("cursor"); s != "" {
+		cur, err := decodeCursor(s)
+		if err != nil {
+			return p, err
+		}
+		if cur.Sort != p.sort || cur.Desc != p.desc {
+			return p, errors.New("cursor does not match sort and order")
+		}
+		p.cursor = &cur
+	}
+	return p, nil
+}
+
+// scope сортирует запрос и пропускает задачи до курсора включительно.
+// Задачи без значения колонки всегда идут в конце, ID разрешает равенство значений.
+func (p page) scope(db *gorm.DB) (*gorm.DB, error) {
+	col := sortColumns[p.sort]
+	dir, cmp := "ASC", ">"
+	if p.desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	if p.cursor != nil {
+		if p.cursor.Value == nil {
+			db = db.Where(fmt.Sprintf("%s IS NULL AND id %s ?", p.sort, cmp), p.cursor.ID)
+		} else {
+			value, err := col.parse(*p.cursor.Value)
+			if err != nil {
+				return nil, errors.New("invalid cursor")
+			}
+			cond := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", p.sort, cmp)
+			if col.nullable {
+				cond = fmt.Sprintf("(%s OR %s IS NULL)", cond, p.sort)
+			}
+			db = db.Where(cond, value, value, p.cursor.ID)
+		}
+	}
+
+	if col.nullable {
+		db = db.Order(fmt.Sprintf("%s IS NULL", p.sort))
+	}
+	if p.sort != "id" {
+		db = db.Order(fmt.Sprintf("%s %s", p.sort, dir))
+	}
+	return db.Order("id " + dir).Limit(p.limit + 1), nil
+}
+
+// next возвращает курсор следующей страницы и обрезает лишнюю задачу, если она есть
+func (p page) next(todos []models.ToDo) ([]models.ToDo, string) {
+	if len(todos) <= p.limit {
+		return todos, ""
+	}
+	todos = todos[:p.limit]
+	last := &todos[len(todos)-1]
+	return todos, cursor{Sort: p.sort, Desc: p.desc, Value: sortColumns[p.sort].value(last), ID: last.ID}.encode()
+}
+
+// toDoFilters собирает условия отбора задач из параметров запроса, кроме текстового q
+func toDoFilters(c *gin.Context) ([]func(*gorm.DB) *gorm.DB, error) {
+	var filters []func(*gorm.DB) *gorm.DB
+
+	if s := c.Query("completed"); s != "" {
+		completed, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("completed must be true or false")
+		}
+		filters = append(filters, func(db *gorm.DB) *gorm.DB {
+			return db.Where("completed = ?", completed)
+		})
+	}
+
+	if s := c.Query("parent_id"); s != "" {
+		parentID, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, errors.New("parent_id must be a task ID")
+		}
+		filters = append(filters, func(db *gorm.DB) *gorm.DB {
+			return db.Where("parent_id = ?", parentID)
+		})
+	}
+
+	ranges := []struct{ param, cond string }{
+		{"created_after", "created_at >= ?"},
+		{"created_before", "created_at < ?"},
+		{"updated_after", "updated_at >= ?"},
+		{"updated_before", "updated_at < ?"},
+	}
+	for _, r := range ranges {
+		s := c.Query(r.param)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", r.param)
+		}
+		// created_at и updated_at gorm записывает в локальном времени
+		cond, t := r.cond, t.Local()
+		filters = append(filters, func(db *gorm.DB) *gorm.DB {
+			return db.Where(cond, t)
+		})
+	}
+
+	if s := c.Query("tags"); s != "" {
+		names, err := normalizeTagNames(strings.Split(s, ","))
+		if err != nil {
+			return nil, err
+		}
+		filter, err := tagFilter(names, c.DefaultQuery("tag_mode", "any"))
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	if mode := c.Query("due"); mode != "" {
+		loc, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+		if err != nil {
+			return nil, errors.New("unknown timezone")
+		}
+		filter, err := dueFilter(mode, loc, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// limitOffset разбирает параметры постраничного вывода limit и offset
+func limitOffset(c *gin.Context, defaultLimit, maxLimit int) (int, int, error) {
+	limit, offset := defaultLimit, 0
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		limit = n
+	}
+	if s := c.Query("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("offset must be a non-negative number")
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// containsFilter отбирает задачи, в названии или описании которых есть подстрока q без учёта регистра
+func containsFilter(q string) func(*gorm.DB) *gorm.DB {
+	pattern := "%" + escapeLike(strings.ToLower(q)) + "%"
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(LOWER(title) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupListRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/todos", GetAllToDos)
+	return router
+}
+
+func listTitles(t *testing.T, router *gin.Engine, query string) ([]string, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest("GET", "/todos?"+query, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var todos []models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todos)
+	titles := []string{}
+	for _, todo := range todos {
+		titles = append(titles, todo.Title)
+	}
+	return titles, w
+}
+
+// walkPages проходит по всем страницам и возвращает заголовки в порядке выдачи
+func walkPages(t *testing.T, router *gin.Engine, query string) []string {
+	var all []string
+	next := ""
+	for i := 0; i < 10; i++ {
+		q := query
+		if next != "" {
+			q += "&cursor=" + url.QueryEscape(next)
+		}
+		titles, w := listTitles(t, router, q)
+		all = append(all, titles...)
+		next = w.Header().Get("X-Next-Cursor")
+		if next == "" {
+			return all
+		}
+	}
+	t.Fatal("pagination did not finish")
+	return nil
+}
+
+func TestGetAllToDosCursorPagination(t *testing.T) {
+	user := setupTestDB()
+	router := setupListRouter(user)
+
+	day := func(d int) *time.Time {
+		t := time.Date(2024, 5, d, 12, 0, 0, 0, time.UTC)
+		return &t
+	}
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "c", DueAt: day(3)})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "a"})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "e", DueAt: day(1)})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "b", DueAt: day(3)})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "d"})
+
+	titles, w := listTitles(t, router, "limit=2")
+	assert.Equal(t, []string{"c", "a"}, titles)
+	assert.Equal(t, "5", w.Header().Get("X-Total-Count"))
+	assert.NotEmpty(t, w.Header().Get("X-Next-Cursor"))
+
+	assert.Equal(t, []string{"c", "a", "e", "b", "d"}, walkPages(t, router, "limit=2"))
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, walkPages(t, router, "limit=2&sort=title"))
+	assert.Equal(t, []string{"e", "d", "c", "b", "a"}, walkPages(t, router, "limit=3&sort=title&order=desc"))
+
+	// Задачи без срока идут в конце, равные сроки упорядочены по ID
+	assert.Equal(t, []string{"e", "c", "b", "a", "d"}, walkPages(t, router, "limit=2&sort=due_at"))
+	assert.Equal(t, []string{"b", "c", "e", "d", "a"}, walkPages(t, router, "limit=2&sort=due_at&order=desc"))
+	assert.Equal(t, []string{"d", "b", "e", "a", "c"}, walkPages(t, router, "limit=1&sort=created_at&order=desc"))
+}
+
+func TestGetAllToDosFilters(t *testing.T) {
+	user := setupTestDB()
+	router := setupListRouter(user)
+
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Buy milk", Description: "2% fat"})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Call mom", Completed: true})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Write report", Description: "Quarterly MILK sales"})
+
+	titles, w := listTitles(t, router, "completed=true")
+	assert.Equal(t, []string{"Call mom"}, titles)
+	assert.Equal(t, "1", w.Header().Get("X-Total-Count"))
+
+	titles, _ = listTitles(t, router, "q=milk")
+	assert.Equal(t, []string{"Buy milk", "Write report"}, titles)
+
+	// Спецсимволы LIKE ищутся буквально
+	titles, _ = listTitles(t, router, "q="+url.QueryEscape("2%"))
+	assert.Equal(t, []string{"Buy milk"}, titles)
+	titles, _ = listTitles(t, router, "q="+url.QueryEscape("%"))
+	assert.Equal(t, []string{"Buy milk"}, titles)
+
+	titles, _ = listTitles(t, router, "completed=false&q=report")
+	assert.Equal(t, []string{"Write report"}, titles)
+
+	past := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	titles, _ = listTitles(t, router, "created_after="+past+"&updated_before="+future)
+	assert.Len(t, titles, 3)
+	titles, _ = listTitles(t, router, "created_after="+future)
+	assert.Empty(t, titles)
+}
+
+func TestGetAllToDosInvalidParams(t *testing.T) {
+	user := setupTestDB()
+	router := setupListRouter(user)
+
+	for _, query := range []string{
+		"sort=description",
+		"order=sideways",
+		"limit=0",
+		"limit=1000",
+		"cursor=not-a-cursor",
+		"completed=maybe",
+		"created_after=yesterday",
+	} {
+		req, _ := http.NewRequest("GET", "/todos?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestGetAllToDosCursorSortMismatch(t *testing.T) {
+	user := setupTestDB()
+	router := setupListRouter(user)
+	for _, title := range []string{"a", "b", "c"} {
+		database.DB.Create(&models.ToDo{UserID: user.ID, Title: title})
+	}
+
+	_, w := listTitles(t, router, "sort=title&limit=1")
+	next := url.QueryEscape(w.Header().Get("X-Next-Cursor"))
+	titles, _ := listTitles(t, router, "sort=title&limit=1&cursor="+next)
+	assert.Equal(t, []string{"b"}, titles)
+
+	// Курсор годится только для той сортировки, с которой его выдали
+	for _, query := range []string{"limit=1", "sort=created_at&limit=1", "sort=title&order=desc&limit=1"} {
+		req, _ := http.NewRequest("GET", "/todos?"+query+"&cursor="+next, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Contains(t, w.Body.String(), "cursor does not match sort and order", query)
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOccurrencePreview = 5
+	maxOccurrencePreview     = 100
+)
+
+// Occurrence — срок одного из будущих повторений задачи
+type Occurrence struct {
+	DueDate string    `json:"due_date"`
+	DueAt   time.Time `json:"due_at"`
+}
+
+// applyRecurrence проверяет правило повторения и определяет начало серии.
+// Вызывается после applySchedule, когда срок и часовой пояс уже проверены.
+func applyRecurrence(todo *models.ToDo, previous *models.ToDo) error {
+	normalizeEmpty(&todo.Recurrence)
+	if todo.Recurrence == nil {
+		todo.RecurrenceStart = nil
+		return nil
+	}
+	if todo.DueDate == nil {
+		return errors.New("recurrence requires due_date")
+	}
+	loc, _ := time.LoadLocation(todo.Timezone)
+	if _, err := parseRecurrence(*todo.Recurrence, loc); err != nil {
+		return err
+	}
+
+	// Новое правило, пояс или время суток начинают серию заново с текущего срока
+	if previous == nil || previous.Recurrence == nil || previous.RecurrenceStart == nil ||
+		*previous.Recurrence != *todo.Recurrence ||
+		previous.Timezone != todo.Timezone ||
+		!sameString(previous.DueTime, todo.DueTime) {
+		start := *todo.DueDate
+		todo.RecurrenceStart = &start
+	} else {
+		todo.RecurrenceStart = previous.RecurrenceStart
+	}
+	return nil
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// upcomingOccurrences возвращает до n сроков повторений задачи после её текущего срока
+func upcomingOccurrences(todo *models.ToDo, n int) ([]time.Time, error) {
+	if todo.Recurrence == nil || todo.DueAt == nil {
+		return nil, errors.New("task does not recur")
+	}
+	loc, err := time.LoadLocation(todo.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	rule, err := parseRecurrence(*todo.Recurrence, loc)
+	if err != nil {
+		return nil, err
+	}
+	startDate := todo.DueDate
+	if todo.RecurrenceStart != nil {
+		startDate = todo.RecurrenceStart
+	}
+	start, err := parseDue(*startDate, todo.DueTime, loc)
+	if err != nil {
+		return nil, err
+	}
+	return rule.occurrences(start.In(loc), *todo.DueAt, n), nil
+}
+
+// createNextOccurrence создаёт следующее повторение выполненной задачи с теми же полями и метками.
+// Серия продолжается в новой задаче, поэтому у выполненной правило убирается. Возвращает nil, если серия закончилась.
+func createNextOccurrence(tx *gorm.DB, todo *models.ToDo, now time.Time) (*models.ToDo, error) {
+	dates, err := upcomingOccurrences(todo, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	recurrence, start := todo.Recurrence, todo.RecurrenceStart
+	if err := tx.Model(todo).Updates(map[string]interface{}{"recurrence": nil, "recurrence_start": nil}).Error; err != nil {
+		return nil, err
+	}
+	if len(dates) == 0 {
+		return nil, nil
+	}
+
+	dueDate := dates[0].Format(dueDateLayout)
+	next := models.ToDo{
+		UserID:          todo.UserID,
+		WorkspaceID:     todo.WorkspaceID,
+		Version:         1,
+		ProjectID:       todo.ProjectID,
+		ParentID:        todo.ParentID,
+		Title:           todo.Title,
+		Description:     todo.Description,
+		Priority:        todo.Priority,
+		DueDate:         &dueDate,
+		DueTime:         todo.DueTime,
+		Timezone:        todo.Timezone,
+		ReminderOffset:  todo.ReminderOffset,
+		Recurrence:      recurrence,
+		RecurrenceStart: start,
+	}
+	if err := applySchedule(&next, nil, now); err != nil {
+		return nil, err
+	}
+	if next.Position, err = nextPosition(tx, spaceOf(&next)); err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&next).Error; err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(todo.Tags))
+	for _, tag := range todo.Tags {
+		names = append(names, tag.Name)
+	}
+	if err := setToDoTags(tx, &next, names); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// GetToDoOccurrences godoc
+// @Summary Preview occurrences of a recurring ToDo
+// @Description List the due dates of the next occurrences of a recurring ToDo after its current due date
+// @Tags todos
+// @Produce  json
+// @Param   id     path     int  true   "ToDo ID"
+// @Param   count  query    int  false  "Number of occurrences, 5 by default, at most 100"
+// @Success 200 {array} Occurrence
+// @Failure 400 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /todos/{id}/occurrences [get]
+func GetToDoOccurrences(c *gin.Context) {
+	count := defaultOccurrencePreview
+	if s := c.Query("count"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxOccurrencePreview {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("count must be between 1 and %d", maxOccurrencePreview)})
+			return
+		}
+		count = n
+	}
+
+	var todo models.ToDo
+	if err := database.DB.Scopes(ownedBy(resourceOwnerID(c))).First(&todo, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+		return
+	}
+
+	dates, err := upcomingOccurrences(&todo, count)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	occurrences := make([]Occurrence, 0, len(dates))
+	for _, date := range dates {
+		occurrences = append(occurrences, Occurrence{DueDate: date.Format(dueDateLayout), DueAt: date.UTC()})
+	}
+	c.JSON(http.StatusOK, occurrences)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRecurrenceRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.POST("/todos", CreateToDo)
+	router.PUT("/todos/:id", UpdateToDo)
+	router.PATCH("/todos/:id", PatchToDo)
+	router.GET("/todos/:id/occurrences", GetToDoOccurrences)
+	return router
+}
+
+func TestCompleteRecurringToDoCreatesNextOccurrence(t *testing.T) {
+	user := setupTestDB()
+	router := setupRecurrenceRouter(user)
+
+	w := doJSON(router, "POST", "/todos", `{"title":"Standup","due_date":"2024-03-29","due_time":"09:00",
+		"timezone":"Europe/Berlin","recurrence":"FREQ=WEEKLY;BYDAY=MO,FR;COUNT=3","tags":["work"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var todo models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	assert.Equal(t, "2024-03-29", *todo.RecurrenceStart)
+
+	w = doJSON(router, "PATCH", idPath("/todos", todo.ID), `{"completed":true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var completed models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &completed)
+	assert.Nil(t, completed.Recurrence)
+	if !assert.NotNil(t, completed.NextOccurrence) {
+		t.FailNow()
+	}
+
+	// Понедельник уже по летнему времени, но в то же время суток
+	next := *completed.NextOccurrence
+	assert.Equal(t, "2024-04-01", *next.DueDate)
+	assert.Equal(t, "2024-04-01T07:00:00Z", next.DueAt.UTC().Format("2006-01-02T15:04:05Z"))
+	assert.False(t, next.Completed)
+	assert.Equal(t, "2024-03-29", *next.RecurrenceStart)
+	assert.Equal(t, []string{"work"}, tagNamesOfToDo(next))
+
+	// Повторное сохранение выполненной задачи не создаёт новых повторений
+	doJSON(router, "PATCH", idPath("/todos", todo.ID), `{"completed":true}`)
+	var count int64
+	database.DB.Model(&models.ToDo{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// Третье повторение — последнее по COUNT
+	w = doJSON(router, "PATCH", idPath("/todos", next.ID), `{"completed":true}`)
+	json.Unmarshal(w.Body.Bytes(), &completed)
+	assert.Equal(t, "2024-04-05", *completed.NextOccurrence.DueDate)
+
+	w = doJSON(router, "PATCH", idPath("/todos", completed.NextOccurrence.ID), `{"completed":true}`)
+	completed = models.ToDo{}
+	json.Unmarshal(w.Body.Bytes(), &completed)
+	assert.Nil(t, completed.NextOccurrence)
+}
+
+func TestRecurrenceValidation(t *testing.T) {
+	user := setupTestDB()
+	router := setupRecurrenceRouter(user)
+
+	w := doJSON(router, "POST", "/todos", `{"title":"No date","recurrence":"FREQ=DAILY"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(router, "POST", "/todos", `{"title":"Bad rule","due_date":"2024-01-01","recurrence":"FREQ=SOMETIMES"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetToDoOccurrences(t *testing.T) {
+	user := setupTestDB()
+	router := setupRecurrenceRouter(user)
+
+	w := doJSON(router, "POST", "/todos", `{"title":"Rent","due_date":"2024-01-31","recurrence":"FREQ=MONTHLY;BYMONTHDAY=-1"}`)
+	var todo models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todo)
+
+	w = doJSON(router, "GET", idPath("/todos", todo.ID)+"/occurrences?count=3", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var occurrences []Occurrence
+	json.Unmarshal(w.Body.Bytes(), &occurrences)
+	if !assert.Len(t, occurrences, 3) {
+		t.FailNow()
+	}
+	assert.Equal(t, "2024-02-29", occurrences[0].DueDate)
+	assert.Equal(t, "2024-04-30", occurrences[2].DueDate)
+	assert.Equal(t, "2024-02-29T23:59:59Z", occurrences[0].DueAt.Format("2006-01-02T15:04:05Z"))
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", idPath("/todos", todo.ID)+"/occurrences?count=0", "").Code)
+
+	w = doJSON(router, "POST", "/todos", `{"title":"Once"}`)
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", idPath("/todos", todo.ID)+"/occurrences", "").Code)
+}
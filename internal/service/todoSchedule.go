@@ -0,0 +1,117 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"todo-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	dueDateLayout = "2006-01-02"
+	dueTimeLayout = "15:04"
+)
+
+// applySchedule проверяет поля срока и напоминания и вычисляет DueAt, RemindAt и CompletedAt.
+// previous — состояние задачи до изменения, nil при создании.
+func applySchedule(todo *models.ToDo, previous *models.ToDo, now time.Time) error {
+	normalizeEmpty(&todo.DueDate)
+	normalizeEmpty(&todo.DueTime)
+
+	if todo.Timezone == "" {
+		todo.Timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(todo.Timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %q", todo.Timezone)
+	}
+
+	todo.DueAt, todo.RemindAt = nil, nil
+	if todo.DueDate == nil {
+		if todo.DueTime != nil {
+			return errors.New("due_time requires due_date")
+		}
+		if todo.ReminderOffset != nil {
+			return errors.New("reminder_offset requires due_date")
+		}
+	} else {
+		dueAt, err := parseDue(*todo.DueDate, todo.DueTime, loc)
+		if err != nil {
+			return err
+		}
+		todo.DueAt = &dueAt
+
+		if todo.ReminderOffset != nil {
+			// Отрицательное смещение означало бы напоминание после срока
+			if *todo.ReminderOffset < 0 {
+				return errors.New("reminder must not be after the due time")
+			}
+			remindAt := dueAt.Add(-time.Duration(*todo.ReminderOffset) * time.Minute)
+			todo.RemindAt = &remindAt
+		}
+	}
+
+	switch {
+	case !todo.Completed:
+		todo.CompletedAt = nil
+	case previous != nil && previous.Completed:
+		todo.CompletedAt = previous.CompletedAt
+	default:
+		completedAt := now.UTC()
+		todo.CompletedAt = &completedAt
+	}
+	return nil
+}
+
+// parseDue возвращает момент срока в UTC. Без времени срок длится до конца дня.
+func parseDue(date string, clock *string, loc *time.Location) (time.Time, error) {
+	day, err := time.ParseInLocation(dueDateLayout, date, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("due_date must be in %s format", dueDateLayout)
+	}
+	if clock == nil {
+		return day.AddDate(0, 0, 1).Add(-time.Second).UTC(), nil
+	}
+
+	t, err := time.Parse(dueTimeLayout, *clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("due_time must be in %s format", dueTimeLayout)
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, loc).UTC(), nil
+}
+
+func normalizeEmpty(s **string) {
+	if *s != nil && **s == "" {
+		*s = nil
+	}
+}
+
+// dueFilter ограничивает список задач режимом due: overdue, today или week.
+// Границы дня и недели считаются в часовом поясе loc.
+func dueFilter(mode string, loc *time.Location, now time.Time) (func(*gorm.DB) *gorm.DB, error) {
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	var from, to time.Time
+	switch mode {
+	case "overdue":
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("due_at < ? AND completed = ?", now.UTC(), false)
+		}, nil
+	case "today":
+		from, to = today, today.AddDate(0, 0, 1)
+	case "week":
+		// Неделя начинается с понедельника
+		offset := (int(today.Weekday()) + 6) % 7
+		from = today.AddDate(0, 0, -offset)
+		to = from.AddDate(0, 0, 7)
+	default:
+		return nil, fmt.Errorf("unknown due filter %q", mode)
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("due_at >= ? AND due_at < ?", from.UTC(), to.UTC())
+	}, nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func strPtr(s string) *string { return &s }
+func intPtr(i int) *int       { return &i }
+
+func TestApplyScheduleComputesDueAndReminder(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Дата и время в часовом поясе пользователя
+	todo := models.ToDo{DueDate: strPtr("2024-03-31"), DueTime: strPtr("09:30"), Timezone: "Europe/Berlin", ReminderOffset: intPtr(45)}
+	assert.NoError(t, applySchedule(&todo, nil, now))
+	assert.Equal(t, time.Date(2024, 3, 31, 7, 30, 0, 0, time.UTC), *todo.DueAt) // уже летнее время, UTC+2
+	assert.Equal(t, time.Date(2024, 3, 31, 6, 45, 0, 0, time.UTC), *todo.RemindAt)
+
+	// Без времени срок длится до конца дня
+	todo = models.ToDo{DueDate: strPtr("2024-03-10")}
+	assert.NoError(t, applySchedule(&todo, nil, now))
+	assert.Equal(t, "UTC", todo.Timezone)
+	assert.Equal(t, time.Date(2024, 3, 10, 23, 59, 59, 0, time.UTC), *todo.DueAt)
+	assert.Nil(t, todo.RemindAt)
+
+	// Пустые строки очищают срок
+	todo = models.ToDo{DueDate: strPtr(""), DueTime: strPtr("")}
+	assert.NoError(t, applySchedule(&todo, nil, now))
+	assert.Nil(t, todo.DueDate)
+	assert.Nil(t, todo.DueAt)
+}
+
+func TestApplyScheduleValidation(t *testing.T) {
+	now := time.Now()
+	cases := map[string]models.ToDo{
+		"bad date":              {DueDate: strPtr("31.12.2024")},
+		"bad time":              {DueDate: strPtr("2024-12-31"), DueTime: strPtr("25:00")},
+		"time without date":     {DueTime: strPtr("10:00")},
+		"unknown timezone":      {DueDate: strPtr("2024-12-31"), Timezone: "Mars/Olympus"},
+		"reminder without date": {ReminderOffset: intPtr(10)},
+		"reminder after due":    {DueDate: strPtr("2024-12-31"), ReminderOffset: intPtr(-5)},
+	}
+	for name, todo := range cases {
+		assert.Error(t, applySchedule(&todo, nil, now), name)
+	}
+}
+
+func TestApplyScheduleCompletedAt(t *testing.T) {
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := first.Add(time.Hour)
+
+	todo := models.ToDo{Completed: true}
+	assert.NoError(t, applySchedule(&todo, nil, first))
+	assert.Equal(t, first, *todo.CompletedAt)
+
+	// Повторное сохранение выполненной задачи не сдвигает время выполнения
+	previous := todo
+	updated := models.ToDo{Completed: true}
+	assert.NoError(t, applySchedule(&updated, &previous, later))
+	assert.Equal(t, first, *updated.CompletedAt)
+
+	// Снятие отметки очищает время выполнения
+	updated.Completed = false
+	assert.NoError(t, applySchedule(&updated, &previous, later))
+	assert.Nil(t, updated.CompletedAt)
+}
+
+func TestGetAllToDosDueFilters(t *testing.T) {
+	user := setupTestDB()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/todos", GetAllToDos)
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day(), 23, 59, 59, 0, time.UTC)
+	inTenDays := now.AddDate(0, 0, 10)
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Overdue", DueAt: &yesterday})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Done overdue", DueAt: &yesterday, Completed: true})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Today", DueAt: &endOfToday})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Later", DueAt: &inTenDays})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "No due date"})
+
+	titles := func(url string) []string {
+		req, _ := http.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var todos []models.ToDo
+		json.Unmarshal(w.Body.Bytes(), &todos)
+		var result []string
+		for _, todo := range todos {
+			result = append(result, todo.Title)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"Overdue"}, titles("/todos?due=overdue"))
+	assert.Equal(t, []string{"Today"}, titles("/todos?due=today&tz=UTC"))
+	assert.NotContains(t, titles("/todos?due=week"), "Later")
+
+	req, _ := http.NewRequest("GET", "/todos?due=someday", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDueFilterWeekStartsOnMonday(t *testing.T) {
+	user := setupTestDB()
+	loc, _ := time.LoadLocation("Europe/Moscow")
+
+	// Среда 6 марта 2024 года, неделя — с 4 по 10 марта по Москве
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, loc)
+	sunday := time.Date(2024, 3, 10, 23, 0, 0, 0, loc).UTC()
+	nextMonday := time.Date(2024, 3, 11, 0, 30, 0, 0, loc).UTC()
+	lastSunday := time.Date(2024, 3, 3, 23, 0, 0, 0, loc).UTC()
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Sunday", DueAt: &sunday})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Next Monday", DueAt: &nextMonday})
+	database.DB.Create(&models.ToDo{UserID: user.ID, Title: "Last Sunday", DueAt: &lastSunday})
+
+	filter, err := dueFilter("week", loc, now)
+	assert.NoError(t, err)
+
+	var todos []models.ToDo
+	database.DB.Scopes(filter).Find(&todos)
+	assert.Len(t, todos, 1)
+	assert.Equal(t, "Sunday", todos[0].Title)
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+
+	// Границы совпадений в подсветке. Символы из области для частного использования не встречаются
+	// в обычном тексте, поэтому текст можно экранировать уже после подсветки.
+	markStart = "\ue000"
+	markEnd   = "\ue001"
+
+	// snippetRunes — длина фрагмента описания вокруг совпадения при поиске через LIKE
+	snippetRunes = 80
+)
+
+// SearchHighlights — название и фрагмент описания задачи, где совпадения обёрнуты в <mark>.
+// Остальной текст экранирован для HTML.
+type SearchHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// SearchResult — найденная задача с релевантностью и подсветкой совпадений
+type SearchResult struct {
+	models.ToDo
+	Rank       float64          `json:"rank"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// searchHit — строка результата поиска до загрузки самих задач
+type searchHit struct {
+	ID          uint
+	Score       float64
+	Title       string
+	Description string
+}
+
+// searchBackend выбирает способ поиска: tsvector в Postgres, FTS5 в SQLite, если он собран, иначе LIKE
+func searchBackend(db *gorm.DB) string {
+	switch {
+	case db.Dialector.Name() == "postgres":
+		return "postgres"
+	case db.Migrator().HasTable(database.SearchTable):
+		return "fts5"
+	default:
+		return "like"
+	}
+}
+
+// searchPostgres ищет по колонке search_vector. websearch_to_tsquery понимает кавычки, or и минус.
+func searchPostgres(candidates *gorm.DB, q string) (*gorm.DB, string, []interface{}) {
+	query := "websearch_to_tsquery('russian', ?)"
+	titleOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", markStart, markEnd)
+	descriptionOptions := fmt.Sprintf(`StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=" … "`, markStart, markEnd)
+	selection := fmt.Sprintf("id, ts_rank(search_vector, %[1]s) AS score, "+
+		"ts_headline('russian', title, %[1]s, ?) AS title, "+
+		"ts_headline('russian', description, %[1]s, ?) AS description", query)
+	return candidates.Where("search_vector @@ "+query, q), selection, []interface{}{q, q, titleOptions, q, descriptionOptions}
+}
+
+// searchFTS5 ищет по таблице FTS5. Каждое слово запроса берётся в кавычки, чтобы синтаксис FTS5 не мешал поиску.
+func searchFTS5(candidates *gorm.DB, terms []string) (*gorm.DB, string, []interface{}) {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	// bm25 тем меньше, чем лучше совпадение, а совпадение в названии весит вдвое больше
+	selection := "rowid AS id, -bm25(to_dos_fts, 2.0, 1.0) AS score, " +
+		"highlight(to_dos_fts, 0, ?, ?) AS title, " +
+		"snippet(to_dos_fts, 1, ?, ?, '…', 16) AS description"
+	query := database.DB.Table(database.SearchTable).
+		Where("to_dos_fts MATCH ?", strings.Join(quoted, " ")).
+		Where("rowid IN (?)", candidates.Select("id"))
+	return query, selection, []interface{}{markStart, markEnd, markStart, markEnd}
+}
+
+// searchLike ищет задачи, где есть все слова запроса. Слово в названии весит вдвое больше, чем в описании.
+func searchLike(candidates *gorm.DB, terms []string) (*gorm.DB, string, []interface{}) {
+	var score []string
+	var args []interface{}
+	for _, term := range terms {
+		pattern := "%" + escapeLike(strings.ToLower(term)) + "%"
+		candidates = containsFilter(term)(candidates)
+		score = append(score, `CASE WHEN LOWER(title) LIKE ? ESCAPE '\' THEN 2 ELSE 0 END + CASE WHEN LOWER(description) LIKE ? ESCAPE '\' THEN 1 ELSE 0 END`)
+		args = append(args, pattern, pattern)
+	}
+	return candidates, fmt.Sprintf("id, (%s) AS score, title, description", strings.Join(score, " + ")), args
+}
+
+// markTerms оборачивает вхождения слов в границы подсветки без учёта регистра
+func markTerms(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// Смещения в строке в нижнем регистре не совпадают с исходной, подсветить нельзя
+		return text
+	}
+	marked := make([]bool, len(text))
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		for from := 0; term != ""; {
+			i := strings.Index(lower[from:], term)
+			if i < 0 {
+				break
+			}
+			for j := from + i; j < from+i+len(term); j++ {
+				marked[j] = true
+			}
+			from += i + len(term)
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString(markStart)
+		}
+		b.WriteByte(text[i])
+		if marked[i] && (i == len(text)-1 || !marked[i+1]) {
+			b.WriteString(markEnd)
+		}
+	}
+	return b.String()
+}
+
+// snippetAround вырезает из текста фрагмент вокруг первой подсветки
+func snippetAround(text string) string {
+	runes := []rune(text)
+	if len(runes) <= snippetRunes {
+		return text
+	}
+	start := 0
+	if i := strings.Index(text, markStart); i >= 0 {
+		start = max(len([]rune(text[:i]))-snippetRunes/4, 0)
+	}
+	end := min(start+snippetRunes, len(runes))
+	snippet := string(runes[start:end])
+	// Граница не должна разрезать подсветку
+	if strings.Count(snippet, markStart) > strings.Count(snippet, markEnd) {
+		snippet += markEnd
+	}
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// renderHighlight экранирует текст для HTML и заменяет границы подсветки на <mark>
+func renderHighlight(text string) string {
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(html.EscapeString(text))
+}
+
+// SearchToDos godoc
+// @Summary Search ToDos
+// @Description Full-text search over titles and descriptions of the current user's ToDo items, best matches first. Words are matched by their stem, matches in the title weigh more. Highlights wrap matches in <mark> and escape the rest for HTML. Accepts the filters of GET /todos. The total number of matches is returned in X-Total-Count.
+// @Tags todos
+// @Produce  json
+// @Param   q       query    string  true   "Search query"
+// @Param   limit   query    int     false  "Page size, 20 by default, at most 100"
+// @Param   offset  query    int     false  "Number of results to skip"
+// @Success 200 {array} SearchResult
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /todos/search [get]
+func SearchToDos(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	terms := strings.Fields(q)
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit, offset, err := limitOffset(c, defaultSearchLimit, maxSearchLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filters, err := toDoFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	candidates := database.DB.Model(&models.ToDo{}).
+		Scopes(currentSpace(c).scope).
+		Scopes(filters...)
+
+	backend := searchBackend(database.DB)
+	var query *gorm.DB
+	var selection string
+	var args []interface{}
+	switch backend {
+	case "postgres":
+		query, selection, args = searchPostgres(candidates, q)
+	case "fts5":
+		query, selection, args = searchFTS5(candidates, terms)
+	default:
+		query, selection, args = searchLike(candidates, terms)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось найти задачи"})
+		return
+	}
+	var hits []searchHit
+	err = query.Select(selection, args...).
+		Order("score DESC").Order("id").
+		Limit(limit).Offset(offset).
+		Scan(&hits).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось найти задачи"})
+		return
+	}
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	var todos []models.ToDo
+	if err := database.DB.Preload("Tags").Find(&todos, ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось найти задачи"})
+		return
+	}
+	if err := attachProgress(database.DB, todos); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось найти задачи"})
+		return
+	}
+	byID := make(map[uint]models.ToDo, len(todos))
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		todo, ok := byID[hit.ID]
+		if !ok {
+			continue
+		}
+		title, description := hit.Title, hit.Description
+		if backend == "like" {
+			title = markTerms(title, terms)
+			description = snippetAround(markTerms(description, terms))
+		}
+		results = append(results, SearchResult{
+			ToDo:       todo,
+			Rank:       hit.Score,
+			Highlights: SearchHighlights{Title: renderHighlight(title), Description: renderHighlight(description)},
+		})
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSearchRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.POST("/todos", CreateToDo)
+	router.GET("/todos/search", SearchToDos)
+	router.PATCH("/todos/:id", PatchToDo)
+	router.DELETE("/todos/:id", DeleteToDo)
+	return router
+}
+
+func search(t *testing.T, router *gin.Engine, query string) []SearchResult {
+	w := doJSON(router, "GET", "/todos/search?"+query, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var results []SearchResult
+	json.Unmarshal(w.Body.Bytes(), &results)
+	return results
+}
+
+func searchTitles(results []SearchResult) []string {
+	titles := []string{}
+	for _, result := range results {
+		titles = append(titles, result.Title)
+	}
+	return titles
+}
+
+func TestSearchToDos(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+	router := setupSearchRouter(user)
+
+	createTagged(t, router, `{"title":"Call the plumber","description":"Ask about the milk <b>fridge</b> too"}`)
+	createTagged(t, router, `{"title":"Buy milk","description":"Two bottles"}`)
+	createTagged(t, router, `{"title":"Walk the dog"}`)
+	database.DB.Create(&models.ToDo{UserID: other.ID, Title: "Milk for the other user"})
+
+	// Совпадение в названии важнее совпадения в описании
+	results := search(t, router, "q=milk")
+	assert.Equal(t, []string{"Buy milk", "Call the plumber"}, searchTitles(results))
+	assert.Greater(t, results[0].Rank, results[1].Rank)
+	assert.Equal(t, "Buy <mark>milk</mark>", results[0].Highlights.Title)
+	assert.Contains(t, results[1].Highlights.Description, "<mark>milk</mark>")
+	assert.Contains(t, results[1].Highlights.Description, "&lt;b&gt;fridge&lt;/b&gt;")
+
+	// Все слова запроса должны найтись
+	assert.Equal(t, []string{"Call the plumber"}, searchTitles(search(t, router, "q=plumber+milk")))
+	assert.Empty(t, search(t, router, "q=plumber+dog"))
+
+	w := doJSON(router, "GET", "/todos/search?q=milk&limit=1", "")
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, []string{"Call the plumber"}, searchTitles(search(t, router, "q=milk&limit=1&offset=1")))
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/todos/search?q=+", "").Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/todos/search?q=milk&limit=0", "").Code)
+}
+
+func TestSearchToDosIndexSync(t *testing.T) {
+	user := setupTestDB()
+	router := setupSearchRouter(user)
+
+	todo := createTagged(t, router, `{"title":"Draft report"}`)
+	createTagged(t, router, `{"title":"Old report","completed":true}`)
+
+	doJSON(router, "PATCH", idPath("/todos", todo.ID), `{"title":"Final summary"}`)
+	assert.Equal(t, []string{"Old report"}, searchTitles(search(t, router, "q=report")))
+	assert.Equal(t, []string{"Final summary"}, searchTitles(search(t, router, "q=summary")))
+
+	// Фильтры списка задач работают и в поиске
+	assert.Empty(t, search(t, router, "q=report&completed=false"))
+
+	doJSON(router, "DELETE", idPath("/todos", todo.ID), "")
+	assert.Empty(t, search(t, router, "q=summary"))
+	doJSON(router, "DELETE", idPath("/todos", todo.ID)+"?permanent=true", "")
+	assert.Empty(t, search(t, router, "q=summary"))
+}
+
+func TestSearchToDosStemming(t *testing.T) {
+	user := setupTestDB()
+	if searchBackend(database.DB) != "fts5" {
+		// В CI сборка с FTS5 обязана его проверять, а не пропускать
+		if os.Getenv("REQUIRE_FTS5") != "" {
+			t.Fatal("REQUIRE_FTS5 is set, but SQLite is built without FTS5, run tests with -tags sqlite_fts5")
+		}
+		t.Skip("SQLite is built without FTS5, run tests with -tags sqlite_fts5")
+	}
+	router := setupSearchRouter(user)
+
+	createTagged(t, router, `{"title":"Running errands"}`)
+	assert.Equal(t, []string{"Running errands"}, searchTitles(search(t, router, "q=run")))
+}
+
+func TestMarkTerms(t *testing.T) {
+	marked := markTerms("Milk and more milk", []string{"MILK", "and"})
+	assert.Equal(t, "<mark>Milk</mark> <mark>and</mark> more <mark>milk</mark>", renderHighlight(marked))
+
+	long := "Start word word word word word word word word word word word word word word milk word word word word word word"
+	snippet := renderHighlight(snippetAround(markTerms(long, []string{"milk"})))
+	assert.Contains(t, snippet, "<mark>milk</mark>")
+	assert.Contains(t, snippet, "…")
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"net/http"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize — сколько задач удаляется навсегда за одну транзакцию очистки корзины
+const purgeBatchSize = 500
+
+// inTrash ограничивает запрос удалёнными задачами
+func inTrash(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where("deleted_at IS NOT NULL")
+}
+
+// purgeToDos удаляет задачи навсегда вместе с их связями с метками и приглашениями
+func purgeToDos(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM todo_tags WHERE to_do_id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("to_do_id IN ?", ids).Delete(&models.Share{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&models.ToDo{}, ids).Error
+}
+
+// PurgeTrash навсегда удаляет задачи, которые лежат в корзине с момента раньше before.
+// Возвращает число удалённых задач.
+func PurgeTrash(db *gorm.DB, before time.Time) (int64, error) {
+	var total int64
+	for {
+		var ids []uint
+		err := db.Model(&models.ToDo{}).Scopes(inTrash).
+			Where("deleted_at < ?", before).
+			Order("id").Limit(purgeBatchSize).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return total, err
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error { return purgeToDos(tx, ids) }); err != nil {
+			return total, err
+		}
+		total += int64(len(ids))
+	}
+}
+
+// GetTrash godoc
+// @Summary List deleted ToDos
+// @Description List deleted ToDo items of the current user. Accepts the same filters and pagination as GET /todos.
+// @Tags todos
+// @Produce  json
+// @Success 200 {array} models.ToDo
+// @Failure 400 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /todos/trash [get]
+func GetTrash(c *gin.Context) {
+	listToDos(c, currentSpace(c).scope, inTrash)
+}
+
+// RestoreToDo godoc
+// @Summary Restore a deleted ToDo
+// @Description Restore a ToDo item from the trash together with the subtasks deleted with it. If its parent task or project is gone, the task is restored without it.
+// @Tags todos
+// @Produce  json
+// @Param   id  path     int  true  "ToDo ID"
+// @Success 200 {object} models.ToDo
+// @Failure 404 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /todos/{id}/restore [post]
+func RestoreToDo(c *gin.Context) {
+	var todo models.ToDo
+	if err := database.DB.Scopes(ownedBy(resourceOwnerID(c)), inTrash).First(&todo, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена в корзине"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Подзадачи удаляются одним запросом с родителем, поэтому у них то же время удаления
+		ids, _, err := descendantIDs(tx.Unscoped().Session(&gorm.Session{}), todo.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ToDo{}).Unscoped().
+			Where("id IN ? AND deleted_at = ?", append(ids, todo.ID), todo.DeletedAt).
+			Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+			return err
+		}
+
+		// Перечитываем задачу в пустую структуру, иначе gorm оставит в ней старое время удаления
+		id := todo.ID
+		todo = models.ToDo{}
+		if err := tx.First(&todo, id).Error; err != nil {
+			return err
+		}
+		detach := map[string]interface{}{}
+		if todo.ParentID != nil && tx.Select("id").First(&models.ToDo{}, *todo.ParentID).Error != nil {
+			detach["parent_id"] = nil
+		}
+		if todo.ProjectID != nil && tx.Select("id").First(&models.Project{}, *todo.ProjectID).Error != nil {
+			detach["project_id"] = nil
+		}
+		if len(detach) > 0 {
+			if err := tx.Model(&todo).Updates(detach).Error; err != nil {
+				return err
+			}
+		}
+		return setToDoTags(tx, &todo, nil)
+	})
+	if err != nil {
+		respondError(c, err, "Не удалось восстановить задачу")
+		return
+	}
+	c.Header("ETag", toDoETag(&todo))
+	c.JSON(http.StatusOK, todo)
+}
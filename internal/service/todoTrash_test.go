@@ -0,0 +1,124 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTrashRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/todos", GetAllToDos)
+	router.POST("/todos", CreateToDo)
+	router.GET("/todos/trash", GetTrash)
+	router.DELETE("/todos/:id", DeleteToDo)
+	router.POST("/todos/:id/restore", RestoreToDo)
+	return router
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	user := setupTestDB()
+	router := setupTrashRouter(user)
+
+	root, _ := createSubtask(t, router, "root", nil)
+	child, _ := createSubtask(t, router, "child", &root)
+	createSubtask(t, router, "kept", nil)
+
+	// Подзадача, удалённая раньше родителя, не восстанавливается вместе с ним
+	early, _ := createSubtask(t, router, "early", &root)
+	doJSON(router, "DELETE", idPath("/todos", early.ID), "")
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", idPath("/todos", root.ID), "").Code)
+	titles, _ := listTitles(t, router, "")
+	assert.Equal(t, []string{"kept"}, titles)
+
+	w := doJSON(router, "GET", "/todos/trash", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+
+	w = doJSON(router, "POST", idPath("/todos", root.ID)+"/restore", "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var restored models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	assert.False(t, restored.DeletedAt.Valid)
+	assert.Greater(t, restored.Version, root.Version)
+
+	titles, _ = listTitles(t, router, "")
+	assert.Equal(t, []string{"root", "child", "kept"}, titles)
+
+	// Живую задачу восстановить нельзя
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", idPath("/todos", child.ID)+"/restore", "").Code)
+
+	// Подзадача без родителя восстанавливается на верхний уровень
+	doJSON(router, "DELETE", idPath("/todos", root.ID)+"?permanent=true", "")
+	w = doJSON(router, "POST", idPath("/todos", early.ID)+"/restore", "")
+	json.Unmarshal(w.Body.Bytes(), &restored)
+	assert.Nil(t, restored.ParentID)
+}
+
+func TestTrashIsPrivate(t *testing.T) {
+	user := setupTestDB()
+	router := setupTrashRouter(user)
+
+	foreign := models.ToDo{UserID: createTestUser("otheruser").ID, Title: "foreign"}
+	database.DB.Create(&foreign)
+	database.DB.Delete(&foreign)
+
+	titles, _ := listTitles(t, router, "")
+	assert.Empty(t, titles)
+	w := doJSON(router, "GET", "/todos/trash", "")
+	assert.Equal(t, "0", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "POST", idPath("/todos", foreign.ID)+"/restore", "").Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(router, "DELETE", idPath("/todos", foreign.ID)+"?permanent=true", "").Code)
+}
+
+func TestDeleteToDoPermanently(t *testing.T) {
+	user := setupTestDB()
+	router := setupTrashRouter(user)
+
+	todo := createTagged(t, router, `{"title":"Task","tags":["work"]}`)
+	createSubtask(t, router, "child", &todo)
+	trashed, _ := createSubtask(t, router, "trashed", nil)
+	doJSON(router, "DELETE", idPath("/todos", trashed.ID), "")
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", idPath("/todos", todo.ID)+"?permanent=true", "").Code)
+	// Из корзины тоже можно удалить навсегда
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", idPath("/todos", trashed.ID)+"?permanent=true", "").Code)
+
+	var count int64
+	database.DB.Unscoped().Model(&models.ToDo{}).Count(&count)
+	assert.Zero(t, count)
+	database.DB.Table("todo_tags").Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	user := setupTestDB()
+
+	old := models.ToDo{UserID: user.ID, Title: "old"}
+	recent := models.ToDo{UserID: user.ID, Title: "recent"}
+	alive := models.ToDo{UserID: user.ID, Title: "alive"}
+	database.DB.Create(&old)
+	database.DB.Create(&recent)
+	database.DB.Create(&alive)
+	database.DB.Delete(&old)
+	database.DB.Delete(&recent)
+	database.DB.Unscoped().Model(&old).Update("deleted_at", time.Now().AddDate(0, 0, -40))
+
+	purged, err := PurgeTrash(database.DB, time.Now().AddDate(0, 0, -30))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	var titles []string
+	database.DB.Unscoped().Model(&models.ToDo{}).Order("id").Pluck("title", &titles)
+	assert.Equal(t, []string{"recent", "alive"}, titles)
+}
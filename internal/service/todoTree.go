@@ -0,0 +1,159 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"todo-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxToDoDepth — сколько уровней может быть в дереве задач, включая корневую задачу
+var MaxToDoDepth = 3
+
+var errParentNotFound = errors.New("parent task not found")
+
+// parentChain возвращает ID предков задачи parentID начиная с неё самой
+func parentChain(tx *gorm.DB, sp space, parentID uint) ([]uint, error) {
+	var chain []uint
+	next := &parentID
+	// Ограничение на число шагов защищает от зацикливания на испорченных данных
+	for next != nil && len(chain) <= MaxToDoDepth {
+		var parent models.ToDo
+		if err := tx.Select("id", "parent_id").Scopes(sp.scope).First(&parent, *next).Error; err != nil {
+			return nil, errParentNotFound
+		}
+		chain = append(chain, parent.ID)
+		next = parent.ParentID
+	}
+	return chain, nil
+}
+
+// descendantIDs возвращает ID всех подзадач по уровням и высоту поддерева
+func descendantIDs(tx *gorm.DB, id uint) ([]uint, int, error) {
+	var all []uint
+	level := []uint{id}
+	height := 1
+	for len(level) > 0 && height <= MaxToDoDepth+1 {
+		var children []uint
+		if err := tx.Model(&models.ToDo{}).Where("parent_id IN ?", level).Pluck("id", &children).Error; err != nil {
+			return nil, 0, err
+		}
+		if len(children) > 0 {
+			height++
+		}
+		all = append(all, children...)
+		level = children
+	}
+	return all, height, nil
+}
+
+// checkParent проверяет, что новый родитель существует, не создаёт цикл и не превышает глубину дерева
+func checkParent(tx *gorm.DB, todo *models.ToDo) error {
+	if todo.ParentID == nil {
+		return nil
+	}
+	if todo.ID != 0 && *todo.ParentID == todo.ID {
+		return errors.New("task cannot be its own parent")
+	}
+
+	chain, err := parentChain(tx, spaceOf(todo), *todo.ParentID)
+	if err != nil {
+		return err
+	}
+	for _, id := range chain {
+		if id == todo.ID {
+			return errors.New("task cannot be moved under its own subtask")
+		}
+	}
+
+	height := 1
+	if todo.ID != 0 {
+		if _, height, err = descendantIDs(tx, todo.ID); err != nil {
+			return err
+		}
+	}
+	if len(chain)+height > MaxToDoDepth {
+		return fmt.Errorf("tasks can be nested at most %d levels deep", MaxToDoDepth)
+	}
+	return nil
+}
+
+// completeDescendants отмечает выполненными все подзадачи
+func completeDescendants(tx *gorm.DB, id uint, now time.Time) error {
+	ids, _, err := descendantIDs(tx, id)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return tx.Model(&models.ToDo{}).
+		Where("id IN ? AND completed = ?", ids, false).
+		Updates(map[string]interface{}{"completed": true, "completed_at": now.UTC(), "version": gorm.Expr("version + 1")}).Error
+}
+
+// attachProgress заполняет прогресс по прямым подзадачам для задач, у которых они есть
+func attachProgress(tx *gorm.DB, todos []models.ToDo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(todos))
+	for _, todo := range todos {
+		ids = append(ids, todo.ID)
+	}
+
+	var rows []struct {
+		ParentID uint
+		Total    int
+		Done     int
+	}
+	err := tx.Model(&models.ToDo{}).
+		Select("parent_id, COUNT(*) AS total, SUM(CASE WHEN completed THEN 1 ELSE 0 END) AS done").
+		Where("parent_id IN ?", ids).
+		Group("parent_id").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	progress := map[uint]*models.Progress{}
+	for _, row := range rows {
+		progress[row.ParentID] = &models.Progress{Done: row.Done, Total: row.Total}
+	}
+	for i := range todos {
+		todos[i].Progress = progress[todos[i].ID]
+	}
+	return nil
+}
+
+// buildTree загружает все подзадачи корневых задач и раскладывает их по Children
+func buildTree(tx *gorm.DB, roots []models.ToDo) ([]models.ToDo, error) {
+	if err := attachProgress(tx, roots); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(roots))
+	for _, root := range roots {
+		ids = append(ids, root.ID)
+	}
+	if len(ids) == 0 {
+		return roots, nil
+	}
+
+	var children []models.ToDo
+	if err := tx.Where("parent_id IN ?", ids).Preload("Tags").Order("id").Find(&children).Error; err != nil {
+		return nil, err
+	}
+	children, err := buildTree(tx, children)
+	if err != nil {
+		return nil, err
+	}
+
+	byParent := map[uint][]models.ToDo{}
+	for _, child := range children {
+		byParent[*child.ParentID] = append(byParent[*child.ParentID], child)
+	}
+	for i := range roots {
+		roots[i].Children = byParent[roots[i].ID]
+	}
+	return roots, nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTreeRouter(user models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.GET("/todos", GetAllToDos)
+	router.POST("/todos", CreateToDo)
+	router.PUT("/todos/:id", UpdateToDo)
+	router.PATCH("/todos/:id", PatchToDo)
+	router.DELETE("/todos/:id", DeleteToDo)
+	return router
+}
+
+func createSubtask(t *testing.T, router *gin.Engine, title string, parent *models.ToDo) (models.ToDo, int) {
+	body := `{"title":"` + title + `"}`
+	if parent != nil {
+		body = `{"title":"` + title + `","parent_id":` + strconv.FormatUint(uint64(parent.ID), 10) + `}`
+	}
+	w := doJSON(router, "POST", "/todos", body)
+	var todo models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todo)
+	return todo, w.Code
+}
+
+func TestSubtaskDepthLimit(t *testing.T) {
+	user := setupTestDB()
+	router := setupTreeRouter(user)
+
+	root, _ := createSubtask(t, router, "root", nil)
+	child, code := createSubtask(t, router, "child", &root)
+	assert.Equal(t, http.StatusOK, code)
+	grandchild, code := createSubtask(t, router, "grandchild", &child)
+	assert.Equal(t, http.StatusOK, code)
+
+	_, code = createSubtask(t, router, "too deep", &grandchild)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Перенос поддерева тоже учитывает его высоту
+	other, _ := createSubtask(t, router, "other", nil)
+	body := `{"parent_id":` + strconv.FormatUint(uint64(other.ID), 10) + `}`
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "PATCH", idPath("/todos", root.ID), body).Code)
+	assert.Equal(t, http.StatusOK, doJSON(router, "PATCH", idPath("/todos", grandchild.ID), body).Code)
+
+	// Чужая задача не может быть родителем
+	foreign := models.ToDo{UserID: createTestUser("otheruser").ID, Title: "foreign"}
+	database.DB.Create(&foreign)
+	_, code = createSubtask(t, router, "sneaky", &foreign)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestSubtaskMoveRejectsCycles(t *testing.T) {
+	user := setupTestDB()
+	router := setupTreeRouter(user)
+
+	root, _ := createSubtask(t, router, "root", nil)
+	child, _ := createSubtask(t, router, "child", &root)
+
+	self := `{"parent_id":` + strconv.FormatUint(uint64(root.ID), 10) + `}`
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "PATCH", idPath("/todos", root.ID), self).Code)
+
+	underChild := `{"parent_id":` + strconv.FormatUint(uint64(child.ID), 10) + `}`
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "PATCH", idPath("/todos", root.ID), underChild).Code)
+
+	// Подзадачу можно вынести на верхний уровень
+	assert.Equal(t, http.StatusOK, doJSON(router, "PATCH", idPath("/todos", child.ID), `{"parent_id":null}`).Code)
+}
+
+func TestCompleteParentWithCascade(t *testing.T) {
+	user := setupTestDB()
+	router := setupTreeRouter(user)
+
+	root, _ := createSubtask(t, router, "root", nil)
+	child, _ := createSubtask(t, router, "child", &root)
+	createSubtask(t, router, "grandchild", &child)
+	createSubtask(t, router, "second child", &root)
+
+	w := doJSON(router, "PATCH", idPath("/todos", child.ID), `{"completed":true}`)
+	var updated models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.Equal(t, &models.Progress{Done: 0, Total: 1}, updated.Progress)
+
+	// Без cascade подзадачи остаются как есть
+	var open int64
+	database.DB.Model(&models.ToDo{}).Where("completed = ?", false).Count(&open)
+	assert.Equal(t, int64(3), open)
+
+	w = doJSON(router, "PATCH", idPath("/todos", root.ID)+"?cascade=true", `{"completed":true}`)
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.Equal(t, &models.Progress{Done: 2, Total: 2}, updated.Progress)
+
+	database.DB.Model(&models.ToDo{}).Where("completed = ? OR completed_at IS NULL", false).Count(&open)
+	assert.Zero(t, open)
+}
+
+func TestGetAllToDosTreeView(t *testing.T) {
+	user := setupTestDB()
+	router := setupTreeRouter(user)
+
+	root, _ := createSubtask(t, router, "root", nil)
+	child, _ := createSubtask(t, router, "child", &root)
+	createSubtask(t, router, "grandchild", &child)
+	createSubtask(t, router, "single", nil)
+
+	w := doJSON(router, "GET", "/todos?view=tree", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+
+	var todos []models.ToDo
+	json.Unmarshal(w.Body.Bytes(), &todos)
+	assert.Len(t, todos, 2)
+	assert.Equal(t, "root", todos[0].Title)
+	assert.Equal(t, &models.Progress{Done: 0, Total: 1}, todos[0].Progress)
+	assert.Len(t, todos[0].Children, 1)
+	assert.Equal(t, "grandchild", todos[0].Children[0].Children[0].Title)
+	assert.Nil(t, todos[1].Progress)
+
+	titles, _ := listTitles(t, router, "")
+	assert.Len(t, titles, 4)
+	titles, _ = listTitles(t, router, "parent_id="+strconv.FormatUint(uint64(root.ID), 10))
+	assert.Equal(t, []string{"child"}, titles)
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(router, "GET", "/todos?view=graph", "").Code)
+}
+
+func TestDeleteToDoDeletesSubtasks(t *testing.T) {
+	user := setupTestDB()
+	router := setupTreeRouter(user)
+
+	root, _ := createSubtask(t, router, "root", nil)
+	child, _ := createSubtask(t, router, "child", &root)
+	createSubtask(t, router, "grandchild", &child)
+	createSubtask(t, router, "single", nil)
+
+	assert.Equal(t, http.StatusOK, doJSON(router, "DELETE", idPath("/todos", root.ID), "").Code)
+
+	titles, _ := listTitles(t, router, "")
+	assert.Equal(t, []string{"single"}, titles)
+}
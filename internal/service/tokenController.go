@@ -0,0 +1,241 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// startSession создаёт сессию для пользователя и выдаёт первую пару токенов
+func startSession(c *gin.Context, user models.User) (gin.H, error) {
+	session := models.Session{
+		UserID:    user.ID,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+
+	var tokens gin.H
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		// Вход до окончательного удаления учётной записи отменяет удаление.
+		// Если очистка успела удалить пользователя раньше, входить уже некуда.
+		if user.DeletionScheduledAt != nil {
+			result := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("deletion_scheduled_at", nil)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+		var err error
+		tokens, err = issueTokens(tx, user, session.ID)
+		return err
+	})
+	return tokens, err
+}
+
+// issueTokens выдаёт access токен и новый refresh токен в рамках сессии
+func issueTokens(tx *gorm.DB, user models.User, sessionID uint) (gin.H, error) {
+	accessToken, err := newAccessToken(user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	record := models.RefreshToken{
+		SessionID: sessionID,
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+	}, nil
+}
+
+func newAccessToken(user models.User, sessionID uint) (string, error) {
+	claims := &Claims{
+		Username:  user.Username,
+		SessionID: sessionID,
+		Role:      user.Role,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(AccessTokenTTL).Unix(),
+		},
+	}
+	return Keys.Sign(claims)
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// revokeSessions отзывает все активные сессии, подходящие под условие
+func revokeSessions(tx *gorm.DB, query interface{}, args ...interface{}) error {
+	return tx.Model(&models.Session{}).
+		Where(query, args...).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+// rotateRefreshToken обменивает refresh токен на новую пару токенов.
+// Повторное использование уже обменянного токена отзывает всю сессию.
+func rotateRefreshToken(tx *gorm.DB, presented string) (gin.H, error) {
+	var record models.RefreshToken
+	if err := tx.Where("token_hash = ?", hashToken(presented)).First(&record).Error; err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	if record.UsedAt != nil {
+		log.Printf("Refresh token reuse detected for session %d, revoking it", record.SessionID)
+		if err := revokeSessions(tx, "id = ?", record.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	var session models.Session
+	if err := tx.Where("id = ? AND revoked_at IS NULL", record.SessionID).First(&session).Error; err != nil {
+		return nil, errInvalidRefreshToken
+	}
+	var user models.User
+	if err := tx.Where("disabled_at IS NULL").First(&user, record.UserID).Error; err != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	// Условие used_at IS NULL защищает от двух одновременных обменов одного токена
+	result := tx.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if err := revokeSessions(tx, "id = ?", record.SessionID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidRefreshToken
+	}
+
+	return issueTokens(tx, user, session.ID)
+}
+
+// RefreshToken godoc
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access token and a new refresh token. A reused refresh token revokes its whole session.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param   body  body     refreshRequest  true  "Refresh token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} gin.H
+// @Failure 401 {object} gin.H
+// @Failure 500 {object} gin.H
+// @Router /token/refresh [post]
+func RefreshToken(c *gin.Context) {
+	var input refreshRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tokens gin.H
+	var rotateErr error
+	// Отзыв сессии при повторном использовании должен сохраниться, поэтому
+	// ошибку невалидного токена не возвращаем из транзакции
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		tokens, rotateErr = rotateRefreshToken(tx, input.RefreshToken)
+		if errors.Is(rotateErr, errInvalidRefreshToken) {
+			return nil
+		}
+		return rotateErr
+	})
+	if err != nil {
+		log.Println("Error while refreshing token:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить токен"})
+		return
+	}
+	if rotateErr != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revoke the current session with all its tokens
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Failure 500 {object} gin.H
+// @Router /logout [post]
+func Logout(c *gin.Context) {
+	if err := revokeSessions(database.DB, "id = ? AND user_id = ?", c.GetUint("sessionID"), currentUserID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось завершить сессию"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll godoc
+// @Summary Log out everywhere
+// @Description Revoke every session of the current user
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Failure 500 {object} gin.H
+// @Router /logout-all [post]
+func LogoutAll(c *gin.Context) {
+	if err := revokeSessions(database.DB, "user_id = ?", currentUserID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось завершить сессии"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all sessions"})
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func postRefresh(router *gin.Engine, refreshToken string) *httptest.ResponseRecorder {
+	jsonValue, _ := json.Marshal(gin.H{"refresh_token": refreshToken})
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	user := setupTestDB()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/token/refresh", RefreshToken)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("POST", "/login", nil)
+	tokens, err := startSession(c, user)
+	assert.NoError(t, err)
+
+	w := postRefresh(router, tokens["refresh_token"].(string))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var rotated map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.NotEmpty(t, rotated["token"])
+	assert.NotEqual(t, tokens["refresh_token"], rotated["refresh_token"])
+
+	// Новый refresh токен тоже рабочий
+	w = postRefresh(router, rotated["refresh_token"].(string))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	user := setupTestDB()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/token/refresh", RefreshToken)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("POST", "/login", nil)
+	tokens, _ := startSession(c, user)
+	stolen := tokens["refresh_token"].(string)
+
+	w := postRefresh(router, stolen)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rotated map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &rotated)
+
+	// Повторное использование старого токена отзывает сессию целиком
+	w = postRefresh(router, stolen)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var session models.Session
+	database.DB.First(&session)
+	assert.NotNil(t, session.RevokedAt)
+
+	// Поэтому и легитимный новый токен больше не работает
+	w = postRefresh(router, rotated["refresh_token"].(string))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRefreshTokenUnknown(t *testing.T) {
+	setupTestDB()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/token/refresh", RefreshToken)
+
+	w := postRefresh(router, "unknown")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLogoutAll(t *testing.T) {
+	user := setupTestDB()
+	other := createTestUser("otheruser")
+
+	database.DB.Create(&models.Session{UserID: user.ID})
+	database.DB.Create(&models.Session{UserID: user.ID})
+	database.DB.Create(&models.Session{UserID: other.ID})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(withUser(user))
+	router.POST("/logout-all", LogoutAll)
+
+	req, _ := http.NewRequest("POST", "/logout-all", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var active int64
+	database.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Count(&active)
+	assert.Zero(t, active)
+	database.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", other.ID).Count(&active)
+	assert.Equal(t, int64(1), active)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHOTPRFC6238Vectors(t *testing.T) {
+	// Тестовые значения SHA1 из приложения B RFC 6238
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, code := range vectors {
+		assert.Equal(t, code, hotp(key, uint64(totpStep(time.Unix(unix, 0))), 8), unix)
+	}
+}
+
+func TestCheckTOTP(t *testing.T) {
+	secret, err := newTOTPSecret()
+	assert.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	code, err := TOTPCode(secret, now)
+	assert.NoError(t, err)
+	assert.Len(t, code, totpDigits)
+
+	step, ok := checkTOTP(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now), step)
+
+	// Код соседнего шага принимается из-за расхождения часов, более старый — нет
+	_, ok = checkTOTP(secret, code, now.Add(totpPeriod), 0)
+	assert.True(t, ok)
+	_, ok = checkTOTP(secret, code, now.Add(3*totpPeriod), 0)
+	assert.False(t, ok)
+
+	// Уже использованный шаг не принимается повторно
+	_, ok = checkTOTP(secret, code, now, step)
+	assert.False(t, ok)
+	_, ok = checkTOTP(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(totpURI("JBSWY3DPEHPK3PXP", "alice"))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/ToDo App:alice", uri.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", uri.Query().Get("secret"))
+	assert.Equal(t, totpIssuer, uri.Query().Get("issuer"))
+}
@@ -0,0 +1,498 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"todo-app/internal/database"
+	"todo-app/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errLastAdmin — пространство осталось бы без администратора
+var errLastAdmin = errors.New("workspace must keep at least one admin")
+
+// WorkspaceInviteInput — приглашение пользователя в рабочее пространство
+type WorkspaceInviteInput struct {
+	Username string               `json:"username" binding:"required"`
+	Role     models.WorkspaceRole `json:"role" binding:"required"`
+}
+
+// WorkspaceRoleInput — новая роль участника
+type WorkspaceRoleInput struct {
+	Role models.WorkspaceRole `json:"role" binding:"required"`
+}
+
+// joinedMembers ограничивает запрос участниками, принявшими приглашение
+func joinedMembers(db *gorm.DB) *gorm.DB {
+	return db.Where("joined_at IS NOT NULL")
+}
+
+// WorkspaceRoleOf возвращает роль пользователя в рабочем пространстве.
+// Тем, кто не состоит в нём или ещё не принял приглашение, возвращается RoleNone.
+func WorkspaceRoleOf(userID, workspaceID uint) (models.WorkspaceRole, error) {
+	var member models.WorkspaceMember
+	err := database.DB.Scopes(joinedMembers).Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.RoleNone, nil
+	}
+	return member.Role, err
+}
+
+// WorkspaceInvitationAccess находит приглашение в рабочее пространство.
+// Распоряжаться им может только приглашённый пользователь.
+func WorkspaceInvitationAccess(userID uint, id string) (Access, error) {
+	var member models.WorkspaceMember
+	if err := database.DB.Select("id", "user_id").First(&member, id).Error; err != nil {
+		return Access{}, err
+	}
+	if member.UserID != userID {
+		return Access{OwnerID: member.UserID}, nil
+	}
+	return Access{OwnerID: userID, Permission: models.PermissionOwner}, nil
+}
+
+// currentWorkspaceID возвращает рабочее пространство, которое WorkspaceContext положил в контекст
+func currentWorkspaceID(c *gin.Context) uint {
+	return c.GetUint("workspaceID")
+}
+
+// lockAdmins блокирует строки администраторов пространства до конца транзакции и возвращает их ID.
+// Строки блокируются по порядку ID и раньше строки изменяемого участника: так два администратора,
+// которые одновременно понижают друг друга, ждут друг друга, а не попадают во взаимную блокировку.
+func lockAdmins(tx *gorm.DB, workspaceID uint) ([]uint, error) {
+	var admins []uint
+	err := tx.Model(&models.WorkspaceMember{}).Scopes(joinedMembers, forUpdate).
+		Where("workspace_id = ? AND role = ?", workspaceID, models.RoleAdmin).Order("id").Pluck("id", &admins).Error
+	return admins, err
+}
+
+// checkLastAdmin не даёт убрать из пространства последнего администратора:
+// member перестаёт быть администратором, и других администраторов из admins не остаётся
+func checkLastAdmin(member models.WorkspaceMember, admins []uint) error {
+	if member.Role != models.RoleAdmin || member.JoinedAt == nil {
+		return nil
+	}
+	if len(admins) <= 1 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// changeMember находит участника текущего пространства, проверяет, что после change
+// в пространстве останется администратор, и выполняет change
+func changeMember(c *gin.Context, query *gorm.DB, demote bool, change func(tx *gorm.DB, member *models.WorkspaceMember) error) (models.WorkspaceMember, error) {
+	var member models.WorkspaceMember
+	workspaceID := currentWorkspaceID(c)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var admins []uint
+		if demote {
+			var err error
+			if admins, err = lockAdmins(tx, workspaceID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Scopes(forUpdate).Where(query).Where("workspace_id = ?", workspaceID).First(&member).Error; err != nil {
+			return err
+		}
+		if demote {
+			if err := checkLastAdmin(member, admins); err != nil {
+				return err
+			}
+		}
+		return change(tx, &member)
+	})
+	return member, err
+}
+
+// respondMemberError отвечает клиенту ошибкой изменения участника
+func respondMemberError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Участник не найден"})
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "В пространстве должен остаться хотя бы один администратор"})
+	default:
+		log.Println("Error while changing workspace member:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось изменить участника"})
+	}
+}
+
+// fillMemberUsers заполняет имена участников
+func fillMemberUsers(members []models.WorkspaceMember) error {
+	var ids []uint
+	for _, member := range members {
+		ids = append(ids, member.UserID)
+	}
+	var users []models.User
+	if err := database.DB.Select("id", "username").Find(&users, ids).Error; err != nil {
+		return err
+	}
+	names := make(map[uint]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	for i := range members {
+		members[i].Username = names[members[i].UserID]
+	}
+	return nil
+}
+
+// CreateWorkspace godoc
+// @Summary Create a workspace
+// @Description Create a team workspace. The creator becomes its admin.
+// @Tags workspaces
+// @Accept  json
+// @Produce  json
+// @Param   workspace  body     models.Workspace  true  "Workspace"
+// @Success 200 {object} models.Workspace
+// @Failure 400 {object} gin.H
+// @Router /workspaces [post]
+func CreateWorkspace(c *gin.Context) {
+	var input models.Workspace
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	workspace := models.Workspace{Name: input.Name, Role: models.RoleAdmin}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		return tx.Create(&models.WorkspaceMember{
+			WorkspaceID: workspace.ID, UserID: currentUserID(c), Role: models.RoleAdmin, JoinedAt: &now,
+		}).Error
+	})
+	if err != nil {
+		log.Println("Error while creating workspace:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось создать пространство"})
+		return
+	}
+	c.JSON(http.StatusOK, workspace)
+}
+
+// GetWorkspaces godoc
+// @Summary List workspaces
+// @Description List workspaces the current user has joined, with the user's role in each
+// @Tags workspaces
+// @Produce  json
+// @Success 200 {array} models.Workspace
+// @Failure 500 {object} gin.H
+// @Router /workspaces [get]
+func GetWorkspaces(c *gin.Context) {
+	var members []models.WorkspaceMember
+	if err := database.DB.Scopes(joinedMembers).Where("user_id = ?", currentUserID(c)).Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить пространства"})
+		return
+	}
+	roles := make(map[uint]models.WorkspaceRole, len(members))
+	var ids []uint
+	for _, member := range members {
+		roles[member.WorkspaceID] = member.Role
+		ids = append(ids, member.WorkspaceID)
+	}
+	workspaces := []models.Workspace{}
+	if err := database.DB.Where("id IN ?", ids).Order("id").Find(&workspaces).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить пространства"})
+		return
+	}
+	for i := range workspaces {
+		workspaces[i].Role = roles[workspaces[i].ID]
+	}
+	c.JSON(http.StatusOK, workspaces)
+}
+
+// GetWorkspace godoc
+// @Summary Get a workspace
+// @Tags workspaces
+// @Produce  json
+// @Param   wid  path     int  true  "Workspace ID"
+// @Success 200 {object} models.Workspace
+// @Failure 404 {object} gin.H
+// @Router /workspaces/{wid} [get]
+func GetWorkspace(c *gin.Context) {
+	var workspace models.Workspace
+	if err := database.DB.First(&workspace, currentWorkspaceID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пространство не найдено"})
+		return
+	}
+	workspace.Role = c.MustGet("workspaceRole").(models.WorkspaceRole)
+	c.JSON(http.StatusOK, workspace)
+}
+
+// UpdateWorkspace godoc
+// @Summary Rename a workspace
+// @Tags workspaces
+// @Accept  json
+// @Produce  json
+// @Param   wid        path     int               true  "Workspace ID"
+// @Param   workspace  body     models.Workspace  true  "Workspace"
+// @Success 200 {object} models.Workspace
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Router /workspaces/{wid} [put]
+func UpdateWorkspace(c *gin.Context) {
+	var workspace models.Workspace
+	if err := database.DB.First(&workspace, currentWorkspaceID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пространство не найдено"})
+		return
+	}
+	var input models.Workspace
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Model(&workspace).Update("name", input.Name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось обновить пространство"})
+		return
+	}
+	workspace.Role = models.RoleAdmin
+	c.JSON(http.StatusOK, workspace)
+}
+
+// GetWorkspaceMembers godoc
+// @Summary List workspace members
+// @Description List members of a workspace, including invited users who have not joined yet
+// @Tags workspaces
+// @Produce  json
+// @Param   wid  path     int  true  "Workspace ID"
+// @Success 200 {array} models.WorkspaceMember
+// @Failure 404 {object} gin.H
+// @Router /workspaces/{wid}/members [get]
+func GetWorkspaceMembers(c *gin.Context) {
+	var members []models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ?", currentWorkspaceID(c)).Order("id").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить участников"})
+		return
+	}
+	if err := fillMemberUsers(members); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить участников"})
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// InviteWorkspaceMember godoc
+// @Summary Invite a workspace member
+// @Description Invite a user to a workspace as guest, member or admin. Inviting a user who has not joined yet again changes the role.
+// @Tags workspaces
+// @Accept  json
+// @Produce  json
+// @Param   wid     path     int                   true  "Workspace ID"
+// @Param   member  body     WorkspaceInviteInput  true  "Invitation"
+// @Success 200 {object} models.WorkspaceMember
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /workspaces/{wid}/members [post]
+func InviteWorkspaceMember(c *gin.Context) {
+	var input WorkspaceInviteInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var user models.User
+	if err := database.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+		return
+	}
+
+	member := models.WorkspaceMember{WorkspaceID: currentWorkspaceID(c), UserID: user.ID}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where(&member).First(&member).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if member.JoinedAt != nil {
+			return gorm.ErrDuplicatedKey
+		}
+		member.Role = input.Role
+		return tx.Save(&member).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Пользователь уже состоит в пространстве"})
+		return
+	}
+	if err != nil {
+		log.Println("Error while inviting workspace member:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось пригласить участника"})
+		return
+	}
+	member.Username = user.Username
+	c.JSON(http.StatusOK, member)
+}
+
+// UpdateWorkspaceMember godoc
+// @Summary Change a member's role
+// @Description Change the role of a workspace member. The last admin cannot be demoted.
+// @Tags workspaces
+// @Accept  json
+// @Produce  json
+// @Param   wid       path     int                 true  "Workspace ID"
+// @Param   memberId  path     int                 true  "Member ID"
+// @Param   role      body     WorkspaceRoleInput  true  "Role"
+// @Success 200 {object} models.WorkspaceMember
+// @Failure 400 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /workspaces/{wid}/members/{memberId} [put]
+func UpdateWorkspaceMember(c *gin.Context) {
+	var input WorkspaceRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	member, err := changeMember(c, database.DB.Where("id = ?", c.Param("memberId")), input.Role != models.RoleAdmin,
+		func(tx *gorm.DB, member *models.WorkspaceMember) error {
+			member.Role = input.Role
+			return tx.Model(member).Update("role", input.Role).Error
+		})
+	if err != nil {
+		respondMemberError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveWorkspaceMember godoc
+// @Summary Remove a workspace member
+// @Description Remove a member or cancel an invitation. The last admin cannot be removed.
+// @Tags workspaces
+// @Produce  json
+// @Param   wid       path     int  true  "Workspace ID"
+// @Param   memberId  path     int  true  "Member ID"
+// @Success 200 {object} gin.H
+// @Failure 403 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /workspaces/{wid}/members/{memberId} [delete]
+func RemoveWorkspaceMember(c *gin.Context) {
+	_, err := changeMember(c, database.DB.Where("id = ?", c.Param("memberId")), true, deleteMember)
+	if err != nil {
+		respondMemberError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Участник удалён"})
+}
+
+// LeaveWorkspace godoc
+// @Summary Leave a workspace
+// @Description Leave a workspace. The last admin cannot leave until another admin is appointed.
+// @Tags workspaces
+// @Produce  json
+// @Param   wid  path     int  true  "Workspace ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /workspaces/{wid}/leave [post]
+func LeaveWorkspace(c *gin.Context) {
+	_, err := changeMember(c, database.DB.Where("user_id = ?", currentUserID(c)), true, deleteMember)
+	if err != nil {
+		respondMemberError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Вы покинули пространство"})
+}
+
+func deleteMember(tx *gorm.DB, member *models.WorkspaceMember) error {
+	return tx.Delete(member).Error
+}
+
+// GetWorkspaceInvitations godoc
+// @Summary List workspace invitations
+// @Description List pending workspace invitations of the current user
+// @Tags workspaces
+// @Produce  json
+// @Success 200 {array} models.WorkspaceMember
+// @Failure 500 {object} gin.H
+// @Router /workspaces/invitations [get]
+func GetWorkspaceInvitations(c *gin.Context) {
+	members := []models.WorkspaceMember{}
+	if err := database.DB.Where("user_id = ? AND joined_at IS NULL", currentUserID(c)).Order("id").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить приглашения"})
+		return
+	}
+	var ids []uint
+	for _, member := range members {
+		ids = append(ids, member.WorkspaceID)
+	}
+	var workspaces []models.Workspace
+	if err := database.DB.Where("id IN ?", ids).Find(&workspaces).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось получить приглашения"})
+		return
+	}
+	byID := make(map[uint]*models.Workspace, len(workspaces))
+	for i := range workspaces {
+		byID[workspaces[i].ID] = &workspaces[i]
+	}
+	for i := range members {
+		members[i].Workspace = byID[members[i].WorkspaceID]
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+// findWorkspaceInvitation загружает приглашение текущего пользователя, которое он ещё не принял
+func findWorkspaceInvitation(c *gin.Context, member *models.WorkspaceMember) bool {
+	if err := database.DB.Where("user_id = ?", currentUserID(c)).First(member, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Приглашение не найдено"})
+		return false
+	}
+	if member.JoinedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Приглашение уже принято"})
+		return false
+	}
+	return true
+}
+
+// AcceptWorkspaceInvitation godoc
+// @Summary Accept a workspace invitation
+// @Tags workspaces
+// @Produce  json
+// @Param   id  path     int  true  "Invitation ID"
+// @Success 200 {object} models.WorkspaceMember
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /workspaces/invitations/{id}/accept [post]
+func AcceptWorkspaceInvitation(c *gin.Context) {
+	var member models.WorkspaceMember
+	if !findWorkspaceInvitation(c, &member) {
+		return
+	}
+	now := time.Now()
+	if err := database.DB.Model(&member).Update("joined_at", &now).Error; err != nil {
+		log.Println("Error while joining workspace:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось принять приглашение"})
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+// DeclineWorkspaceInvitation godoc
+// @Summary Decline a workspace invitation
+// @Tags workspaces
+// @Produce  json
+// @Param   id  path     int  true  "Invitation ID"
+// @Success 200 {object} gin.H
+// @Failure 404 {object} gin.H
+// @Failure 409 {object} gin.H
+// @Router /workspaces/invitations/{id}/decline [post]
+func DeclineWorkspaceInvitation(c *gin.Context) {
+	var member models.WorkspaceMember
+	if !findWorkspaceInvitation(c, &member) {
+		return
+	}
+	if err := database.DB.Delete(&member).Error; err != nil {
+		log.Println("Error while declining workspace invitation:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отклонить приглашение"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Приглашение отклонено"})
+}